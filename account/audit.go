@@ -0,0 +1,150 @@
+/*
+    package account
+    audit.go
+    - audit log of every mutation of the user. each entry record the actor,
+      the action, before/ after value of the changed field and the request id.
+      the passkey is never written to the log, only whether it was changed
+*/
+package account
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// action of the audit entry
+const (
+    ActionCreate  = "create"
+    ActionUpdate  = "update"
+    ActionDelete  = "delete"
+    ActionRestore = "restore"
+    ActionRehash  = "rehash"
+    ActionPurge   = "purge"
+)
+
+// redacted replace the passkey hash in the audit entry
+const redacted = "[redacted]"
+
+// FieldChange is before and after value of single changed field, nil before
+// value means the field was not set (eg on create)
+type FieldChange struct {
+    Before interface{} `json:"before"`
+    After  interface{} `json:"after"`
+}
+
+// AuditEntry is single mutation of the user
+type AuditEntry struct {
+    ID        int64                  `json:"id"`
+    UserID    int                    `json:"user_id"`
+    // ActorID is nil when the mutation is not made by a caller, eg from the
+    // command line or by the purge job
+    ActorID   *int                   `json:"actor_id,omitempty"`
+    Action    string                 `json:"action"`
+    Changes   map[string]FieldChange `json:"changes"`
+    RequestID string                 `json:"request_id,omitempty"`
+    CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditPage is single page of audit entries, the newest entry first
+type AuditPage struct {
+    Entries    []*AuditEntry `json:"entries"`
+    NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// HistoryOptions is option of listing audit entries of the user
+type HistoryOptions struct {
+    // Limit is page size, zero will use DefaultLimit
+    Limit int
+
+    // Cursor is NextCursor of the previous page, empty for the first page
+    Cursor string
+}
+
+// historySort is sort of the history cursor, so list cursor is not accepted
+const historySort = "-history"
+
+// query will validate the options, apply the default limit and get id of
+// the last entry of the previous page, zero for the first page. the returned
+// error is *ValidationError listing every invalid option
+func (o HistoryOptions) query() (HistoryOptions, int64, error) {
+    v := new(validator)
+    if o.Limit == 0 {
+        o.Limit = DefaultLimit
+    }
+    if o.Limit < 1 || o.Limit > MaxLimit {
+        v.add("limit", "must be between 1 and "+strconv.Itoa(MaxLimit))
+    }
+
+    var after int64
+    if o.Cursor != "" {
+        c, err := decodeCursor(o.Cursor)
+        if err != nil || c.Sort != historySort || c.Value == "" {
+            v.add("cursor", "is invalid")
+        } else if after, err = strconv.ParseInt(c.Value, 10, 64); err != nil {
+            v.add("cursor", "is invalid")
+        }
+    }
+
+    return o, after, v.err()
+}
+
+// historyCursor will get cursor pointing after audit entry 'e'
+func historyCursor(e *AuditEntry) string {
+    b, _ := json.Marshal(cursor{Sort: historySort, Value: strconv.FormatInt(e.ID, 10)})
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// auditFields is audited field of the user, named as the request body. the
+// version and update time/ actor are not audited, they are implied by the entry
+var auditFields = []struct {
+    name  string
+    value func(u *User) interface{}
+}{
+    {"firstname", func(u *User) interface{} { return u.Firstname }},
+    {"lastname", func(u *User) interface{} { return u.Lastname }},
+    {"email", func(u *User) interface{} { return u.Email }},
+    {"passkey", func(u *User) interface{} { return u.PassKey }},
+    {"role", func(u *User) interface{} { return u.Role }},
+    {"deleted_at", func(u *User) interface{} {
+        if u.DeletedAt == nil {
+            return nil
+        }
+        return formatTime(*u.DeletedAt)
+    }},
+}
+
+// diffUsers will get changed field between 'before' and 'after', nil user
+// has no value. the passkey hash is redacted
+func diffUsers(before, after *User) map[string]FieldChange {
+    changes := make(map[string]FieldChange)
+    for _, f := range auditFields {
+        var b, a interface{}
+        if before != nil {
+            b = f.value(before)
+        }
+        if after != nil {
+            a = f.value(after)
+        }
+        if b == a {
+            continue
+        }
+
+        if f.name == "passkey" {
+            b, a = redact(b), redact(a)
+        }
+        changes[f.name] = FieldChange{Before: b, After: a}
+    }
+
+    return changes
+}
+
+// redact will replace passkey 'v' with redacted, nil is kept so setting the
+// passkey is told apart from changing it
+func redact(v interface{}) interface{} {
+    if v == nil {
+        return nil
+    }
+    return redacted
+}
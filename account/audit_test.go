@@ -0,0 +1,88 @@
+/*
+    package account
+    audit_test.go
+    - test diffing the user for the audit entry and the history option
+*/
+package account
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDiffUsers will test changed field of the audit entry
+func TestDiffUsers(t *testing.T) {
+    before := User{ID: 1, Firstname: "john", Lastname: "doe", Email: "john@doe.com", PassKey: "hash-1", Role: RoleUser}
+
+    t.Run("EXPECT SUCCESS create", func(t *testing.T) {
+        got := diffUsers(nil, &before)
+
+        assert.Equal(t, FieldChange{Before: nil, After: "john@doe.com"}, got["email"])
+        assert.Equal(t, FieldChange{Before: nil, After: redacted}, got["passkey"])
+        assert.NotContains(t, got, "deleted_at")
+    })
+
+    t.Run("EXPECT SUCCESS only changed field, passkey redacted", func(t *testing.T) {
+        after := before
+        after.Email = "jd@doe.com"
+        after.PassKey = "hash-2"
+        after.Version = 2
+
+        got := diffUsers(&before, &after)
+
+        assert.Equal(t, map[string]FieldChange{
+            "email":   {Before: "john@doe.com", After: "jd@doe.com"},
+            "passkey": {Before: redacted, After: redacted},
+        }, got)
+    })
+
+    t.Run("EXPECT SUCCESS soft delete", func(t *testing.T) {
+        after := before
+        after.DeletedAt = &testTime
+
+        got := diffUsers(&before, &after)
+
+        assert.Equal(t, map[string]FieldChange{
+            "deleted_at": {Before: nil, After: "2022-01-02T03:04:05Z"},
+        }, got)
+    })
+
+    t.Run("EXPECT SUCCESS unchanged", func(t *testing.T) {
+        after := before
+        assert.Empty(t, diffUsers(&before, &after))
+    })
+}
+
+// TestHistoryOptionsQuery will test validating and defaulting HistoryOptions
+func TestHistoryOptionsQuery(t *testing.T) {
+    t.Run("EXPECT SUCCESS default", func(t *testing.T) {
+        q, after, err := HistoryOptions{}.query()
+        require.NoError(t, err)
+        assert.Equal(t, DefaultLimit, q.Limit)
+        assert.Zero(t, after)
+    })
+
+    t.Run("EXPECT SUCCESS cursor", func(t *testing.T) {
+        _, after, err := HistoryOptions{Cursor: historyCursor(&AuditEntry{ID: 42})}.query()
+        require.NoError(t, err)
+        assert.Equal(t, int64(42), after)
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T) {
+        list := listQuery{ListOptions: ListOptions{Sort: "id"}, field: "id"}
+        cases := map[string]HistoryOptions{
+            "limit":  {Limit: MaxLimit + 1},
+            "cursor": {Cursor: list.nextCursor(&User{ID: 3})},
+        }
+
+        for field, opts := range cases {
+            _, _, err := opts.query()
+            var verr *ValidationError
+            require.ErrorAs(t, err, &verr, field)
+            require.Len(t, verr.Fields, 1, field)
+            assert.Equal(t, field, verr.Fields[0].Field)
+        }
+    })
+}
@@ -0,0 +1,36 @@
+/*
+    package account
+    caller.go
+    - identity of the authenticated caller carried by the request context, set
+      by the auth middleware and used by the service layer to enforce the role
+*/
+package account
+
+import "context"
+
+// Caller is the authenticated user performing the request
+type Caller struct {
+    ID    int
+    Email string
+    Role  string
+}
+
+// IsAdmin will report whether the caller has admin role
+func (c Caller) IsAdmin() bool {
+    return c.Role == RoleAdmin
+}
+
+// callerKey is context key of the caller
+type callerKey struct{}
+
+// WithCaller will get copy of 'ctx' carrying 'caller'
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+    return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFrom will get the caller carried by 'ctx'. false is returned when the
+// request is not authenticated, eg operation started from the command line
+func CallerFrom(ctx context.Context) (Caller, bool) {
+    caller, ok := ctx.Value(callerKey{}).(Caller)
+    return caller, ok
+}
@@ -7,32 +7,226 @@ package account
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 // DatabaseConfig is configuration wrapper for our database setting
 type DatabaseConfig struct {
-    Username string
-    Password string
-    Hostname string
-    Port string
-    DBName string
+    Username string `yaml:"username"`
+    Password string `yaml:"password"`
+    Hostname string `yaml:"hostname"`
+    Port string `yaml:"port"`
+    DBName string `yaml:"dbname"`
+
+    // SSLMode is one of "disable", "allow", "prefer", "require", "verify-ca"
+    // or "verify-full". empty value will use the driver default ("prefer")
+    SSLMode string `yaml:"sslmode"`
+
+    // SSLRootCert is path to the certificate authority file, SSLCert and SSLKey
+    // are path to the client certificate and its private key
+    SSLRootCert string `yaml:"sslrootcert"`
+    SSLCert string `yaml:"sslcert"`
+    SSLKey string `yaml:"sslkey"`
+
+    // ApplicationName is reported to the server and shown in pg_stat_activity
+    ApplicationName string `yaml:"application_name"`
+
+    // SearchPath is comma separated schema search path, eg "app,public"
+    SearchPath string `yaml:"search_path"`
+
+    // ConnectTimeout is maximum time to wait while connecting, rounded up to
+    // whole second. zero means wait indefinitely
+    ConnectTimeout time.Duration `yaml:"connect_timeout"`
+
+    // Params is extra connection parameters appended to the DSN
+    Params map[string]string `yaml:"params"`
+
+    // MaxConns and MinConns is maximum and minimum size of the pool. zero
+    // value will use pgxpool default
+    MaxConns int32 `yaml:"max_conns"`
+    MinConns int32 `yaml:"min_conns"`
+
+    // MaxConnLifetime is duration since creation after which a connection will
+    // be closed, MaxConnIdleTime is duration after which an idle connection
+    // will be closed and HealthCheckPeriod is how often the pool check its
+    // idle connections. zero value will use pgxpool default
+    MaxConnLifetime time.Duration `yaml:"max_conn_lifetime"`
+    MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"`
+    HealthCheckPeriod time.Duration `yaml:"health_check_period"`
+
+    // AfterConnect is called after every new connection is established, eg to
+    // register custom types or prepare statements
+    AfterConnect func(context.Context, *pgx.Conn) error `yaml:"-"`
+
+    // Retry is setting to retry connecting while the database is not reachable yet
+    Retry RetryConfig `yaml:"retry"`
+
+    // MinServerVersion is minimum supported postgres version in "major" or
+    // "major.minor" format, eg "10" or "9.6". empty means any version
+    MinServerVersion string `yaml:"min_server_version"`
+
+    // QueryTimeout is maximum duration of each database operation
+    QueryTimeout QueryTimeouts `yaml:"query_timeout"`
 }
 
-// DSN will get datasource name of the database configuration
+// RetryConfig is setting for retrying database connection with exponential backoff
+type RetryConfig struct {
+    // MaxAttempts is maximum number of connection attempt, zero or one means
+    // there will be no retry
+    MaxAttempts int `yaml:"max_attempts"`
+
+    // InitialBackoff is the wait time after the first failed attempt, it will
+    // be multiplied by Multiplier after each attempt until reaching MaxBackoff
+    InitialBackoff time.Duration `yaml:"initial_backoff"`
+    MaxBackoff time.Duration `yaml:"max_backoff"`
+    Multiplier float64 `yaml:"multiplier"`
+
+    // Jitter is fraction (0 to 1) of random variation added to each backoff so
+    // multiple instance do not retry at the same time
+    Jitter float64 `yaml:"jitter"`
+
+    // Timeout is total time allowed for all attempts, zero means only the
+    // deadline of the given context is used
+    Timeout time.Duration `yaml:"timeout"`
+}
+
+// default value for RetryConfig zero value
+const (
+    defaultInitialBackoff = time.Duration(time.Second)
+    defaultMaxBackoff = time.Duration(time.Second * 30)
+    defaultMultiplier = 2.0
+)
+
+// backoff will get wait duration after 'attempt' (starting from 1) is failed
+func (r RetryConfig) backoff(attempt int) time.Duration {
+    initial, max, multiplier := r.InitialBackoff, r.MaxBackoff, r.Multiplier
+    if initial <= 0 {
+        initial = defaultInitialBackoff
+    }
+    if max <= 0 {
+        max = defaultMaxBackoff
+    }
+    if multiplier < 1 {
+        multiplier = defaultMultiplier
+    }
+
+    // exponential backoff capped by max backoff
+    d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+    if d > float64(max) {
+        d = float64(max)
+    }
+
+    // add random jitter in range of [-jitter, +jitter]
+    if r.Jitter > 0 {
+        d += d * r.Jitter * (2*rand.Float64() - 1)
+    }
+
+    return time.Duration(d)
+}
+
+// DSN will get datasource name of the database configuration. credentials and
+// database name are percent-encoded so any character can be used
 func (db DatabaseConfig) DSN() string {
-    return fmt.Sprintf("postgres://%s:%s@%s:%s/%s", 
-        db.Username, db.Password, db.Hostname, db.Port, db.DBName)
+    u := url.URL{
+        Scheme: "postgres",
+        Host:   net.JoinHostPort(db.Hostname, db.Port),
+        Path:   "/" + db.DBName,
+    }
+
+    // set user info, password only included if it is not empty
+    if db.Password != "" {
+        u.User = url.UserPassword(db.Username, db.Password)
+    } else {
+        u.User = url.User(db.Username)
+    }
+
+    // extra parameters first, so dedicated field will take precedence
+    q := url.Values{}
+    for k, v := range db.Params {
+        q.Set(k, v)
+    }
+
+    params := map[string]string{
+        "sslmode":          db.SSLMode,
+        "sslrootcert":      db.SSLRootCert,
+        "sslcert":          db.SSLCert,
+        "sslkey":           db.SSLKey,
+        "application_name": db.ApplicationName,
+        "search_path":      db.SearchPath,
+    }
+    if db.ConnectTimeout > 0 {
+        // connect_timeout only accept whole second
+        params["connect_timeout"] = strconv.Itoa(int(math.Ceil(db.ConnectTimeout.Seconds())))
+    }
+    for k, v := range params {
+        if v != "" {
+            q.Set(k, v)
+        }
+    }
+    u.RawQuery = q.Encode()
+
+    return u.String()
+}
+
+// ParseConfig will parse the DSN into pgxpool configuration, so any invalid
+// setting (unknown sslmode, missing certificate file, etc) is reported before
+// trying to connect to the database
+func (db DatabaseConfig) ParseConfig() (*pgxpool.Config, error) {
+    cfg, err := pgxpool.ParseConfig(db.DSN())
+    if err != nil {
+        return nil, fmt.Errorf("invalid database configuration: %w", err)
+    }
+
+    // validate minimum server version format
+    if _, err := parseMinServerVersion(db.MinServerVersion); err != nil {
+        return nil, fmt.Errorf("invalid database configuration: %w", err)
+    }
+
+    // validate pool size
+    if db.MaxConns < 0 || db.MinConns < 0 {
+        return nil, errors.New("invalid database configuration: pool size must not be negative")
+    }
+    if db.MaxConns > 0 && db.MinConns > db.MaxConns {
+        return nil, fmt.Errorf("invalid database configuration: min_conns (%d) is greater than max_conns (%d)",
+            db.MinConns, db.MaxConns)
+    }
+
+    // apply pool tuning, keep pgxpool default for zero value
+    if db.MaxConns > 0 {
+        cfg.MaxConns = db.MaxConns
+    }
+    if db.MinConns > 0 {
+        cfg.MinConns = db.MinConns
+    }
+    if db.MaxConnLifetime > 0 {
+        cfg.MaxConnLifetime = db.MaxConnLifetime
+    }
+    if db.MaxConnIdleTime > 0 {
+        cfg.MaxConnIdleTime = db.MaxConnIdleTime
+    }
+    if db.HealthCheckPeriod > 0 {
+        cfg.HealthCheckPeriod = db.HealthCheckPeriod
+    }
+    cfg.AfterConnect = db.AfterConnect
+
+    return cfg, nil
 }
 
 // Datastore is pgxpool.Pool wrapper
 type Datastore struct{
     dbPool *pgxpool.Pool
+    info *ServerInfo
 }
 
 // NewDatastore will create datastore instance
@@ -45,64 +239,122 @@ func (ds Datastore) Pool() *pgxpool.Pool{
     return ds.dbPool
 }
 
-// NewDBPool will create pool connection to database
-func NewDBPool(dbConfig DatabaseConfig) (*pgxpool.Pool, func(), error) {
+// ServerInfo method will get database server information collected while
+// connecting. it is nil if the datastore was not created by NewDBPool
+func (ds Datastore) ServerInfo() *ServerInfo {
+    return ds.info
+}
+
+// NewDBPool will create pool connection to database. if the database is not
+// reachable yet, it will retry based on dbConfig.Retry until the attempts are
+// exhausted or the context is done
+func NewDBPool(ctx context.Context, dbConfig DatabaseConfig) (Datastore, func(), error) {
 
 	f := func() {}
 
+    // parse configuration, return error as is since it is configuration error
+    // and not connection error
+    poolConfig, err := dbConfig.ParseConfig()
+    if err != nil {
+        return Datastore{}, f, err
+    }
+
+    // minimum server version, already validated by ParseConfig
+    minVersion, _ := parseMinServerVersion(dbConfig.MinServerVersion)
+
+    // limit total time for all attempts
+    retry := dbConfig.Retry
+    if retry.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, retry.Timeout)
+        defer cancel()
+    }
+
+    maxAttempts := retry.MaxAttempts
+    if maxAttempts < 1 {
+        maxAttempts = 1
+    }
+
+    for attempt := 1; ; attempt++ {
+        // try to connect and validate the connection
+        ds, err := connectDBPool(ctx, poolConfig, minVersion)
+
+        // return datastore and inline function to close/ clear the pool if not used. 
+        // return nil for the error since there should be no error to this point
+        if err == nil {
+            if attempt > 1 {
+                log.Printf("database connection established after %d attempts\n", attempt)
+            }
+            return ds, func() { ds.dbPool.Close() }, nil
+        }
+
+        // stop retrying if attempts are exhausted or the error will not be
+        // resolved by retrying (wrong credentials, missing database, tls error,
+        // unsupported server version)
+        var connErr *ConnError
+        if attempt >= maxAttempts || !errors.As(err, &connErr) || !connErr.Temporary() {
+            log.Printf("database connection attempt %d/%d failed: %v\n", attempt, maxAttempts, err)
+            return Datastore{}, f, err
+        }
+
+        wait := retry.backoff(attempt)
+        log.Printf("database connection attempt %d/%d failed: %v, retrying in %s\n",
+            attempt, maxAttempts, err, wait.Round(time.Millisecond))
+
+        // wait for next attempt or stop if the context is done
+        timer := time.NewTimer(wait)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return Datastore{}, f, fmt.Errorf("giving up waiting for database (%v): %w", ctx.Err(), err)
+        case <-timer.C:
+        }
+    }
+}
+
+// connectDBPool will create the pool and validate the connection, the pool is
+// closed if the validation fail
+func connectDBPool(ctx context.Context, poolConfig *pgxpool.Config, minVersion serverVersion) (Datastore, error) {
     // create pgx connection pool
-	pool, err := pgxpool.Connect(context.Background(), dbConfig.DSN())
+	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 
-    // return nil to connection and return error if error occur
+    // return empty datastore and return classified error if error occur
 	if err != nil {
-        return nil, f, errors.New("database connection error")
+        return Datastore{}, classifyConnError(err)
 	}
 
-
-    // validateDBPool
-	err = validateDBPool(pool)
-
-    // return nil and error if error occur
+    // validateDBPool, close the pool and return error if error occur
+    info, err := validateDBPool(ctx, pool, minVersion)
 	if err != nil {
-		return nil, f, err
+        pool.Close()
+		return Datastore{}, err
 	}
 
-    // return connection pool and inline function to close/ clear the pool if not used. 
-    // return nil for the error since there should be no error to this point
-	return pool, func() { pool.Close() }, nil
+    return Datastore{dbPool: pool, info: info}, nil
 }
 
-// validateDBPool will pings the database and logs the current user and database
-func validateDBPool(pool *pgxpool.Pool) error {
+// validateDBPool will pings the database, collect the server information and
+// make sure the server version is supported
+func validateDBPool(ctx context.Context, db PgxIface, minVersion serverVersion) (*ServerInfo, error) {
 	// tried to ping connection
-    err := pool.Ping(context.Background())
+    err := db.Ping(ctx)
 
-    // return error if error found
+    // return classified error if error found
 	if err != nil {
-        return errors.New("database connection error")
+        return nil, classifyConnError(err)
 	}
 
-	var (
-		currentDatabase string
-		currentUser     string
-		dbVersion       string
-	)
-	
     // Lets try to get db system info
-    sqlStatement := `select current_database(), current_user, version();`
-	row := pool.QueryRow(context.Background(), sqlStatement)
-	err = row.Scan(&currentDatabase, &currentUser, &dbVersion)
-
-	switch {
-	case err == sql.ErrNoRows:
-		return errors.New("no rows were returned")
-	case err != nil:
-		return errors.New("database connection error")
-	default:
-		log.Printf("database version: %s\n", dbVersion)
-		log.Printf("current database user: %s\n", currentUser)
-		log.Printf("current database: %s\n", currentDatabase)
-	}
+    info, err := FetchServerInfo(ctx, db)
+    if err != nil {
+        return nil, err
+    }
+
+    // refuse unsupported server version
+    if !info.AtLeast(minVersion.major, minVersion.minor) {
+        return nil, fmt.Errorf("%w: server version %s, minimum supported version is %s",
+            ErrUnsupportedVersion, info.Version, minVersion)
+    }
 
-	return nil
+	return info, nil
 }
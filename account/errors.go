@@ -0,0 +1,247 @@
+/*
+    package account
+    errors.go
+    - error definition for account package and helper to classify error
+      returned by pgx/ pgconn into connection error and domain error
+*/
+package account
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"pgxtest/problem"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+    // ErrConnection is generic database connection error, every connection
+    // error returned by NewDBPool will match it using errors.Is
+    ErrConnection = errors.New("database connection error")
+
+    // ErrAuth is returned when the database reject the credentials
+    ErrAuth = errors.New("database authentication failed")
+
+    // ErrUnreachable is returned when the database server can not be reached
+    // (dns failure, connection refused, timeout or server still starting)
+    ErrUnreachable = errors.New("database server unreachable")
+
+    // ErrDatabaseMissing is returned when the requested database does not exist
+    ErrDatabaseMissing = errors.New("database does not exist")
+
+    // ErrTLS is returned when tls negotiation with the database server fail
+    ErrTLS = errors.New("database tls negotiation failed")
+
+    // ErrUnsupportedVersion is returned when the database server version is
+    // older than the configured minimum version
+    ErrUnsupportedVersion = errors.New("unsupported database server version")
+)
+
+// domain error returned by the repository and service layer, the handler map
+// them to the http status code
+var (
+    // ErrNotFound is returned when the requested record does not exist
+    ErrNotFound = errors.New("record not found")
+
+    // ErrConflict is returned when the operation conflict with existing record,
+    // eg duplicate email or record still referenced by other record
+    ErrConflict = errors.New("record conflict")
+
+    // ErrValidation is returned when the input is rejected, either by the
+    // application or by the database constraint
+    ErrValidation = errors.New("validation failed")
+
+    // ErrInvalidCredentials is returned when the email does not exist or the
+    // passkey does not match, the caller can not tell which one is wrong
+    ErrInvalidCredentials = errors.New("invalid email or passkey")
+
+    // ErrForbidden is returned when the caller is not allowed to perform the
+    // operation, eg non admin changing the role
+    ErrForbidden = errors.New("operation not permitted")
+
+    // ErrPreconditionFailed is returned when the record was changed since the
+    // version expected by the caller
+    ErrPreconditionFailed = errors.New("record version mismatch")
+)
+
+// postgres error code (SQLSTATE) used to classify connection error
+const (
+    pgCodeInvalidAuthorization = "28000"
+    pgCodeInvalidPassword      = "28P01"
+    pgCodeInvalidCatalogName   = "3D000"
+    pgCodeCannotConnectNow     = "57P03"
+    pgCodeTooManyConnections   = "53300"
+)
+
+// ValidationError is ErrValidation holding the failing fields, it match
+// ErrValidation using errors.Is
+type ValidationError struct {
+    Fields []problem.FieldError
+}
+
+// Error will return ErrValidation message followed by the field failures
+func (e *ValidationError) Error() string {
+    msg := make([]string, 0, len(e.Fields))
+    for _, f := range e.Fields {
+        msg = append(msg, f.Field+" "+f.Message)
+    }
+    return fmt.Sprintf("%v: %s", ErrValidation, strings.Join(msg, ", "))
+}
+
+// Is will report whether 'target' is ErrValidation
+func (e *ValidationError) Is(target error) bool {
+    return target == ErrValidation
+}
+
+// postgres error code (SQLSTATE) used to classify query error
+const (
+    pgCodeUniqueViolation     = "23505"
+    pgCodeForeignKeyViolation = "23503"
+    pgCodeCheckViolation      = "23514"
+    pgCodeStringTooLong       = "22001"
+)
+
+// ConnError is error while connecting to the database. it match its Kind
+// (and ErrConnection) using errors.Is, while errors.As/ errors.Unwrap will
+// reach the original pgx/ pgconn/ net error
+type ConnError struct {
+    Kind error
+    Err  error
+}
+
+// Error will return the kind of the error followed by the original error
+func (e *ConnError) Error() string {
+    return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Unwrap will return the original error
+func (e *ConnError) Unwrap() error {
+    return e.Err
+}
+
+// Is will report whether 'target' is the kind of this error
+func (e *ConnError) Is(target error) bool {
+    return target == e.Kind || target == ErrConnection
+}
+
+// Temporary will report whether the error may be resolved by retrying
+func (e *ConnError) Temporary() bool {
+    return e.Kind == ErrUnreachable || e.Kind == ErrConnection
+}
+
+// classifyConnError will wrap 'err' into ConnError based on its cause
+func classifyConnError(err error) error {
+    if err == nil {
+        return nil
+    }
+
+    // already classified
+    var connErr *ConnError
+    if errors.As(err, &connErr) {
+        return err
+    }
+
+    return &ConnError{Kind: connErrorKind(err), Err: err}
+}
+
+// connErrorKind will get sentinel error matching the cause of 'err'
+func connErrorKind(err error) error {
+    // error reported by postgres server
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) {
+        switch pgErr.Code {
+        case pgCodeInvalidAuthorization, pgCodeInvalidPassword:
+            return ErrAuth
+        case pgCodeInvalidCatalogName:
+            return ErrDatabaseMissing
+        case pgCodeCannotConnectNow, pgCodeTooManyConnections:
+            return ErrUnreachable
+        }
+        return ErrConnection
+    }
+
+    // tls/ certificate error
+    var (
+        unknownAuthorityErr x509.UnknownAuthorityError
+        hostnameErr         x509.HostnameError
+        certInvalidErr      x509.CertificateInvalidError
+        recordHeaderErr     tls.RecordHeaderError
+    )
+    if errors.As(err, &unknownAuthorityErr) ||
+        errors.As(err, &hostnameErr) ||
+        errors.As(err, &certInvalidErr) ||
+        errors.As(err, &recordHeaderErr) ||
+        strings.Contains(err.Error(), "tls error") ||
+        strings.Contains(err.Error(), "server refused TLS connection") {
+        return ErrTLS
+    }
+
+    // network error (dns, refused, timeout)
+    var (
+        dnsErr *net.DNSError
+        netErr net.Error
+    )
+    if errors.As(err, &dnsErr) ||
+        errors.As(err, &netErr) ||
+        errors.Is(err, context.DeadlineExceeded) ||
+        pgconn.Timeout(err) ||
+        strings.Contains(err.Error(), "hostname resolving error") ||
+        strings.Contains(err.Error(), "dial error") {
+        return ErrUnreachable
+    }
+
+    return ErrConnection
+}
+
+// QueryError is error of database operation classified into domain error. it
+// match its Kind using errors.Is, while errors.As/ errors.Unwrap will reach the
+// original pgx/ pgconn error
+type QueryError struct {
+    Kind error
+    Err  error
+}
+
+// Error will return the kind of the error followed by the original error
+func (e *QueryError) Error() string {
+    return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Unwrap will return the original error
+func (e *QueryError) Unwrap() error {
+    return e.Err
+}
+
+// Is will report whether 'target' is the kind of this error
+func (e *QueryError) Is(target error) bool {
+    return target == e.Kind
+}
+
+// classifyQueryError will wrap 'err' into QueryError if it is caused by missing
+// record or constraint violation, other error is returned as is
+func classifyQueryError(err error) error {
+    if err == nil {
+        return nil
+    }
+
+    if errors.Is(err, pgx.ErrNoRows) {
+        return &QueryError{Kind: ErrNotFound, Err: err}
+    }
+
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) {
+        switch pgErr.Code {
+        case pgCodeUniqueViolation, pgCodeForeignKeyViolation:
+            return &QueryError{Kind: ErrConflict, Err: err}
+        case pgCodeCheckViolation, pgCodeStringTooLong:
+            return &QueryError{Kind: ErrValidation, Err: err}
+        }
+    }
+
+    return err
+}
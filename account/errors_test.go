@@ -0,0 +1,157 @@
+package account
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClassifyConnError will test connection error classification
+func TestClassifyConnError(t *testing.T) {
+    cases := []struct{
+        name      string
+        err       error
+        want      error
+        temporary bool
+    }{
+        {
+            "EXPECT AUTH invalid password",
+            &pgconn.PgError{Code: "28P01", Message: "password authentication failed"},
+            ErrAuth,
+            false,
+        },
+        {
+            "EXPECT AUTH invalid authorization",
+            fmt.Errorf("server error: %w", &pgconn.PgError{Code: "28000"}),
+            ErrAuth,
+            false,
+        },
+        {
+            "EXPECT DATABASE MISSING",
+            &pgconn.PgError{Code: "3D000", Message: "database \"nope\" does not exist"},
+            ErrDatabaseMissing,
+            false,
+        },
+        {
+            "EXPECT UNREACHABLE server starting up",
+            &pgconn.PgError{Code: "57P03"},
+            ErrUnreachable,
+            true,
+        },
+        {
+            "EXPECT UNREACHABLE dns",
+            &net.DNSError{Err: "no such host", Name: "nohost"},
+            ErrUnreachable,
+            true,
+        },
+        {
+            "EXPECT UNREACHABLE connection refused",
+            &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+            ErrUnreachable,
+            true,
+        },
+        {
+            "EXPECT UNREACHABLE deadline",
+            context.DeadlineExceeded,
+            ErrUnreachable,
+            true,
+        },
+        {
+            "EXPECT TLS unknown authority",
+            fmt.Errorf("tls: %w", x509.UnknownAuthorityError{}),
+            ErrTLS,
+            false,
+        },
+        {
+            "EXPECT TLS refused",
+            errors.New("server refused TLS connection"),
+            ErrTLS,
+            false,
+        },
+        {
+            "EXPECT CONNECTION other error",
+            errors.New("something else"),
+            ErrConnection,
+            true,
+        },
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T) {
+            got := classifyConnError(tt.err)
+
+            assert.True(t, errors.Is(got, tt.want))
+            assert.True(t, errors.Is(got, ErrConnection))
+            assert.True(t, errors.Is(got, tt.err))
+            assert.Contains(t, got.Error(), tt.err.Error())
+
+            var connErr *ConnError
+            assert.True(t, errors.As(got, &connErr))
+            assert.Equal(t, tt.temporary, connErr.Temporary())
+        })
+    }
+
+    // EXPECT SUCCESS original pg error still reachable with errors.As
+    t.Run("EXPECT SUCCESS unwrap pg error", func(t *testing.T) {
+        got := classifyConnError(&pgconn.PgError{Code: "28P01"})
+
+        var pgErr *pgconn.PgError
+        assert.True(t, errors.As(got, &pgErr))
+        assert.Equal(t, "28P01", pgErr.Code)
+        assert.False(t, errors.Is(got, ErrUnreachable))
+    })
+
+    // EXPECT SUCCESS already classified error is not wrapped twice
+    t.Run("EXPECT SUCCESS already classified", func(t *testing.T) {
+        err := &ConnError{Kind: ErrAuth, Err: errors.New("denied")}
+
+        assert.Equal(t, err, classifyConnError(err))
+    })
+
+    // EXPECT SUCCESS nil error
+    t.Run("EXPECT SUCCESS nil", func(t *testing.T) {
+        assert.Nil(t, classifyConnError(nil))
+    })
+}
+
+// TestClassifyQueryError will test query error classification into domain error
+func TestClassifyQueryError(t *testing.T) {
+    cases := []struct{
+        name string
+        err  error
+        want error
+    }{
+        {"EXPECT NOT FOUND no rows", pgx.ErrNoRows, ErrNotFound},
+        {"EXPECT CONFLICT unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_un"}, ErrConflict},
+        {"EXPECT CONFLICT foreign key violation", &pgconn.PgError{Code: "23503"}, ErrConflict},
+        {"EXPECT VALIDATION check violation", &pgconn.PgError{Code: "23514"}, ErrValidation},
+        {"EXPECT VALIDATION string too long", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "22001"}), ErrValidation},
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T) {
+            got := classifyQueryError(tt.err)
+
+            assert.True(t, errors.Is(got, tt.want))
+            assert.True(t, errors.Is(got, tt.err))
+
+            var queryErr *QueryError
+            assert.True(t, errors.As(got, &queryErr))
+        })
+    }
+
+    // EXPECT SUCCESS other error is returned as is
+    t.Run("EXPECT SUCCESS unclassified", func(t *testing.T) {
+        err := &pgconn.PgError{Code: "42P01"}
+
+        assert.Equal(t, err, classifyQueryError(err))
+        assert.Nil(t, classifyQueryError(nil))
+    })
+}
@@ -7,11 +7,15 @@
 package account
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
+	"pgxtest/problem"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgconn"
 )
 
 // accountHandler is type wrapper for AccountService interface
@@ -34,28 +38,18 @@ func (h *accountHandler) UserCreateHandler(c *gin.Context) {
 
     // if request data binding error than return 400/ bad request
     if err := c.ShouldBindJSON(&u); err != nil {
-        c.JSON(
-            http.StatusBadRequest, 
-            gin.H{
-                "error": fmt.Sprintf("bad request: %v\n", err),
-            },
-        )
+        errorResponse(c, invalidBody())
 
         // exit process
         return
     }
 
     // send data to service layer to further process (create record)
-    user, err := h.Service.Create(u)
+    user, err := h.Service.Create(c.Request.Context(), u)
 
-    // if error occur while trying to save the data, return 500/ internal server error
+    // if error occur while trying to save the data, response with the mapped error status
     if err != nil {
-        c.AbortWithStatusJSON(
-            http.StatusInternalServerError,
-            gin.H{
-                "error": fmt.Sprintf("internal server error: %v\n", err),
-            },
-        )
+        errorResponse(c, err)
 
         // exit process
         return
@@ -73,49 +67,109 @@ func (h *accountHandler) UserGetHandler(c *gin.Context) {
     id := c.Param("id")
     uid, err := strconv.Atoi(id)
     if err != nil {
-        c.AbortWithStatusJSON(
-            http.StatusBadRequest,
-            gin.H{
-                "error": fmt.Sprintf("bad request: %v\n", err),
-            },
-        )
+        errorResponse(c, invalidID())
         return
     }
 
-    user, err := h.Service.Get(uid)
+    user, err := h.Service.Get(c.Request.Context(), uid)
     if err != nil {
-        c.AbortWithStatusJSON(
-            http.StatusInternalServerError,
-            gin.H{
-                "error": fmt.Sprintf("internal server error: %v\n", err),
-            },
-        )
+        errorResponse(c, err)
+        return
+    }
+
+    // the client already has the current version
+    c.Header("ETag", etag(user.Version))
+    if noneMatch(c.GetHeader("If-None-Match"), user.Version) {
+        c.AbortWithStatus(http.StatusNotModified)
         return
     }
 
     c.JSON(http.StatusOK, user)
 }
 
-// UserGetsHandler is method to process request to get all user data 
+// UserGetsHandler is method to process request to get single page of user
+// data. the page is selected using query parameter limit, cursor, sort,
+// email, name_prefix, created_/ updated_ after/ before and include_deleted
 func (h *accountHandler) UserGetsHandler(c *gin.Context) {
-    users, err := h.Service.Gets()
+    opts := ListOptions{
+        Cursor:     c.Query("cursor"),
+        Sort:       c.Query("sort"),
+        Email:      c.Query("email"),
+        NamePrefix: c.Query("name_prefix"),
+    }
+
+    // every malformed parameter is reported at once
+    v := new(validator)
+    if limit := c.Query("limit"); limit != "" {
+        n, err := strconv.Atoi(limit)
+        if err != nil {
+            v.add("limit", "must be an integer")
+        }
+        opts.Limit = n
+    }
+    if include := c.Query("include_deleted"); include != "" {
+        b, err := strconv.ParseBool(include)
+        if err != nil {
+            v.add("include_deleted", "must be true or false")
+        }
+        opts.IncludeDeleted = b
+    }
+    for _, f := range []struct {
+        name   string
+        target *time.Time
+    }{
+        {"created_after", &opts.CreatedAfter},
+        {"created_before", &opts.CreatedBefore},
+        {"updated_after", &opts.UpdatedAfter},
+        {"updated_before", &opts.UpdatedBefore},
+    } {
+        if value := c.Query(f.name); value != "" {
+            t, err := time.Parse(time.RFC3339, value)
+            if err != nil {
+                v.add(f.name, "must be an RFC 3339 timestamp")
+            }
+            *f.target = t
+        }
+    }
+    if err := v.err(); err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    page, err := h.Service.Gets(c.Request.Context(), opts)
     if err != nil {
-        c.AbortWithStatusJSON(
-            http.StatusInternalServerError,
-            gin.H{
-                "error": fmt.Sprintf("internal server error: %v\n", err),
-            },
-        )
+        errorResponse(c, err)
         return
     }
 
-    // no error occur then send status ok and users data
+    // no error occur then send status ok and the page of users data
     c.JSON(
         http.StatusOK, 
-        users,
+        page,
     )
 }
 
+// UserGetByEmailHandler is method to process request to look up single user
+// by query parameter email, 404 if there is no user with the email in any case
+func (h *accountHandler) UserGetByEmailHandler(c *gin.Context) {
+    email := c.Query("email")
+    if email == "" {
+        errorResponse(c, &ValidationError{Fields: []problem.FieldError{
+            {Field: "email", Message: "is required"},
+        }})
+        return
+    }
+
+    user, err := h.Service.GetByEmail(c.Request.Context(), email)
+    if err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    c.Header("ETag", etag(user.Version))
+    c.JSON(http.StatusOK, user)
+}
+
 // UserUpdateHandler method will process request to update 'User' data and
 // response with the updated data
 func (h *accountHandler) UserUpdateHandler(c *gin.Context) {
@@ -125,12 +179,7 @@ func (h *accountHandler) UserUpdateHandler(c *gin.Context) {
 
     // if error found, respnse with 400(bad request) and exit the process
     if err != nil {
-        c.AbortWithStatusJSON(
-            http.StatusBadRequest,
-            gin.H{
-                "error": fmt.Sprintf("bad request: %v\n", err),
-            },
-        )
+        errorResponse(c, invalidID())
 
         // exit process
         return
@@ -141,40 +190,72 @@ func (h *accountHandler) UserUpdateHandler(c *gin.Context) {
 
     // if request data binding error than return 400/ bad request
     if err := c.ShouldBindJSON(&u); err != nil {
-        c.JSON(
-            http.StatusBadRequest, 
-            gin.H{
-                "error": fmt.Sprintf("bad request: %v\n", err),
-            },
-        )
+        errorResponse(c, invalidBody())
 
         // exit process
         return
     }
 
+    // the version expected by the client is taken from If-Match only
+    if u.Version, err = h.expectedVersion(c, uid); err != nil {
+        errorResponse(c, err)
+        return
+    }
+
     // send data to service layer to further process (update record)
-    user, err := h.Service.Update(uid, u)
+    user, err := h.Service.Update(c.Request.Context(), uid, u)
 
-    // if error occur while trying to save the data, return 500/ internal server error
+    // if error occur while trying to save the data, response with the mapped error status
     if err != nil {
-        c.AbortWithStatusJSON(
-            http.StatusInternalServerError,
-            gin.H{
-                "error": fmt.Sprintf("internal server error: %v\n", err),
-            },
-        )
+        errorResponse(c, err)
 
         // exit process
         return
     }
 
     //  if no error found, send 200/ status ok as well as the 'UserResponse' data
+    c.Header("ETag", etag(user.Version))
     c.JSON(
         http.StatusOK,
         user,
     )
 }
 
+// UserPatchHandler method will process JSON Merge Patch request to partially
+// update 'User' data and response with the updated data
+func (h *accountHandler) UserPatchHandler(c *gin.Context) {
+    uid, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        errorResponse(c, invalidID())
+        return
+    }
+
+    // unknown or removed required member is responded with its field error,
+    // other decoding error with the generic body error
+    var p UserPatch
+    if err := c.ShouldBindJSON(&p); err != nil {
+        if !errors.Is(err, ErrValidation) {
+            err = invalidBody()
+        }
+        errorResponse(c, err)
+        return
+    }
+
+    if p.Version, err = h.expectedVersion(c, uid); err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    user, err := h.Service.Patch(c.Request.Context(), uid, p)
+    if err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    c.Header("ETag", etag(user.Version))
+    c.JSON(http.StatusOK, user)
+}
+
 // UserDeleteHandler method will process request to delete 'User' data and
 // response with the updated data
 func (h *accountHandler) UserDeleteHandler(c *gin.Context) {
@@ -184,28 +265,25 @@ func (h *accountHandler) UserDeleteHandler(c *gin.Context) {
 
     // if error found, respnse with 400(bad request) and exit the process
     if err != nil {
-        c.AbortWithStatusJSON(
-            http.StatusBadRequest,
-            gin.H{
-                "error": fmt.Sprintf("bad request: %v\n", err),
-            },
-        )
+        errorResponse(c, invalidID())
 
         // exit process
         return
     }
 
+    // the version expected by the client, zero if If-Match is not given
+    version, err := h.expectedVersion(c, uid)
+    if err != nil {
+        errorResponse(c, err)
+        return
+    }
+
     // send data to service layer to further process (delete record)
-    user, err := h.Service.Delete(uid)
+    user, err := h.Service.Delete(c.Request.Context(), uid, version)
 
-    // if error occur while trying to save the data, return 500/ internal server error
+    // if error occur while trying to save the data, response with the mapped error status
     if err != nil {
-        c.AbortWithStatusJSON(
-            http.StatusInternalServerError,
-            gin.H{
-                "error": fmt.Sprintf("internal server error: %v\n", err),
-            },
-        )
+        errorResponse(c, err)
 
         // exit process
         return
@@ -217,3 +295,199 @@ func (h *accountHandler) UserDeleteHandler(c *gin.Context) {
         user,
     )
 }
+
+// UserRestoreHandler method will process request to undo soft delete of
+// 'User' data and response with the restored data
+func (h *accountHandler) UserRestoreHandler(c *gin.Context) {
+    uid, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        errorResponse(c, invalidID())
+        return
+    }
+
+    // the version expected by the client, zero if If-Match is not given
+    version, err := h.expectedVersion(c, uid)
+    if err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    user, err := h.Service.Restore(c.Request.Context(), uid, version)
+    if err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    c.Header("ETag", etag(user.Version))
+    c.JSON(http.StatusOK, user)
+}
+
+// UserHistoryHandler method will process request to get single page of audit
+// entries of 'User', the page is selected using query parameter limit and cursor
+func (h *accountHandler) UserHistoryHandler(c *gin.Context) {
+    uid, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        errorResponse(c, invalidID())
+        return
+    }
+
+    opts := HistoryOptions{Cursor: c.Query("cursor")}
+    if limit := c.Query("limit"); limit != "" {
+        if opts.Limit, err = strconv.Atoi(limit); err != nil {
+            errorResponse(c, &ValidationError{Fields: []problem.FieldError{
+                {Field: "limit", Message: "must be an integer"},
+            }})
+            return
+        }
+    }
+
+    page, err := h.Service.History(c.Request.Context(), uid, opts)
+    if err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, page)
+}
+
+// etag will get entity tag of user 'version'
+func etag(version int) string {
+    return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseETag will get user version of entity tag 'tag', weak tag is accepted
+func parseETag(tag string) (int, bool) {
+    tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+    if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+        return 0, false
+    }
+    version, err := strconv.Atoi(tag[1 : len(tag)-1])
+    if err != nil || version < 1 {
+        return 0, false
+    }
+
+    return version, true
+}
+
+// ifMatch will get versions listed by If-Match 'header', nil if the header
+// is empty or "*". If-Match use strong comparison so weak tag never match,
+// header without any strong tag of user version get ErrPreconditionFailed
+func ifMatch(header string) ([]int, error) {
+    header = strings.TrimSpace(header)
+    if header == "" || header == "*" {
+        return nil, nil
+    }
+
+    var versions []int
+    for _, tag := range strings.Split(header, ",") {
+        if strings.HasPrefix(strings.TrimSpace(tag), "W/") {
+            continue
+        }
+        if v, ok := parseETag(tag); ok {
+            versions = append(versions, v)
+        }
+    }
+    if len(versions) == 0 {
+        return nil, ErrPreconditionFailed
+    }
+
+    return versions, nil
+}
+
+// expectedVersion will get version of user 'id' expected by If-Match of the
+// request, zero if any version is accepted. when several versions are listed
+// the current version is looked up and used if it is listed, so the
+// operation is still conditional on the version
+func (h *accountHandler) expectedVersion(c *gin.Context, id int) (int, error) {
+    versions, err := ifMatch(c.GetHeader("If-Match"))
+    if err != nil || len(versions) == 0 {
+        return 0, err
+    }
+    if len(versions) == 1 {
+        return versions[0], nil
+    }
+
+    current, err := h.Service.Version(c.Request.Context(), id)
+    if err != nil {
+        return 0, err
+    }
+    for _, v := range versions {
+        if v == current {
+            return v, nil
+        }
+    }
+
+    return 0, ErrPreconditionFailed
+}
+
+// noneMatch will report whether If-None-Match 'header' match user 'version',
+// the header may list several entity tags
+func noneMatch(header string, version int) bool {
+    if strings.TrimSpace(header) == "*" {
+        return true
+    }
+    for _, tag := range strings.Split(header, ",") {
+        if v, ok := parseETag(tag); ok && v == version {
+            return true
+        }
+    }
+
+    return false
+}
+
+// invalidID will get validation error of non integer 'id' path parameter
+func invalidID() error {
+    return &ValidationError{Fields: []problem.FieldError{
+        {Field: "id", Message: "must be an integer"},
+    }}
+}
+
+// invalidBody will get validation error of request body that can not be
+// decoded into 'User'
+func invalidBody() error {
+    return &ValidationError{Fields: []problem.FieldError{
+        {Field: "body", Message: "must be a valid json user object"},
+    }}
+}
+
+// FieldErrors will get field-level failures of 'err', either from
+// ValidationError or from the violated database constraint. too long value
+// has no field error, postgres does not report the column of 22001 and the
+// validator already check every column length
+func FieldErrors(err error) []problem.FieldError {
+    var vErr *ValidationError
+    if errors.As(err, &vErr) {
+        return vErr.Fields
+    }
+
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) {
+        if pgErr.ConstraintName == "users_email_un" || pgErr.ConstraintName == "users_email_lower_un" {
+            return []problem.FieldError{{Field: "email", Message: "is already used"}}
+        }
+    }
+
+    return nil
+}
+
+// ErrorMapper map error returned by the account service to problem details,
+// it is shared by every handler using the account service (eg auth) so the
+// same error always get the same status code. conflict is logged as well
+var ErrorMapper = problem.Mapper{
+    Mappings: []problem.Mapping{
+        {Err: ErrValidation, Status: http.StatusBadRequest, Detail: "the request is invalid"},
+        {Err: ErrInvalidCredentials, Status: http.StatusUnauthorized, Detail: "the credentials or token is invalid"},
+        {Err: ErrForbidden, Status: http.StatusForbidden, Detail: "the operation is not permitted for the caller"},
+        {Err: ErrNotFound, Status: http.StatusNotFound, Detail: "the user does not exist"},
+        {Err: ErrConflict, Status: http.StatusConflict, Detail: "the user conflict with existing user"},
+        {Err: ErrPreconditionFailed, Status: http.StatusPreconditionFailed, Detail: "the user was modified since the version given by If-Match"},
+    },
+    Fields: FieldErrors,
+    Logged: []int{http.StatusConflict},
+}
+
+// errorResponse will abort the request and response with problem details
+// matching 'err', eg 404 for ErrNotFound or 409 for ErrConflict
+func errorResponse(c *gin.Context, err error) {
+    ErrorMapper.Respond(c, err)
+}
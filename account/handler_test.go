@@ -7,13 +7,20 @@ package account
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"pgxtest/problem"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,9 +30,9 @@ type mockAccService struct {
 
 var (
     users = []*User{
-        {ID: 1, Firstname:"joe",Lastname:"taslim",Email:"joe@taslim.com",PassKey:"secret"},
-        {ID: 2, Firstname:"john",Lastname:"doe",Email:"john@doe.com",PassKey:"secret"},
-        {ID: 3, Firstname:"janne",Lastname:"doe",Email:"janne@doe.com",PassKey:"secret"},
+        {ID: 1, Firstname:"joe",Lastname:"taslim",Email:"joe@taslim.com",PassKey:"secret",Version:1},
+        {ID: 2, Firstname:"john",Lastname:"doe",Email:"john@doe.com",PassKey:"secret",Version:1},
+        {ID: 3, Firstname:"janne",Lastname:"doe",Email:"janne@doe.com",PassKey:"secret",Version:1},
     }
     wantError bool
 )
@@ -45,7 +52,7 @@ func NewMockAccService(t *testing.T) *mockAccService{
 
 // Create method is 'mock' to satisfy 'Create' method for AccountService interface
 // its act as the 'double' or as a 'counterfeiter' for AccountService.Create
-func (m *mockAccService) Create(user User) (*UserResponse, error) {
+func (m *mockAccService) Create(ctx context.Context, user User) (*UserResponse, error) {
     if user.ID == 0 || user.Firstname == "" || user.Email=="" || user.PassKey=="" {
         return nil, errors.New("user invalid")
     }
@@ -54,47 +61,155 @@ func (m *mockAccService) Create(user User) (*UserResponse, error) {
 
 // Get method is 'mock' to satisfy 'Get' method for AccountService interface
 // its act as the 'double' or as a 'counterfeiter' for AccountService.Get
-func (m *mockAccService) Get(id int) (*UserResponse, error) {
+func (m *mockAccService) Get(ctx context.Context, id int) (*UserResponse, error) {
     if len(users) < id {
-        return nil, errors.New("data not found")
+        return nil, ErrNotFound
     }
     return UserToUserResponse(*users[id-1]), nil
 }
 
+// GetByEmail method is 'mock' to satisfy 'GetByEmail' method for AccountService interface
+// its act as the 'double' or as a 'counterfeiter' for AccountService.GetByEmail
+func (m *mockAccService) GetByEmail(ctx context.Context, email string) (*UserResponse, error) {
+    for _, u := range users {
+        if strings.EqualFold(u.Email, email) {
+            return UserToUserResponse(*u), nil
+        }
+    }
+    return nil, ErrNotFound
+}
+
 // Gets method is 'mock' to satisfy 'Gets' method for AccountService interface
 // its act as the 'double' or as a 'counterfeiter' for AccountService.Gets
-func (m *mockAccService) Gets() ([]*UserResponse, error) {
+func (m *mockAccService) Gets(ctx context.Context, opts ListOptions) (*UserPage, error) {
     // to generate/ force error return on test
     if wantError {
         return nil, errors.New("error found")
     }
 
+    // validate the options as the repository does
+    if _, err := opts.query(); err != nil {
+        return nil, err
+    }
+
+    // filter by email as the repository does
+    if opts.Email != "" {
+        var filtered []*UserResponse
+        for _, u := range usersResponse() {
+            if strings.EqualFold(u.Email, opts.Email) {
+                filtered = append(filtered, u)
+            }
+        }
+        return &UserPage{Users: filtered}, nil
+    }
+
     // normal succes return
-    return usersResponse(), nil 
+    return &UserPage{Users: usersResponse()}, nil 
 }
 
 // Update method is 'mock' to satisfy 'Update' method for AccountService interface
 // its act as the 'double' or as a 'counterfeiter' for AccountService.Update
-func (m *mockAccService) Update(id int, user User) (*UserResponse, error) {
+func (m *mockAccService) Update(ctx context.Context, id int, user User) (*UserResponse, error) {
     if len(users) < id {
-        return nil, errors.New("data not found")
+        return nil, ErrNotFound
     }
-    if user.ID == 0 || user.Firstname == "" || user.Email=="" || user.PassKey=="" {
-        return nil, errors.New("user invalid")
+    if (user.ID != 0 && user.ID != id) || user.Firstname == "" || user.Email=="" || user.PassKey=="" {
+        return nil, fmt.Errorf("%w: user invalid", ErrValidation)
+    }
+    if user.Version != 0 && user.Version != users[id-1].Version {
+        return nil, ErrPreconditionFailed
     }
 
+    user.Version = users[id-1].Version + 1
     return UserToUserResponse(user), nil
 }
 
+// Patch method is 'mock' to satisfy 'Patch' method for AccountService interface
+// its act as the 'double' or as a 'counterfeiter' for AccountService.Patch
+func (m *mockAccService) Patch(ctx context.Context, id int, patch UserPatch) (*UserResponse, error) {
+    if len(users) < id {
+        return nil, ErrNotFound
+    }
+    if err := patch.IsValid(); err != nil {
+        return nil, err
+    }
+
+    u := *users[id-1]
+    if patch.Lastname != nil {
+        u.Lastname = *patch.Lastname
+    }
+    return UserToUserResponse(u), nil
+}
+
 // Delete method is 'mock' to satisfy 'Delete' method for AccountService interface
 // its act as the 'double' or as a 'counterfeiter' for AccountService.Delete
-func (m *mockAccService) Delete(id int) (*UserResponse, error) {
+func (m *mockAccService) Delete(ctx context.Context, id, version int) (*UserResponse, error) {
     if len(users) < id {
-        return nil, errors.New("data not found")
+        return nil, ErrNotFound
+    }
+    if version != 0 && version != users[id-1].Version {
+        return nil, ErrPreconditionFailed
     }
     return UserToUserResponse(*users[id-1]), nil
 }
 
+// Restore method is 'mock' to satisfy 'Restore' method for AccountService interface
+// its act as the 'double' or as a 'counterfeiter' for AccountService.Restore
+func (m *mockAccService) Restore(ctx context.Context, id, version int) (*UserResponse, error) {
+    if len(users) < id {
+        return nil, ErrNotFound
+    }
+    if version != 0 && version != users[id-1].Version {
+        return nil, ErrPreconditionFailed
+    }
+
+    u := *users[id-1]
+    u.Version++
+    return UserToUserResponse(u), nil
+}
+
+// Version method is 'mock' to satisfy 'Version' method for AccountService interface
+// its act as the 'double' or as a 'counterfeiter' for AccountService.Version
+func (m *mockAccService) Version(ctx context.Context, id int) (int, error) {
+    if len(users) < id {
+        return 0, ErrNotFound
+    }
+    return users[id-1].Version, nil
+}
+
+// Purge method is 'mock' to satisfy 'Purge' method for AccountService interface
+// its act as the 'double' or as a 'counterfeiter' for AccountService.Purge
+func (m *mockAccService) Purge(ctx context.Context, before time.Time) (int64, error) {
+    return 0, nil
+}
+
+// History method is 'mock' to satisfy 'History' method for AccountService interface
+// its act as the 'double' or as a 'counterfeiter' for AccountService.History
+func (m *mockAccService) History(ctx context.Context, id int, opts HistoryOptions) (*AuditPage, error) {
+    // validate the options as the repository does
+    if _, _, err := opts.query(); err != nil {
+        return nil, err
+    }
+    if len(users) < id {
+        return nil, ErrNotFound
+    }
+
+    return &AuditPage{Entries: []*AuditEntry{
+        {ID: 1, UserID: id, Action: ActionCreate, Changes: diffUsers(nil, users[id-1])},
+    }}, nil
+}
+
+// Authenticate method is 'mock' to satisfy 'Authenticate' method for AccountService interface
+// its act as the 'double' or as a 'counterfeiter' for AccountService.Authenticate
+func (m *mockAccService) Authenticate(ctx context.Context, email, passkey string) (*UserResponse, error) {
+    for _, u := range users {
+        if u.Email == email && u.PassKey == passkey {
+            return UserToUserResponse(*u), nil
+        }
+    }
+    return nil, ErrInvalidCredentials
+}
+
 // NewTestHandler is to prepare needed instance before the test executed
 func NewTestHandler(t *testing.T) (accountHandler) {
     t.Helper()
@@ -111,6 +226,10 @@ func NewTestRecordWriter() (*httptest.ResponseRecorder, *gin.Context) {
     writer := httptest.NewRecorder()
     context, _ := gin.CreateTestContext(writer)
 
+    // default request so the handler can get the request context, the test
+    // may replace it with its own request
+    context.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
     return writer, context
 }
 
@@ -216,6 +335,31 @@ func TestUserGetHandler(t *testing.T) {
 
         // make sure expected body value match with the actual/ response body value
         assert.Equal(t, want, writer.Body.Bytes())
+        assert.Equal(t, `"1"`, writer.Header().Get("ETag"))
+    })
+
+    // EXPECT SUCCESS not modified
+    // should return 304/ not modified without body when If-None-Match list
+    // the current version
+    t.Run("EXPECT SUCCESS not modified", func(t *testing.T){
+        for header, code := range map[string]int{
+            `"1"`: http.StatusNotModified,
+            `W/"3", "1"`: http.StatusNotModified,
+            `*`: http.StatusNotModified,
+            `"2"`: http.StatusOK,
+        } {
+            writer, context := NewTestRecordWriter()
+            context.Params = gin.Params{{Key:"id", Value:"1"}}
+            context.Request.Header.Set("If-None-Match", header)
+
+            handler.UserGetHandler(context)
+
+            assert.Equal(t, code, writer.Code, header)
+            assert.Equal(t, `"1"`, writer.Header().Get("ETag"), header)
+            if code == http.StatusNotModified {
+                assert.Empty(t, writer.Body.String(), header)
+            }
+        }
     })
 
     // EXPECT FAIL param error
@@ -233,8 +377,7 @@ func TestUserGetHandler(t *testing.T) {
     })
 
     // EXPECT FAIL error get data (out of range index on users)
-    // should return 500/ internal server error 
-    // since it expecting fail, no need to assert the body
+    // should return 404/ not found
     t.Run("EXPECT FAIL service get error", func(t *testing.T){
         writer, context := NewTestRecordWriter()
         context.Params = gin.Params{
@@ -243,10 +386,45 @@ func TestUserGetHandler(t *testing.T) {
         handler.UserGetHandler(context)
 
         // make sure expected body value match with the actual/ response body value
-        assert.Equal(t, http.StatusInternalServerError, writer.Code)
+        assert.Equal(t, http.StatusNotFound, writer.Code)
+        assert.Contains(t, writer.Body.String(), "Not Found")
     })
 } 
 
+// TestUserGetByEmailHandler is for testing UserGetByEmailHandler behaviour
+func TestUserGetByEmailHandler(t *testing.T) {
+    handler := NewTestHandler(t)
+
+    // EXPECT SUCCESS the email case is ignored
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        writer, context := NewTestRecordWriter()
+        context.Request = httptest.NewRequest(http.MethodGet, "/v1/account/by-email?email=John@Doe.com", nil)
+
+        handler.UserGetByEmailHandler(context)
+
+        assert.Equal(t, http.StatusOK, writer.Code)
+        want, err := json.Marshal(UserToUserResponse(*users[1]))
+        assert.NoError(t, err)
+        assert.Equal(t, want, writer.Body.Bytes())
+    })
+
+    // EXPECT FAIL unknown email is 404 and missing email is 400
+    t.Run("EXPECT FAIL", func(t *testing.T){
+        for query, code := range map[string]int{
+            "email=nobody@doe.com": http.StatusNotFound,
+            "email=": http.StatusBadRequest,
+            "": http.StatusBadRequest,
+        } {
+            writer, context := NewTestRecordWriter()
+            context.Request = httptest.NewRequest(http.MethodGet, "/v1/account/by-email?"+query, nil)
+
+            handler.UserGetByEmailHandler(context)
+
+            assert.Equal(t, code, writer.Code, query)
+        }
+    })
+}
+
 // TestUserGetsHandler is for testing UserGetsHandler behaviour
 func TestUserGetsHandler(t *testing.T) {
     // prepare test
@@ -266,13 +444,48 @@ func TestUserGetsHandler(t *testing.T) {
 
         // marshal expected value using expected data 
         // to compare with the actual/ response body
-        want, err := json.Marshal(usersResponse())
+        want, err := json.Marshal(UserPage{Users: usersResponse()})
         assert.NoError(t, err)
 
         // make sure expected body value match with the actual/ response body value
         assert.Equal(t, want, writer.Body.Bytes())
     })
 
+    // EXPECT SUCCESS email filter, the response is still the page
+    t.Run("EXPECT SUCCESS email filter", func(t *testing.T){
+        writer, context := NewTestRecordWriter()
+        context.Request = httptest.NewRequest(http.MethodGet, "/v1/account/?email=John@Doe.com", nil)
+
+        handler.UserGetsHandler(context)
+
+        assert.Equal(t, http.StatusOK, writer.Code)
+        want, err := json.Marshal(UserPage{Users: []*UserResponse{UserToUserResponse(*users[1])}})
+        assert.NoError(t, err)
+        assert.Equal(t, want, writer.Body.Bytes())
+    })
+
+    // EXPECT FAIL invalid query parameter
+    // should return 400/ bad request listing the invalid parameter
+    t.Run("EXPECT FAIL invalid query parameter", func(t *testing.T){
+        for query, field := range map[string]string{
+            "limit=abc": "limit",
+            "limit=500": "limit",
+            "sort=passkey": "sort",
+            "cursor=abc": "cursor",
+            "include_deleted=maybe": "include_deleted",
+            "created_after=yesterday": "created_after",
+            "updated_before=2022-01-02": "updated_before",
+        } {
+            writer, context := NewTestRecordWriter()
+            context.Request = httptest.NewRequest(http.MethodGet, "/v1/account/?"+query, nil)
+
+            handler.UserGetsHandler(context)
+
+            assert.Equal(t, http.StatusBadRequest, writer.Code, query)
+            assert.Contains(t, writer.Body.String(), `"field":"`+field+`"`, query)
+        }
+    })
+
     // EXPECT FAIL error get data (empty users)
     // should return 500/ internal server error 
     // since it expecting fail, no need to assert the body
@@ -332,6 +545,29 @@ func TestUserUpdateHandler(t *testing.T) {
         // make sure the expected status code (200/ status ok) match with the
         // response status code
         assert.Equal(t, http.StatusOK, writer.Code)
+        assert.Equal(t, `"2"`, writer.Header().Get("ETag"))
+    })
+
+    // EXPECT FAIL version mismatch, return http status 412/ precondition failed
+    t.Run("EXPECT FAIL If-Match mismatch", func(t *testing.T){
+        for _, header := range []string{`"2"`, `"abc"`, `"2", "3"`, `W/"1"`} {
+            writer, context := NewTestRecordWriter()
+            context.Params = gin.Params{{Key:"id", Value:"1"}}
+
+            userJSON, err := json.Marshal(User{
+                ID : 1,
+                Firstname : "zhao",
+                Email : "zhao@lucy.com",
+                PassKey : "lucysecret",
+            })
+            assert.NoError(t, err)
+            context.Request = httptest.NewRequest(http.MethodPut, "/", bytes.NewBuffer(userJSON))
+            context.Request.Header.Set("If-Match", header)
+
+            handler.UserUpdateHandler(context)
+
+            assert.Equal(t, http.StatusPreconditionFailed, writer.Code, header)
+        }
     })
 
     // EXPECT FAIL bad param, return http status 400/ bad request
@@ -390,9 +626,9 @@ func TestUserUpdateHandler(t *testing.T) {
         assert.Equal(t, http.StatusBadRequest, writer.Code)
     })
 
-    // EXPECT FAIL error update data, return http status 500/ internal server error
+    // EXPECT FAIL error update data, return http status 400/ bad request
     // we'll simulate it by removing 1 of required field, so it will still pass 
-    // json binding
+    // json binding but rejected by the service validation
     t.Run("EXPECT FAIL error update data", func(t *testing.T){
         // prepare response/ writer/ context
         writer, context := NewTestRecordWriter()
@@ -414,7 +650,7 @@ func TestUserUpdateHandler(t *testing.T) {
         assert.NoError(t, err)
 
         // inject invalid data to the request body to simulate how
-        // we can get the internal server error
+        // we can get the validation error
         context.Request, _ = http.NewRequest("PUT", "/", bytes.NewBuffer(userJSON))
 
         // make sure to add aplication/json as it content type
@@ -423,9 +659,72 @@ func TestUserUpdateHandler(t *testing.T) {
         // actual method executed
         handler.UserUpdateHandler(context)
 
-        // make sure the expected status code (500/ status interna; server error) 
+        // make sure the expected status code (400/ bad request)
         // match with the response status code
-        assert.Equal(t, http.StatusInternalServerError, writer.Code)
+        assert.Equal(t, http.StatusBadRequest, writer.Code)
+    })
+}
+
+// TestUserPatchHandler will test UserPatchHandler behaviour
+func TestUserPatchHandler(t *testing.T) {
+    // prepare test 
+    handler := NewTestHandler(t)
+
+    // newPatchRequest will prepare request context patching user 'id' with 'body'
+    newPatchRequest := func(id, body string) (*httptest.ResponseRecorder, *gin.Context) {
+        writer, context := NewTestRecordWriter()
+        context.Params = gin.Params{{Key: "id", Value: id}}
+        context.Request = httptest.NewRequest(http.MethodPatch, "/", bytes.NewBufferString(body))
+        context.Request.Header.Add("content-type", "application/merge-patch+json")
+        return writer, context
+    }
+
+    // EXPECT SUCCESS, only the last name is changed
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        writer, context := newPatchRequest("1", `{"lastname":"lucy"}`)
+
+        handler.UserPatchHandler(context)
+
+        assert.Equal(t, http.StatusOK, writer.Code)
+        assert.Contains(t, writer.Body.String(), `"last_name":"lucy"`)
+        assert.Contains(t, writer.Body.String(), `"first_name":"`+users[0].Firstname+`"`)
+    })
+
+    // EXPECT FAIL invalid patch, return http status 400/ bad request with the field
+    t.Run("EXPECT FAIL invalid patch", func(t *testing.T){
+        cases := map[string]string{
+            `{"email":null}`:   "email",
+            `{"firstname":""}`: "firstname",
+            `{"id":2}`:         "id",
+            `{"role":1}`:       "role",
+            `[]`:               "body",
+        }
+        for body, field := range cases {
+            writer, context := newPatchRequest("1", body)
+
+            handler.UserPatchHandler(context)
+
+            assert.Equal(t, http.StatusBadRequest, writer.Code, body)
+            assert.Contains(t, writer.Body.String(), `"field":"`+field+`"`, body)
+        }
+    })
+
+    // EXPECT FAIL bad param id, return http status 400/ bad request
+    t.Run("EXPECT FAIL error param id", func(t *testing.T){
+        writer, context := newPatchRequest("abc", `{"lastname":"lucy"}`)
+
+        handler.UserPatchHandler(context)
+
+        assert.Equal(t, http.StatusBadRequest, writer.Code)
+    })
+
+    // EXPECT FAIL user not found, return http status 404/ not found
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        writer, context := newPatchRequest("100", `{"lastname":"lucy"}`)
+
+        handler.UserPatchHandler(context)
+
+        assert.Equal(t, http.StatusNotFound, writer.Code)
     })
 }
 
@@ -466,6 +765,18 @@ func TestUserDeleteHandler(t *testing.T) {
         assert.Equal(t, want, writer.Body.Bytes())
     })
 
+    // EXPECT FAIL version mismatch, return http status 412/ precondition failed
+    t.Run("EXPECT FAIL If-Match mismatch", func(t *testing.T){
+        writer, context := NewTestRecordWriter()
+        context.Params = gin.Params{{Key: "id", Value:"1"}}
+        context.Request = httptest.NewRequest(http.MethodDelete, "/", nil)
+        context.Request.Header.Set("If-Match", `"5"`)
+
+        handler.UserDeleteHandler(context)
+
+        assert.Equal(t, http.StatusPreconditionFailed, writer.Code)
+    })
+
     // EXPECT FAIL error param id, will return 400/ status bad request
     // we simulate this by sending empty param id
     t.Run("EXPECT FAIL error param id", func(t *testing.T){
@@ -484,14 +795,14 @@ func TestUserDeleteHandler(t *testing.T) {
         assert.Equal(t, http.StatusBadRequest, writer.Code)
     })
 
-    // EXPECT FAIL error data not found, will return 500/ status internal server error
+    // EXPECT FAIL error data not found, will return 404/ status not found
     // we simulate this by sending param id that not available on users data slice
     t.Run("EXPECT FAIL data not found", func(t *testing.T){
         // prepare request/ writer/ context 
         writer, context := NewTestRecordWriter()
 
         // prepare request param id. we will simulate to delete 
-        // user id with id = 7 to get internal server error
+        // user id with id = 7 to get not found error
         context.Params = gin.Params{
             {Key: "id", Value:"7"},
         }
@@ -503,8 +814,211 @@ func TestUserDeleteHandler(t *testing.T) {
         // actual method executed to test it behaviour
         handler.UserDeleteHandler(context)
 
-        // make sure the expected status code (500/ internal server error)
+        // make sure the expected status code (404/ not found)
         // are match with the response code
-        assert.Equal(t, http.StatusInternalServerError, writer.Code)
+        assert.Equal(t, http.StatusNotFound, writer.Code)
+    })
+}
+
+// TestUserRestoreHandler is routine for testing UserRestoreHandler
+func TestUserRestoreHandler(t *testing.T) {
+    handler := NewTestHandler(t)
+
+    // EXPECT SUCCESS will return 200/ status ok with the restored user
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        writer, context := NewTestRecordWriter()
+        context.Params = gin.Params{{Key: "id", Value: "1"}}
+        context.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+        context.Request.Header.Set("If-Match", `"1"`)
+
+        handler.UserRestoreHandler(context)
+
+        assert.Equal(t, http.StatusOK, writer.Code)
+        assert.Equal(t, `"2"`, writer.Header().Get("ETag"))
+    })
+
+    // EXPECT SUCCESS If-Match listing the current version among others
+    t.Run("EXPECT SUCCESS version list", func(t *testing.T){
+        writer, context := NewTestRecordWriter()
+        context.Params = gin.Params{{Key: "id", Value: "1"}}
+        context.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+        context.Request.Header.Set("If-Match", `"3", W/"2", "1"`)
+
+        handler.UserRestoreHandler(context)
+
+        assert.Equal(t, http.StatusOK, writer.Code)
+        assert.Equal(t, `"2"`, writer.Header().Get("ETag"))
+    })
+
+    // EXPECT FAIL will return the mapped error status
+    t.Run("EXPECT FAIL", func(t *testing.T){
+        for _, tt := range []struct {
+            id      string
+            ifMatch string
+            want    int
+        }{
+            {"abc", "", http.StatusBadRequest},
+            {"7", "", http.StatusNotFound},
+            {"1", `"5"`, http.StatusPreconditionFailed},
+            {"1", `W/"1"`, http.StatusPreconditionFailed},
+            {"1", `"4", "5"`, http.StatusPreconditionFailed},
+            {"7", `"1", "2"`, http.StatusNotFound},
+        } {
+            writer, context := NewTestRecordWriter()
+            context.Params = gin.Params{{Key: "id", Value: tt.id}}
+            context.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+            context.Request.Header.Set("If-Match", tt.ifMatch)
+
+            handler.UserRestoreHandler(context)
+
+            assert.Equal(t, tt.want, writer.Code, tt.id)
+        }
+    })
+}
+
+// TestUserHistoryHandler is routine for testing UserHistoryHandler
+func TestUserHistoryHandler(t *testing.T) {
+    handler := NewTestHandler(t)
+
+    // EXPECT SUCCESS will return 200/ status ok with the audit entries, the
+    // passkey is redacted
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        writer, context := NewTestRecordWriter()
+        context.Params = gin.Params{{Key: "id", Value: "1"}}
+        context.Request = httptest.NewRequest(http.MethodGet, "/?limit=10", nil)
+
+        handler.UserHistoryHandler(context)
+
+        assert.Equal(t, http.StatusOK, writer.Code)
+        assert.Contains(t, writer.Body.String(), `"action":"create"`)
+        assert.Contains(t, writer.Body.String(), `"passkey":{"before":null,"after":"[redacted]"}`)
+        assert.NotContains(t, writer.Body.String(), users[0].PassKey)
+    })
+
+    // EXPECT FAIL unknown user will return 404/ not found like other /:id route
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        writer, context := NewTestRecordWriter()
+        context.Params = gin.Params{{Key: "id", Value: "7"}}
+        context.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+        handler.UserHistoryHandler(context)
+
+        assert.Equal(t, http.StatusNotFound, writer.Code)
+    })
+
+    // EXPECT FAIL invalid parameter will return 400/ bad request
+    t.Run("EXPECT FAIL invalid parameter", func(t *testing.T){
+        for _, tt := range []struct {
+            id    string
+            query string
+            field string
+        }{
+            {"abc", "", "id"},
+            {"1", "limit=abc", "limit"},
+            {"1", "limit=500", "limit"},
+            {"1", "cursor=abc", "cursor"},
+        } {
+            writer, context := NewTestRecordWriter()
+            context.Params = gin.Params{{Key: "id", Value: tt.id}}
+            context.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+
+            handler.UserHistoryHandler(context)
+
+            assert.Equal(t, http.StatusBadRequest, writer.Code, tt.query)
+            assert.Contains(t, writer.Body.String(), `"field":"`+tt.field+`"`, tt.query)
+        }
+    })
+}
+
+// TestETag will test parsing entity tag of If-Match and If-None-Match
+func TestETag(t *testing.T) {
+    assert.Equal(t, `"7"`, etag(7))
+
+    for header, want := range map[string][]int{"": nil, "*": nil, `"7"`: {7}, `"6", W/"7", "8"`: {6, 8}} {
+        versions, err := ifMatch(header)
+        assert.NoError(t, err, header)
+        assert.Equal(t, want, versions, header)
+    }
+    // weak tag never match If-Match
+    for _, header := range []string{`7`, `"0"`, `"-1"`, `W/"7"`, `W/"7", W/"8"`} {
+        _, err := ifMatch(header)
+        assert.ErrorIs(t, err, ErrPreconditionFailed, header)
+    }
+
+    assert.True(t, noneMatch(`"6", W/"7"`, 7))
+    assert.False(t, noneMatch(`"6"`, 7))
+    assert.False(t, noneMatch("", 7))
+}
+
+// TestErrorStatus will test mapping service error to http status code
+func TestErrorStatus(t *testing.T) {
+    cases := []struct{
+        name string
+        err  error
+        want int
+    }{
+        {"EXPECT 400 validation", fmt.Errorf("%w: user data invalid", ErrValidation), http.StatusBadRequest},
+        {"EXPECT 400 check violation", classifyQueryError(&pgconn.PgError{Code: "23514"}), http.StatusBadRequest},
+        {"EXPECT 401 invalid credentials", ErrInvalidCredentials, http.StatusUnauthorized},
+        {"EXPECT 403 forbidden", ErrForbidden, http.StatusForbidden},
+        {"EXPECT 404 no rows", classifyQueryError(pgx.ErrNoRows), http.StatusNotFound},
+        {"EXPECT 409 duplicate email", classifyQueryError(&pgconn.PgError{Code: "23505"}), http.StatusConflict},
+        {"EXPECT 412 version mismatch", ErrPreconditionFailed, http.StatusPreconditionFailed},
+        {"EXPECT 504 query timeout", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+        {"EXPECT 500 other error", errors.New("connection reset"), http.StatusInternalServerError},
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T) {
+            code, detail := ErrorMapper.Map(tt.err)
+            assert.Equal(t, tt.want, code)
+
+            writer, c := NewTestRecordWriter()
+            errorResponse(c, tt.err)
+
+            assert.Equal(t, tt.want, writer.Code)
+            assert.True(t, c.IsAborted())
+            assert.Equal(t, problem.ContentType, writer.Header().Get("Content-Type"))
+
+            // raw error must not leak to the client
+            var p problem.Problem
+            assert.NoError(t, json.Unmarshal(writer.Body.Bytes(), &p))
+            assert.Equal(t, tt.want, p.Status)
+            assert.Equal(t, detail, p.Detail)
+            assert.Equal(t, "/", p.Instance)
+            assert.NotContains(t, writer.Body.String(), tt.err.Error())
+        })
+    }
+
+    // EXPECT field errors reported
+    t.Run("EXPECT field errors", func(t *testing.T) {
+        cases := []struct{
+            err  error
+            want []problem.FieldError
+        }{
+            {invalidID(), []problem.FieldError{{Field: "id", Message: "must be an integer"}}},
+            {
+                classifyQueryError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_un"}),
+                []problem.FieldError{{Field: "email", Message: "is already used"}},
+            },
+            {
+                classifyQueryError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_lower_un"}),
+                []problem.FieldError{{Field: "email", Message: "is already used"}},
+            },
+            {
+                // postgres does not report the column of too long value
+                classifyQueryError(&pgconn.PgError{Code: "22001", Message: "value too long for type character varying(30)"}),
+                nil,
+            },
+        }
+
+        for _, tt := range cases {
+            writer, c := NewTestRecordWriter()
+            errorResponse(c, tt.err)
+
+            var p problem.Problem
+            assert.NoError(t, json.Unmarshal(writer.Body.Bytes(), &p))
+            assert.Equal(t, tt.want, p.Errors)
+        }
     })
 }
@@ -0,0 +1,191 @@
+/*
+    package account
+    list.go
+    - option of listing users: keyset pagination, sorting over whitelisted
+      column and filtering. the cursor is opaque to the client and bound to
+      the sort it was created for
+*/
+package account
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"pgxtest/problem"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// page size of listing users
+const (
+    DefaultLimit = 20
+    MaxLimit     = 100
+)
+
+// sortColumn is sortable field of the user
+type sortColumn struct {
+    // expr is sql expression of the column, nullable column is coalesced so
+    // the keyset comparison never compare null
+    expr string
+
+    // cast is appended to the cursor value argument, the value is stored in
+    // the cursor as text
+    cast string
+
+    // value will get value of the column of 'u' stored in the cursor
+    value func(u *User) string
+
+    // parse will check cursor value before it reach the cast, nil means any
+    // value is valid
+    parse func(value string) error
+}
+
+// sortFields is name of sortColumns in the order listed by the error
+var sortFields = []string{"id", "firstname", "lastname", "email", "created_at", "updated_at"}
+
+// sortColumns is whitelist of sortable field
+var sortColumns = map[string]sortColumn{
+    "id":         {expr: "id", value: func(*User) string { return "" }},
+    "firstname":  {expr: "firstname", value: func(u *User) string { return u.Firstname }},
+    "lastname":   {expr: "COALESCE(lastname, '')", value: func(u *User) string { return u.Lastname }},
+    "email":      {expr: "email", value: func(u *User) string { return u.Email }},
+    "created_at": {expr: "created_at", cast: "::text::timestamptz", value: func(u *User) string { return formatTime(u.CreatedAt) }, parse: parseTime},
+    "updated_at": {expr: "updated_at", cast: "::text::timestamptz", value: func(u *User) string { return formatTime(u.UpdatedAt) }, parse: parseTime},
+}
+
+// formatTime will format 't' as cursor value, postgres keep microsecond so
+// the value is exact
+func formatTime(t time.Time) string {
+    return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseTime will check cursor value formatted by formatTime, so edited
+// cursor is invalid option instead of failing the timestamptz cast
+func parseTime(value string) error {
+    _, err := time.Parse(time.RFC3339Nano, value)
+    return err
+}
+
+// ListOptions is option of listing users
+type ListOptions struct {
+    // Limit is page size, zero will use DefaultLimit
+    Limit int
+
+    // Cursor is NextCursor of the previous page, empty for the first page
+    Cursor string
+
+    // Sort is sort field, prefixed with "-" for descending order. empty
+    // value sort by id
+    Sort string
+
+    // Email filter user with exactly this email, case insensitive
+    Email string
+
+    // NamePrefix filter user whose first name or last name start with it,
+    // case insensitive
+    NamePrefix string
+
+    // CreatedAfter, CreatedBefore, UpdatedAfter and UpdatedBefore filter user
+    // created/ updated after (inclusive) or before (exclusive) the time. zero
+    // value is not filtered
+    CreatedAfter  time.Time
+    CreatedBefore time.Time
+    UpdatedAfter  time.Time
+    UpdatedBefore time.Time
+
+    // IncludeDeleted list soft deleted user too, only admin may set it
+    IncludeDeleted bool
+}
+
+// UserPage is single page of users
+type UserPage struct {
+    Users      []*UserResponse `json:"users"`
+    NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// cursor is decoded pagination cursor, the position after the last user of
+// the previous page
+type cursor struct {
+    Sort  string `json:"s"`
+    Value string `json:"v,omitempty"`
+    ID    int    `json:"id"`
+}
+
+// listQuery is validated ListOptions ready to be used by the repository
+type listQuery struct {
+    ListOptions
+    field string
+    desc  bool
+    after *cursor
+}
+
+// query will validate the options and apply the default value, the returned
+// error is *ValidationError listing every invalid option
+func (o ListOptions) query() (listQuery, error) {
+    q := listQuery{ListOptions: o, field: "id"}
+    var fields []problem.FieldError
+
+    if q.Limit == 0 {
+        q.Limit = DefaultLimit
+    }
+    if q.Limit < 1 || q.Limit > MaxLimit {
+        fields = append(fields, problem.FieldError{
+            Field: "limit", Message: "must be between 1 and " + strconv.Itoa(MaxLimit),
+        })
+    }
+
+    if q.Sort == "" {
+        q.Sort = "id"
+    }
+    q.field, q.desc = strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+    if _, ok := sortColumns[q.field]; !ok {
+        fields = append(fields, problem.FieldError{
+            Field: "sort", Message: "must be one of " + strings.Join(sortFields, ", ") + ", optionally prefixed with -",
+        })
+    }
+
+    if q.Cursor != "" {
+        c, err := decodeCursor(q.Cursor)
+        if err == nil && c.Sort == q.Sort && sortColumns[q.field].parse != nil {
+            err = sortColumns[q.field].parse(c.Value)
+        }
+        if err != nil || c.Sort != q.Sort {
+            fields = append(fields, problem.FieldError{
+                Field: "cursor", Message: "is invalid or does not match the sort",
+            })
+        }
+        q.after = c
+    }
+
+    if len(fields) > 0 {
+        return q, &ValidationError{Fields: fields}
+    }
+
+    return q, nil
+}
+
+// nextCursor will get cursor pointing after 'u'
+func (q listQuery) nextCursor(u *User) string {
+    b, _ := json.Marshal(cursor{Sort: q.Sort, Value: sortColumns[q.field].value(u), ID: u.ID})
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor will decode cursor created by nextCursor
+func decodeCursor(s string) (*cursor, error) {
+    b, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return nil, err
+    }
+
+    c := new(cursor)
+    if err := json.Unmarshal(b, c); err != nil {
+        return nil, err
+    }
+
+    return c, nil
+}
+
+// escapeLike will escape LIKE wildcard of 's', so it is matched literally
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
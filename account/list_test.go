@@ -0,0 +1,82 @@
+/*
+    package account
+    list_test.go
+    - test validation of the listing option and the pagination cursor
+*/
+package account
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListOptionsQuery will test validating and defaulting ListOptions
+func TestListOptionsQuery(t *testing.T) {
+    t.Run("EXPECT SUCCESS default", func(t *testing.T) {
+        q, err := ListOptions{}.query()
+        require.NoError(t, err)
+        assert.Equal(t, DefaultLimit, q.Limit)
+        assert.Equal(t, "id", q.field)
+        assert.False(t, q.desc)
+        assert.Nil(t, q.after)
+    })
+
+    t.Run("EXPECT SUCCESS cursor of the same sort", func(t *testing.T) {
+        first := listQuery{ListOptions: ListOptions{Sort: "-email"}, field: "email", desc: true}
+        next := first.nextCursor(&User{ID: 3, Email: "john@doe.com"})
+
+        q, err := ListOptions{Sort: "-email", Cursor: next}.query()
+        require.NoError(t, err)
+        assert.Equal(t, "email", q.field)
+        assert.True(t, q.desc)
+        assert.Equal(t, &cursor{Sort: "-email", Value: "john@doe.com", ID: 3}, q.after)
+    })
+
+    t.Run("EXPECT SUCCESS cursor of timestamp sort", func(t *testing.T) {
+        created := time.Date(2022, 1, 2, 10, 4, 5, 123456000, time.FixedZone("WIB", 7*60*60))
+        first := listQuery{ListOptions: ListOptions{Sort: "created_at"}, field: "created_at"}
+        next := first.nextCursor(&User{ID: 3, CreatedAt: created})
+
+        q, err := ListOptions{Sort: "created_at", Cursor: next}.query()
+        require.NoError(t, err)
+        assert.Equal(t, &cursor{Sort: "created_at", Value: "2022-01-02T03:04:05.123456Z", ID: 3}, q.after)
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T) {
+        other := listQuery{ListOptions: ListOptions{Sort: "email"}, field: "email"}
+        cases := map[string]ListOptions{
+            "limit":  {Limit: -1},
+            "sort":   {Sort: "passkey"},
+            "cursor": {Cursor: other.nextCursor(&User{ID: 3, Email: "john@doe.com"})},
+        }
+
+        for field, opts := range cases {
+            _, err := opts.query()
+            var verr *ValidationError
+            require.ErrorAs(t, err, &verr, field)
+            require.Len(t, verr.Fields, 1, field)
+            assert.Equal(t, field, verr.Fields[0].Field)
+        }
+    })
+
+    t.Run("EXPECT FAIL cursor value of timestamp sort", func(t *testing.T) {
+        // hand-edited cursor must not reach the timestamptz cast
+        edited := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"-updated_at","v":"yesterday","id":3}`))
+
+        _, err := ListOptions{Sort: "-updated_at", Cursor: edited}.query()
+        var verr *ValidationError
+        require.ErrorAs(t, err, &verr)
+        require.Len(t, verr.Fields, 1)
+        assert.Equal(t, "cursor", verr.Fields[0].Field)
+    })
+}
+
+// TestEscapeLike will test escaping LIKE wildcard
+func TestEscapeLike(t *testing.T) {
+    assert.Equal(t, `jo\%n\_\\`, escapeLike(`jo%n_\`))
+    assert.Equal(t, "john", escapeLike("john"))
+}
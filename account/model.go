@@ -6,7 +6,9 @@
 package account
 
 import (
-	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
 type IUser interface {
@@ -25,21 +27,64 @@ type User struct {
     Lastname string
     Email string
     PassKey string
+    Role string
+
+    // Version is incremented by every update. on update it is the expected
+    // current version, zero update regardless of the current version
+    Version int
+
+    // CreatedAt, UpdatedAt, CreatedBy and UpdatedBy is maintained by the
+    // repository, the actor is nil when the change is not made by a caller
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    CreatedBy *int
+    UpdatedBy *int
+
+    // DeletedAt is the soft delete time, nil for active user. deleted user
+    // is purged after the retention period
+    DeletedAt *time.Time
 }
 
+// role of the user, admin may manage every user while user may only read and
+// update itself
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
 // TableName method will return constant string "Users" as its result
 func (u *User) TableName() string {
     return "Users"
 }
 
-// IsValid is to validate user input
+// String will format the user without its passkey, so the passkey or its hash
+// is never written to the log
+func (u User) String() string {
+    return fmt.Sprintf("{ID:%d Firstname:%s Lastname:%s Email:%s Role:%s Version:%d}",
+        u.ID, u.Firstname, u.Lastname, u.Email, u.Role, u.Version)
+}
+
+// Normalize will trim the names and normalize the email of user input
+func (u *User) Normalize() {
+    u.Firstname = strings.TrimSpace(u.Firstname)
+    u.Lastname = strings.TrimSpace(u.Lastname)
+    u.Email = NormalizeEmail(u.Email)
+}
+
+// IsValid is to validate normalized user input, the returned error is
+// *ValidationError listing every failing field. the passkey byte limit of the
+// configured hasher is checked by the account service
 func (u *User) IsValid() error {
-    if u.ID == 0 ||
-        u.Firstname == "" ||
-        u.Email == "" ||
-        u.PassKey == "" {
-            return errors.New("user data invalid")
-        }
-
-    return nil
+    v := new(validator)
+    u.validate(v)
+    return v.err()
+}
+
+// validate will add failing field of 'u' to 'v'. the id is checked against
+// the path by the caller, the role by checkRole
+func (u *User) validate(v *validator) {
+    v.name("firstname", u.Firstname, true)
+    v.name("lastname", u.Lastname, false)
+    v.email(u.Email)
+    v.passKey(u.PassKey)
 }
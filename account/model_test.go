@@ -1,11 +1,22 @@
 package account
 
 import (
+	"errors"
+	"fmt"
+	"pgxtest/problem"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// TestUserString will make sure passkey is not printed
+func TestUserString(t *testing.T) {
+    u := User{ID: 1, Firstname: "jhonny", Email: "jhonny@botak.com", PassKey: "$argon2id$secret"}
+
+    assert.NotContains(t, fmt.Sprintf("%v %+v %s", u, &u, u), "secret")
+    assert.Contains(t, u.String(), "jhonny@botak.com")
+}
+
 // TestTableName will test the tablename func return
 func TestTableName(t *testing.T) {
     u := new(User)
@@ -23,17 +34,17 @@ func TestModelIsValid(t *testing.T) {
     }{
         {
             "EXPECT VALID",
-            User{1, "jhonny", "botak", "jhonny@botak.com", "rahasia"},
+            User{1, "jhonny", "botak", "jhonny@botak.com", "rahasia1", RoleUser, 1, testTime, testTime, nil, nil, nil},
             false,
         },
         {
             "EXPECT INVALID 1",
-            User{2, "", "", "", ""},
+            User{2, "", "", "", "", "", 0, testTime, testTime, nil, nil, nil},
             true,
         },
         {
             "EXPECT INVALID 2",
-            User{2, "jhonny", "botak", "", "rahasia"},
+            User{2, "jhonny", "botak", "", "rahasia1", RoleUser, 1, testTime, testTime, nil, nil, nil},
             true,
         },
 
@@ -49,4 +60,38 @@ func TestModelIsValid(t *testing.T) {
             }
         })
     }
+
+    // EXPECT every missing field is reported, the id is not required
+    t.Run("EXPECT INVALID field errors", func(t *testing.T){
+        u := User{Lastname: "botak", Email: "jhonny@botak.com"}
+        err := u.IsValid()
+
+        var vErr *ValidationError
+        assert.True(t, errors.As(err, &vErr))
+        assert.True(t, errors.Is(err, ErrValidation))
+        assert.Equal(t, []problem.FieldError{
+            {Field: "firstname", Message: "is required"},
+            {Field: "passkey", Message: "is required"},
+        }, vErr.Fields)
+    })
+
+    // EXPECT every invalid field is reported at once
+    t.Run("EXPECT INVALID every field", func(t *testing.T){
+        u := User{Firstname: "j0hnny", Lastname: "-botak", Email: "jhonny@botak", PassKey: "12345678"}
+        err := u.IsValid()
+
+        var vErr *ValidationError
+        assert.True(t, errors.As(err, &vErr))
+        assert.Equal(t, []string{"firstname", "lastname", "email", "passkey"}, []string{
+            vErr.Fields[0].Field, vErr.Fields[1].Field, vErr.Fields[2].Field, vErr.Fields[3].Field,
+        })
+    })
+}
+
+// TestUserNormalize will test trimming and normalizing user input
+func TestUserNormalize(t *testing.T) {
+    u := User{Firstname: " jhonny ", Lastname: "botak ", Email: " Jhonny@Botak.COM "}
+    u.Normalize()
+
+    assert.Equal(t, User{Firstname: "jhonny", Lastname: "botak", Email: "jhonny@botak.com"}, u)
 }
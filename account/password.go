@@ -0,0 +1,266 @@
+/*
+    package account
+    password.go
+    - password hashing of the user passkey. the hash is encoded together with
+      its algorithm and parameters, so the cost can be raised later and the
+      old hash rehashed on the next successful login
+*/
+package account
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidHash is returned when the encoded hash can not be parsed
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// PasswordHasher is password hashing algorithm used by the account service
+type PasswordHasher interface {
+    // Hash will hash 'password' and return the encoded hash
+    Hash(password string) (string, error)
+
+    // Verify will report whether 'password' match the 'encoded' hash
+    Verify(encoded, password string) (bool, error)
+
+    // NeedsRehash will report whether 'encoded' was not created by this
+    // hasher with its current parameters
+    NeedsRehash(encoded string) bool
+}
+
+// PasswordConfig is configuration of the password hashing
+type PasswordConfig struct {
+    // Algorithm is "argon2id" or "bcrypt", empty value will use argon2id
+    Algorithm string `yaml:"algorithm"`
+
+    // BcryptCost is bcrypt cost factor, zero will use bcrypt.DefaultCost
+    BcryptCost int `yaml:"bcrypt_cost"`
+
+    // Argon2Memory (in KiB), Argon2Iterations and Argon2Parallelism are
+    // argon2id parameters, zero value will use the default
+    Argon2Memory      int `yaml:"argon2_memory"`
+    Argon2Iterations  int `yaml:"argon2_iterations"`
+    Argon2Parallelism int `yaml:"argon2_parallelism"`
+}
+
+// password hashing algorithm name
+const (
+    AlgorithmArgon2id = "argon2id"
+    AlgorithmBcrypt   = "bcrypt"
+)
+
+// Hasher will create PasswordHasher from the configuration
+func (c PasswordConfig) Hasher() (PasswordHasher, error) {
+    switch c.Algorithm {
+    case "", AlgorithmArgon2id:
+        h := DefaultArgon2id()
+        if c.Argon2Memory < 0 || c.Argon2Iterations < 0 || c.Argon2Parallelism < 0 || c.Argon2Parallelism > 255 {
+            return nil, errors.New("invalid password configuration: argon2 parameter out of range")
+        }
+        if c.Argon2Memory > 0 {
+            h.Memory = uint32(c.Argon2Memory)
+        }
+        if c.Argon2Iterations > 0 {
+            h.Iterations = uint32(c.Argon2Iterations)
+        }
+        if c.Argon2Parallelism > 0 {
+            h.Parallelism = uint8(c.Argon2Parallelism)
+        }
+        return h, nil
+    case AlgorithmBcrypt:
+        cost := c.BcryptCost
+        if cost == 0 {
+            cost = bcrypt.DefaultCost
+        }
+        if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+            return nil, fmt.Errorf("invalid password configuration: bcrypt cost must be between %d and %d",
+                bcrypt.MinCost, bcrypt.MaxCost)
+        }
+        return BcryptHasher{Cost: cost}, nil
+    default:
+        return nil, fmt.Errorf("invalid password configuration: unknown algorithm %q, must be %q or %q",
+            c.Algorithm, AlgorithmArgon2id, AlgorithmBcrypt)
+    }
+}
+
+// verifierFor will get hasher able to verify 'encoded', so passkey hashed
+// before the algorithm was changed can still be verified and rehashed.
+// 'fallback' is used when the algorithm of 'encoded' is not recognized
+func verifierFor(encoded string, fallback PasswordHasher) PasswordHasher {
+    switch {
+    case strings.HasPrefix(encoded, "$"+AlgorithmArgon2id+"$"):
+        return Argon2idHasher{}
+    case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+        return BcryptHasher{}
+    default:
+        return fallback
+    }
+}
+
+// Argon2idHasher is PasswordHasher using argon2id, the hash is encoded in
+// PHC string format: $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+    Memory      uint32
+    Iterations  uint32
+    Parallelism uint8
+    SaltLength  uint32
+    KeyLength   uint32
+}
+
+// DefaultArgon2id will get argon2id hasher with the recommended parameters
+func DefaultArgon2id() Argon2idHasher {
+    return Argon2idHasher{
+        Memory:      64 * 1024,
+        Iterations:  3,
+        Parallelism: 2,
+        SaltLength:  16,
+        KeyLength:   32,
+    }
+}
+
+// Hash will hash 'password' using random salt
+func (h Argon2idHasher) Hash(password string) (string, error) {
+    salt := make([]byte, h.SaltLength)
+    if _, err := rand.Read(salt); err != nil {
+        return "", fmt.Errorf("generating password salt: %w", err)
+    }
+
+    key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+    return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+        argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+        base64.RawStdEncoding.EncodeToString(salt),
+        base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify will hash 'password' using the parameters of 'encoded' and compare
+// the result in constant time
+func (h Argon2idHasher) Verify(encoded, password string) (bool, error) {
+    params, salt, key, err := decodeArgon2id(encoded)
+    if err != nil {
+        return false, err
+    }
+
+    other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+    return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// NeedsRehash will report whether 'encoded' is not argon2id hash or was
+// created using different parameters
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+    params, salt, _, err := decodeArgon2id(encoded)
+    if err != nil {
+        return true
+    }
+
+    return params.Memory != h.Memory ||
+        params.Iterations != h.Iterations ||
+        params.Parallelism != h.Parallelism ||
+        params.KeyLength != h.KeyLength ||
+        uint32(len(salt)) != h.SaltLength
+}
+
+// decodeArgon2id will parse encoded argon2id hash into its parameters, salt
+// and key
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+    var params Argon2idHasher
+
+    // "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+    parts := strings.Split(encoded, "$")
+    if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+        return params, nil, nil, ErrInvalidHash
+    }
+
+    var version int
+    if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+        return params, nil, nil, ErrInvalidHash
+    }
+
+    if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d",
+        &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+        return params, nil, nil, ErrInvalidHash
+    }
+
+    salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+    if err != nil {
+        return params, nil, nil, ErrInvalidHash
+    }
+    key, err := base64.RawStdEncoding.DecodeString(parts[5])
+    if err != nil || len(key) == 0 {
+        return params, nil, nil, ErrInvalidHash
+    }
+    params.SaltLength = uint32(len(salt))
+    params.KeyLength = uint32(len(key))
+
+    return params, salt, key, nil
+}
+
+// bcryptMaxBytes is the longest password bcrypt use, the rest is silently
+// ignored so two password sharing the first 72 bytes would match
+const bcryptMaxBytes = 72
+
+// ErrPasswordTooLong is returned when the password is longer than the hasher
+// can use without truncating it
+var ErrPasswordTooLong = errors.New("password too long")
+
+// maxPassKeyBytes will get the longest passkey in bytes 'h' use without
+// truncating it, zero means no limit other than maxPassKeyLength
+func maxPassKeyBytes(h PasswordHasher) int {
+    if _, ok := h.(BcryptHasher); ok {
+        return bcryptMaxBytes
+    }
+    return 0
+}
+
+// BcryptHasher is PasswordHasher using bcrypt, password longer than 72 bytes
+// is refused rather than truncated
+type BcryptHasher struct {
+    Cost int
+}
+
+// Hash will hash 'password' using bcrypt
+func (h BcryptHasher) Hash(password string) (string, error) {
+    if len(password) > bcryptMaxBytes {
+        return "", ErrPasswordTooLong
+    }
+
+    b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+    if err != nil {
+        return "", fmt.Errorf("hashing password: %w", err)
+    }
+
+    return string(b), nil
+}
+
+// Verify will report whether 'password' match bcrypt hash 'encoded', password
+// longer than 72 bytes never match since it can not be the hashed one
+func (h BcryptHasher) Verify(encoded, password string) (bool, error) {
+    if len(password) > bcryptMaxBytes {
+        return false, nil
+    }
+
+    err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+    switch {
+    case err == nil:
+        return true, nil
+    case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+        return false, nil
+    default:
+        return false, ErrInvalidHash
+    }
+}
+
+// NeedsRehash will report whether 'encoded' is not bcrypt hash or was
+// created using different cost
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+    cost, err := bcrypt.Cost([]byte(encoded))
+    return err != nil || cost != h.Cost
+}
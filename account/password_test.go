@@ -0,0 +1,148 @@
+/*
+    package account
+    password_test.go
+    - test password hashing, verification and rehash detection
+*/
+package account
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastArgon2id is argon2id hasher with low cost to keep the test fast
+var fastArgon2id = Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// TestPasswordHasher will test hash and verify of every hasher
+func TestPasswordHasher(t *testing.T) {
+    hashers := map[string]PasswordHasher{
+        "argon2id": fastArgon2id,
+        "bcrypt":   BcryptHasher{Cost: bcrypt.MinCost},
+    }
+
+    for name, h := range hashers {
+        t.Run(name, func(t *testing.T) {
+            encoded, err := h.Hash("secret")
+            require.NoError(t, err)
+            assert.NotContains(t, encoded, "secret")
+
+            // random salt, same password never produce the same hash
+            other, err := h.Hash("secret")
+            require.NoError(t, err)
+            assert.NotEqual(t, encoded, other)
+
+            ok, err := h.Verify(encoded, "secret")
+            assert.NoError(t, err)
+            assert.True(t, ok)
+
+            ok, err = h.Verify(encoded, "wrong")
+            assert.NoError(t, err)
+            assert.False(t, ok)
+
+            assert.False(t, h.NeedsRehash(encoded))
+
+            // plaintext passkey stored before hashing was introduced
+            ok, err = h.Verify("secret", "secret")
+            assert.ErrorIs(t, err, ErrInvalidHash)
+            assert.False(t, ok)
+            assert.True(t, h.NeedsRehash("secret"))
+        })
+    }
+}
+
+// TestArgon2idHasher will test argon2id encoding and parameter upgrade
+func TestArgon2idHasher(t *testing.T) {
+    encoded, err := fastArgon2id.Hash("secret")
+    require.NoError(t, err)
+    assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+    // stronger parameter, old hash still verified but need rehash
+    stronger := fastArgon2id
+    stronger.Iterations = 2
+    ok, err := stronger.Verify(encoded, "secret")
+    assert.NoError(t, err)
+    assert.True(t, ok)
+    assert.True(t, stronger.NeedsRehash(encoded))
+
+    // bcrypt hash is not argon2id hash
+    b, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("secret")
+    require.NoError(t, err)
+    assert.True(t, fastArgon2id.NeedsRehash(b))
+}
+
+// TestBcryptHasher will test bcrypt cost upgrade
+func TestBcryptHasher(t *testing.T) {
+    encoded, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("secret")
+    require.NoError(t, err)
+
+    stronger := BcryptHasher{Cost: bcrypt.MinCost + 1}
+    ok, err := stronger.Verify(encoded, "secret")
+    assert.NoError(t, err)
+    assert.True(t, ok)
+    assert.True(t, stronger.NeedsRehash(encoded))
+}
+
+// TestBcryptHasherLongPassword will test password longer than 72 bytes is
+// refused instead of truncated
+func TestBcryptHasherLongPassword(t *testing.T) {
+    h := BcryptHasher{Cost: bcrypt.MinCost}
+    prefix := strings.Repeat("a", bcryptMaxBytes)
+
+    encoded, err := h.Hash(prefix)
+    require.NoError(t, err)
+
+    _, err = h.Hash(prefix + "1")
+    assert.ErrorIs(t, err, ErrPasswordTooLong)
+
+    // sharing the first 72 bytes is not a match
+    ok, err := h.Verify(encoded, prefix+"1")
+    assert.NoError(t, err)
+    assert.False(t, ok)
+
+    assert.Equal(t, bcryptMaxBytes, maxPassKeyBytes(h))
+    assert.Zero(t, maxPassKeyBytes(DefaultArgon2id()))
+}
+
+// TestPasswordConfigHasher will test creating hasher from configuration
+func TestPasswordConfigHasher(t *testing.T) {
+    t.Run("EXPECT SUCCESS default argon2id", func(t *testing.T) {
+        got, err := PasswordConfig{}.Hasher()
+
+        assert.NoError(t, err)
+        assert.Equal(t, DefaultArgon2id(), got)
+    })
+
+    t.Run("EXPECT SUCCESS tuned argon2id", func(t *testing.T) {
+        got, err := PasswordConfig{Algorithm: "argon2id", Argon2Memory: 32768, Argon2Iterations: 4}.Hasher()
+
+        assert.NoError(t, err)
+        h := got.(Argon2idHasher)
+        assert.Equal(t, uint32(32768), h.Memory)
+        assert.Equal(t, uint32(4), h.Iterations)
+        assert.Equal(t, DefaultArgon2id().Parallelism, h.Parallelism)
+    })
+
+    t.Run("EXPECT SUCCESS bcrypt", func(t *testing.T) {
+        got, err := PasswordConfig{Algorithm: "bcrypt"}.Hasher()
+
+        assert.NoError(t, err)
+        assert.Equal(t, BcryptHasher{Cost: bcrypt.DefaultCost}, got)
+    })
+
+    t.Run("EXPECT FAIL invalid config", func(t *testing.T) {
+        for _, c := range []PasswordConfig{
+            {Algorithm: "md5"},
+            {Algorithm: "bcrypt", BcryptCost: 99},
+            {Argon2Parallelism: 256},
+            {Argon2Memory: -1},
+        } {
+            got, err := c.Hasher()
+            assert.Error(t, err)
+            assert.Nil(t, got)
+        }
+    })
+}
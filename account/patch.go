@@ -0,0 +1,149 @@
+/*
+    package account
+    patch.go
+    - partial update of user using JSON Merge Patch (RFC 7396) semantics.
+      member missing from the patch is left unchanged, member with null value
+      is removed and other member replace the current value
+*/
+package account
+
+import (
+	"bytes"
+	"encoding/json"
+	"pgxtest/problem"
+	"sort"
+	"strings"
+)
+
+// UserPatch is partial update of 'User', nil field is left unchanged
+type UserPatch struct {
+    Firstname *string
+    // Lastname is the only removable field, null value is stored as NULL
+    // and read back as empty string
+    Lastname  *string
+    Email     *string
+    PassKey   *string
+    Role      *string
+
+    // Version is the expected current version, zero patch regardless of the
+    // current version. it is not part of the patch document
+    Version   int
+}
+
+// patchFields is member name accepted by the patch, the same name as the
+// request body of create and update
+var patchFields = []string{"firstname", "lastname", "email", "passkey", "role"}
+
+// field will get pointer to the patch field of member 'name'
+func (p *UserPatch) field(name string) **string {
+    switch name {
+    case "firstname":
+        return &p.Firstname
+    case "lastname":
+        return &p.Lastname
+    case "email":
+        return &p.Email
+    case "passkey":
+        return &p.PassKey
+    case "role":
+        return &p.Role
+    default:
+        return nil
+    }
+}
+
+// UnmarshalJSON will decode merge patch document 'b', the returned error is
+// *ValidationError listing every unknown member, removed required member or
+// member that is not a string
+func (p *UserPatch) UnmarshalJSON(b []byte) error {
+    var doc map[string]json.RawMessage
+    if err := json.Unmarshal(b, &doc); err != nil {
+        return err
+    }
+
+    // sort the member, so the field errors have stable order
+    names := make([]string, 0, len(doc))
+    for name := range doc {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var fields []problem.FieldError
+    for _, name := range names {
+        raw := doc[name]
+        target := p.field(name)
+        switch {
+        case target == nil:
+            fields = append(fields, problem.FieldError{Field: name, Message: "can not be patched"})
+        case bytes.Equal(raw, []byte("null")):
+            if name != "lastname" {
+                fields = append(fields, problem.FieldError{Field: name, Message: "can not be removed"})
+                continue
+            }
+            empty := ""
+            *target = &empty
+        default:
+            var v string
+            if err := json.Unmarshal(raw, &v); err != nil {
+                fields = append(fields, problem.FieldError{Field: name, Message: "must be a string"})
+                continue
+            }
+            *target = &v
+        }
+    }
+
+    if len(fields) > 0 {
+        return &ValidationError{Fields: fields}
+    }
+
+    return nil
+}
+
+// IsEmpty will report whether the patch change nothing
+func (p *UserPatch) IsEmpty() bool {
+    for _, name := range patchFields {
+        if *p.field(name) != nil {
+            return false
+        }
+    }
+    return true
+}
+
+// Normalize will trim the names and normalize the email of the patch
+func (p *UserPatch) Normalize() {
+    for _, f := range []*string{p.Firstname, p.Lastname} {
+        if f != nil {
+            *f = strings.TrimSpace(*f)
+        }
+    }
+    if p.Email != nil {
+        *p.Email = NormalizeEmail(*p.Email)
+    }
+}
+
+// IsValid is to validate normalized patch using the same rule as 'User',
+// only the provided field is validated. the returned error is *ValidationError
+func (p *UserPatch) IsValid() error {
+    v := new(validator)
+    p.validate(v)
+    return v.err()
+}
+
+// validate will add failing field of 'p' to 'v'
+func (p *UserPatch) validate(v *validator) {
+    if p.Firstname != nil {
+        v.name("firstname", *p.Firstname, true)
+    }
+    if p.Lastname != nil {
+        v.name("lastname", *p.Lastname, false)
+    }
+    if p.Email != nil {
+        v.email(*p.Email)
+    }
+    if p.PassKey != nil {
+        v.passKey(*p.PassKey)
+    }
+    if p.Role != nil && *p.Role == "" {
+        v.add("role", "is required")
+    }
+}
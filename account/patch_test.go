@@ -0,0 +1,61 @@
+/*
+    package account
+    patch_test.go
+    - test decoding and validating JSON Merge Patch of user
+*/
+package account
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUserPatchUnmarshalJSON will test merge patch semantics of UserPatch
+func TestUserPatchUnmarshalJSON(t *testing.T) {
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        var p UserPatch
+        err := json.Unmarshal([]byte(`{"firstname":"zhao","lastname":null}`), &p)
+        require.NoError(t, err)
+
+        require.NotNil(t, p.Firstname)
+        assert.Equal(t, "zhao", *p.Firstname)
+        require.NotNil(t, p.Lastname)
+        assert.Equal(t, "", *p.Lastname)
+        assert.Nil(t, p.Email)
+        assert.Nil(t, p.PassKey)
+        assert.Nil(t, p.Role)
+        assert.False(t, p.IsEmpty())
+    })
+
+    t.Run("EXPECT SUCCESS empty patch", func(t *testing.T) {
+        var p UserPatch
+        require.NoError(t, json.Unmarshal([]byte(`{}`), &p))
+        assert.True(t, p.IsEmpty())
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T) {
+        var p UserPatch
+        err := json.Unmarshal([]byte(`{"role":1,"email":null,"id":2}`), &p)
+        assert.ErrorIs(t, err, ErrValidation)
+        assert.EqualError(t, err, "validation failed: email can not be removed, id can not be patched, role must be a string")
+
+        err = json.Unmarshal([]byte(`"zhao"`), &p)
+        assert.Error(t, err)
+        assert.NotErrorIs(t, err, ErrValidation)
+    })
+}
+
+// TestUserPatchIsValid will test validating the provided field
+func TestUserPatchIsValid(t *testing.T) {
+    empty, name, email := "", "zhao", " Zhao@Lucy.com"
+    p := UserPatch{Firstname: &name, Lastname: &empty, Email: &email}
+    p.Normalize()
+    assert.NoError(t, p.IsValid())
+    assert.Equal(t, "zhao@lucy.com", *p.Email)
+
+    err := (&UserPatch{Firstname: &empty, PassKey: &empty}).IsValid()
+    assert.EqualError(t, err, "validation failed: firstname is required, passkey is required")
+}
@@ -0,0 +1,51 @@
+/*
+    package account
+    purge.go
+    - background job permanently deleting user which was soft deleted longer
+      than the retention period
+*/
+package account
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PurgeConfig is configuration of the purge job
+type PurgeConfig struct {
+    // Retention is how long soft deleted user is kept, so it can be
+    // restored. zero disable the job and deleted user is kept forever
+    Retention time.Duration `yaml:"retention"`
+
+    // Interval is wait time between each purge, zero disable the job
+    Interval time.Duration `yaml:"interval"`
+}
+
+// RunPurge will purge user deleted longer than cfg.Retention using 'svc'
+// right away and then every cfg.Interval until 'ctx' is done. failing purge
+// is logged and retried on the next run
+func RunPurge(ctx context.Context, svc AccountService, cfg PurgeConfig) {
+    if cfg.Retention <= 0 || cfg.Interval <= 0 {
+        return
+    }
+
+    ticker := time.NewTicker(cfg.Interval)
+    defer ticker.Stop()
+
+    for {
+        n, err := svc.Purge(ctx, time.Now().Add(-cfg.Retention))
+        switch {
+        case err != nil && ctx.Err() == nil:
+            log.Printf("purging deleted users: %v\n", err)
+        case n > 0:
+            log.Printf("purged %d deleted users\n", n)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
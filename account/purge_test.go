@@ -0,0 +1,71 @@
+/*
+    package account
+    purge_test.go
+    - test the job purging soft deleted users
+*/
+package account
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// purgeService is AccountService double, only Purge is implemented. every
+// purge time is sent to 'calls'
+type purgeService struct {
+    AccountService
+    calls chan time.Time
+    err   error
+}
+
+// Purge will record 'before' and return the configured error
+func (s *purgeService) Purge(ctx context.Context, before time.Time) (int64, error) {
+    s.calls <- before
+    return 1, s.err
+}
+
+// TestRunPurge will test running the purge job until the context is done
+func TestRunPurge(t *testing.T) {
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        svc := &purgeService{calls: make(chan time.Time, 10), err: errors.New("purge failed")}
+        cfg := PurgeConfig{Retention: time.Hour, Interval: time.Millisecond}
+
+        ctx, cancel := context.WithCancel(context.Background())
+        done := make(chan struct{})
+        go func() {
+            RunPurge(ctx, svc, cfg)
+            close(done)
+        }()
+
+        // the job run right away and keep running after failing purge
+        for i := 0; i < 2; i++ {
+            select {
+            case before := <-svc.calls:
+                assert.WithinDuration(t, time.Now().Add(-cfg.Retention), before, time.Second)
+            case <-time.After(time.Second):
+                t.Fatal("purge was not run")
+            }
+        }
+
+        cancel()
+        select {
+        case <-done:
+        case <-time.After(time.Second):
+            t.Fatal("purge job did not stop")
+        }
+    })
+
+    t.Run("EXPECT SUCCESS disabled", func(t *testing.T) {
+        svc := &purgeService{calls: make(chan time.Time, 1)}
+
+        // return right away without purging
+        RunPurge(context.Background(), svc, PurgeConfig{Interval: time.Millisecond})
+        RunPurge(context.Background(), svc, PurgeConfig{Retention: time.Hour})
+
+        assert.Empty(t, svc.calls)
+    })
+}
@@ -9,6 +9,12 @@ package account
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"pgxtest/problem"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
@@ -34,89 +40,234 @@ type PgxIface interface {
 	Close()
 }
 
-// Database is wrapper for PgxIface
-type Database struct {
-    DB PgxIface
+// QueryTimeouts is maximum duration of each database operation. zero value
+// of the operation will use Default, zero Default means no timeout other than
+// the deadline of the given context
+type QueryTimeouts struct {
+    Default time.Duration `yaml:"default"`
+    Create  time.Duration `yaml:"create"`
+    Get     time.Duration `yaml:"get"`
+    Gets    time.Duration `yaml:"gets"`
+    Update  time.Duration `yaml:"update"`
+    Delete  time.Duration `yaml:"delete"`
 }
 
-// NewSelector is an initializer for Selector
-func NewDatabase(ds PgxIface) Database {
-    return Database{DB: ds}
-}
+// withTimeout will derive context of operation with 'timeout', Default is used
+// if 'timeout' is zero
+func (t QueryTimeouts) withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+    if timeout <= 0 {
+        timeout = t.Default
+    }
+    if timeout <= 0 {
+        return context.WithCancel(ctx)
+    }
 
-// Create method will insert new record to database. 'C' part of the CRUD
-func (pool Database) Create(user User) (*User, error) {
-    // sql for inserting new record
-    q := `INSERT INTO users (firstname,lastname,email,passkey)
-          VALUES ($1,$2,$3,$4) RETURNING id,firstname,lastname,email,passkey`
+    return context.WithTimeout(ctx, timeout)
+}
 
-    // execute query to insert new record. it takes 'user' variable as its input
-    // the result will be placed in 'row' variable
-    row := pool.DB.QueryRow(context.Background(), q, 
-        user.Firstname, user.Lastname, user.Email, user.PassKey)
+// userColumns is column list of 'User' used by every query returning user.
+// the order must match scanUser. nullable lastname is read as empty string
+const userColumns = `id, firstname, COALESCE(lastname, '') AS lastname, email, passkey, role, version,
+    created_at, updated_at, created_by, updated_by, deleted_at`
 
-    // create 'u' variable as 'User' type to contain scanned data value from 'row' variable
+// scanUser will scan single row of userColumns to 'User'. it accept both
+// pgx.Row and pgx.Rows, the scan error is classified by classifyQueryError
+func scanUser(row pgx.Row) (*User, error) {
     u := new(User)
-
-    // scan 'row' variable and place the value to 'u' variable as well as check for error
-    err := row.Scan(
+    if err := row.Scan(
         &u.ID,
         &u.Firstname,
         &u.Lastname,
         &u.Email,
         &u.PassKey,
-    )
+        &u.Role,
+        &u.Version,
+        &u.CreatedAt,
+        &u.UpdatedAt,
+        &u.CreatedBy,
+        &u.UpdatedBy,
+        &u.DeletedAt,
+    ); err != nil {
+        return nil, classifyQueryError(err)
+    }
+
+    return u, nil
+}
+
+// actor will get id of the caller of 'ctx' stored as created_by/ updated_by,
+// nil (NULL) if the operation is not made by a caller
+func actor(ctx context.Context) interface{} {
+    if caller, ok := CallerFrom(ctx); ok {
+        return caller.ID
+    }
+    return nil
+}
 
-    // return nil and error if scan operation is fail/ error found
+// lockUserQuery will lock user 'id' of the mutation, so the audited before
+// value is the value replaced by the mutation
+const lockUserQuery = `SELECT ` + userColumns + ` FROM users WHERE id = $1 FOR UPDATE`
+
+// auditQuery will insert audit entry of the mutation, empty request id is NULL
+const auditQuery = `INSERT INTO account_audit (user_id,actor_id,action,changes,request_id)
+          VALUES ($1,$2,$3,$4::jsonb,NULLIF($5, ''))`
+
+// audited will run mutation 'fn' of user 'id' in transaction and write its
+// audit entry of 'action' in the same transaction, zero 'id' is creation of
+// the user. 'fn' must run its query using 'tx' and get the mutated user
+func (pool Database) audited(ctx context.Context, action string, id int, fn func(tx pgx.Tx) (*User, error)) (*User, error) {
+    tx, err := pool.DB.Begin(ctx)
+    if err != nil {
+        return nil, classifyQueryError(err)
+    }
+    // rollback is no-op after commit
+    defer tx.Rollback(ctx)
+
+    var before *User
+    if id != 0 {
+        if before, err = scanUser(tx.QueryRow(ctx, lockUserQuery, id)); err != nil {
+            return nil, err
+        }
+    }
+
+    after, err := fn(tx)
     if err != nil {
         return nil, err
     }
 
-    // return 'u' and nil if no error found
-    return u, nil
+    changes, err := json.Marshal(diffUsers(before, after))
+    if err != nil {
+        return nil, err
+    }
+    if _, err := tx.Exec(ctx, auditQuery,
+        after.ID, actor(ctx), action, string(changes), problem.RequestIDFrom(ctx)); err != nil {
+        return nil, classifyQueryError(err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, classifyQueryError(err)
+    }
+
+    return after, nil
 }
 
-// Get method will get user data by its ID. 'R' part of the CRUD
-func (pool Database) Get(id int) (*User, error) {
+// checkVersion will get ErrPreconditionFailed when conditional operation
+// 'err' did not find user 'id' of 'version' but the user still exist
+func (pool Database) checkVersion(ctx context.Context, id, version int, err error) error {
+    if version == 0 || !errors.Is(err, ErrNotFound) {
+        return err
+    }
+    if _, gErr := pool.Get(ctx, id); gErr != nil {
+        return err
+    }
+
+    return ErrPreconditionFailed
+}
+
+// Database is wrapper for PgxIface
+type Database struct {
+    DB PgxIface
+
+    // Timeouts is query timeout of each operation
+    Timeouts QueryTimeouts
+}
+
+// NewSelector is an initializer for Selector
+func NewDatabase(ds PgxIface) Database {
+    return Database{DB: ds}
+}
+
+// WithTimeouts will get copy of the database using 'timeouts' as its query timeout
+func (pool Database) WithTimeouts(timeouts QueryTimeouts) Database {
+    pool.Timeouts = timeouts
+    return pool
+}
+
+// Create method will insert new record to database. 'C' part of the CRUD
+func (pool Database) Create(ctx context.Context, user User) (*User, error) {
+    // limit the query duration, the query is also cancelled when 'ctx' is done
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Create)
+    defer cancel()
+
+    // sql for inserting new record
+    // the time is set by the column default, the caller is both creator and updater
+    q := `INSERT INTO users (firstname,lastname,email,passkey,role,created_by,updated_by)
+          VALUES ($1,$2,$3,$4,$5,$6,$6) RETURNING ` + userColumns
+
+    // execute query to insert new record together with its audit entry. it
+    // takes 'user' variable as its input
+    return pool.audited(ctx, ActionCreate, 0, func(tx pgx.Tx) (*User, error) {
+        row := tx.QueryRow(ctx, q, 
+            user.Firstname, user.Lastname, user.Email, user.PassKey, user.Role, actor(ctx))
+
+        // scan 'row' variable to 'User' and return it, error is returned if
+        // scan operation is fail
+        return scanUser(row)
+    })
+}
+
+// Get method will get user data by its ID, deleted user is not found. 'R' part of the CRUD
+func (pool Database) Get(ctx context.Context, id int) (*User, error) {
+    return pool.get(ctx, id, false)
+}
+
+// get will get user 'id', the soft deleted user is only found when
+// 'includeDeleted' is true
+func (pool Database) get(ctx context.Context, id int, includeDeleted bool) (*User, error) {
+    // apply query timeout of Get operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Get)
+    defer cancel()
+
     // sql command to get user record based on its id
-    q := `SELECT * FROM users WHERE id = $1`
+    q := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+    if !includeDeleted {
+        q += ` AND deleted_at IS NULL`
+    }
 
     // execute query and place it return value on 'row' variable
-    row := pool.DB.QueryRow(context.Background(), q, id)
+    row := pool.DB.QueryRow(ctx, q, id)
 
-    // create 'u' variable as User type which will be used as container for
-    // 'row' values 
-    u := new(User)
+    // scan row values to 'User', error is returned if the user is not found
+    return scanUser(row)
+}
 
-    // scan row values and place it in 'u' variable
-    err := row.Scan(
-        &u.ID,
-        &u.Firstname,
-        &u.Lastname,
-        &u.Email,
-        &u.PassKey,
-    )
+// GetByEmail method will get user data by its email regardless of the email
+// case, used to authenticate and to look up the user. deleted user is not
+// found, so it can not log in
+func (pool Database) GetByEmail(ctx context.Context, email string) (*User, error) {
+    // apply query timeout of Get operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Get)
+    defer cancel()
+
+    // lowercased email is unique (users_email_lower_un), so at most one
+    // record is returned and the lookup use the index
+    q := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1) AND deleted_at IS NULL`
+    row := pool.DB.QueryRow(ctx, q, email)
 
-    // return nil and error if error occur while performing 'scan' operation
+    return scanUser(row)
+}
+
+// Gets method will get single page of user data matching 'opts' and the
+// cursor of the next page, empty if it is the last page. extended 'R' part of the CRUD
+func (pool Database) Gets(ctx context.Context, opts ListOptions) ([]*User, string, error) {
+    // validate the options before touching the database
+    lq, err := opts.query()
     if err != nil {
-        return nil, err 
+        return nil, "", err
     }
 
-    // return 'u' variable and nil if no error found while executing the method
-    return u, nil
-}
+    // apply query timeout of Gets operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Gets)
+    defer cancel()
 
-// Gets method will get all user data. extended 'R' part of the CRUD
-func (pool Database) Gets() ([]*User, error) {
-    // sql comand for getting all user data
-    q := `SELECT * FROM users`
+    // build the query, every value is passed as argument
+    q, args := buildGetsQuery(lq)
 
     // execute query
-    rows, err := pool.DB.Query(context.Background(), q)
+    rows, err := pool.DB.Query(ctx, q, args...)
 
     // check if any error occur while executing the query
     if err != nil {
-        return nil, err
+        return nil, "", classifyQueryError(err)
     }
 
     // close rows if error ocur
@@ -126,88 +277,367 @@ func (pool Database) Gets() ([]*User, error) {
     var users []*User
     if rows != nil {
         for rows.Next() {
-            // create 'u' for struct 'User'
-            u := new(User)
-
             // scan rows and place it in 'u' (user) container
-            err := rows.Scan(
-                &u.ID,
-                &u.Firstname,
-                &u.Lastname,
-                &u.Email,
-                &u.PassKey,
-            )
+            u, err := scanUser(rows)
 
             // return nil and error if scan operation fail
             if err!= nil {
-                return nil, err
+                return nil, "", err
             }
 
             // add u to users slice
             users = append(users, u)
         }
+        if err := rows.Err(); err != nil {
+            return nil, "", classifyQueryError(err)
+        }
+    }
+
+    // one extra row is fetched to know whether there is next page
+    var next string
+    if len(users) > lq.Limit {
+        users = users[:lq.Limit]
+        next = lq.nextCursor(users[len(users)-1])
+    }
+
+    // return users slice, the next page cursor and nil for the error
+    return users, next, nil
+}
+
+// buildGetsQuery will build query of Gets and its arguments. the page start
+// after the cursor using keyset comparison on the sort column and id, so the
+// page is stable while users are added or deleted
+func buildGetsQuery(lq listQuery) (string, []interface{}) {
+    var (
+        where []string
+        args  []interface{}
+    )
+    arg := func(v interface{}) string {
+        args = append(args, v)
+        return "$" + strconv.Itoa(len(args))
+    }
+
+    if !lq.IncludeDeleted {
+        where = append(where, "deleted_at IS NULL")
+    }
+    if lq.Email != "" {
+        where = append(where, "lower(email) = lower("+arg(lq.Email)+")")
+    }
+    if lq.NamePrefix != "" {
+        p := arg(escapeLike(lq.NamePrefix) + "%")
+        where = append(where, "(firstname ILIKE "+p+" OR lastname ILIKE "+p+")")
+    }
+    for _, f := range []struct {
+        cond string
+        t    time.Time
+    }{
+        {"created_at >= ", lq.CreatedAfter},
+        {"created_at < ", lq.CreatedBefore},
+        {"updated_at >= ", lq.UpdatedAfter},
+        {"updated_at < ", lq.UpdatedBefore},
+    } {
+        if !f.t.IsZero() {
+            where = append(where, f.cond+arg(f.t))
+        }
     }
 
-    // return users slice and nil for the error
-    return users, nil
+    column, op, dir := sortColumns[lq.field], ">", "ASC"
+    if lq.desc {
+        op, dir = "<", "DESC"
+    }
+    if lq.after != nil {
+        if lq.field == "id" {
+            where = append(where, "id "+op+" "+arg(lq.after.ID))
+        } else {
+            where = append(where, "("+column.expr+", id) "+op+" ("+arg(lq.after.Value)+column.cast+", "+arg(lq.after.ID)+")")
+        }
+    }
+
+    q := `SELECT ` + userColumns + ` FROM users`
+    if len(where) > 0 {
+        q += " WHERE " + strings.Join(where, " AND ")
+    }
+    if lq.field == "id" {
+        q += " ORDER BY id " + dir
+    } else {
+        q += " ORDER BY " + column.expr + " " + dir + ", id " + dir
+    }
+    q += " LIMIT " + arg(lq.Limit+1)
+
+    return q, args
 }
 
-// Update will update user record based on their id
-func (pool Database) Update(id int, user User) (*User, error) {
+// Update will update user record based on their id. non zero user.Version
+// must match the current version, otherwise ErrPreconditionFailed is returned
+func (pool Database) Update(ctx context.Context, id int, user User) (*User, error) {
+    // apply query timeout of Update operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Update)
+    defer cancel()
+
     // prepare update query
     q := `UPDATE users SET 
             firstname = $2,
             lastname  = $3,
             email = $4,
-            passkey = $5
-          WHERE id = $1
-          RETURNING id, firstname, lastname, email, passkey;
-         `
+            passkey = $5,
+            role = COALESCE(NULLIF($6, ''), role),
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $8
+          WHERE id = $1 AND deleted_at IS NULL AND ($7 = 0 OR version = $7)
+          RETURNING ` + userColumns
     // execute update query
-    row := pool.DB.QueryRow(context.Background(), q, id, 
-        user.Firstname, user.Lastname, user.Email, user.PassKey)
-    
-    // create container variable for User
-    u := new(User)
+    // empty role keep the current role of the user
+    u, err := pool.audited(ctx, ActionUpdate, id, func(tx pgx.Tx) (*User, error) {
+        row := tx.QueryRow(ctx, q, id, 
+            user.Firstname, user.Lastname, user.Email, user.PassKey, user.Role, user.Version, actor(ctx))
+
+        // scan data to 'User', error is returned if the user is not found or
+        // its version does not match
+        return scanUser(row)
+    })
+    if err != nil {
+        return nil, pool.checkVersion(ctx, id, user.Version, err)
+    }
 
-    // scan data and place it on 'u' variable we create before and check for error
-    if err := row.Scan(
-        &u.ID,
-        &u.Firstname,
-        &u.Lastname,
-        &u.Email,
-        &u.PassKey,
-    ); err != nil {
-        return nil, err
+    return u, nil
+}
+
+// Patch will update only the column provided by 'patch' of user 'id', the
+// user is returned unchanged if the patch is empty. non zero patch.Version
+// must match the current version, otherwise ErrPreconditionFailed is returned
+func (pool Database) Patch(ctx context.Context, id int, patch UserPatch) (*User, error) {
+    if patch.IsEmpty() {
+        u, err := pool.Get(ctx, id)
+        if err == nil && patch.Version != 0 && u.Version != patch.Version {
+            return nil, ErrPreconditionFailed
+        }
+        return u, err
+    }
+
+    // apply query timeout of Update operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Update)
+    defer cancel()
+
+    // build the query, every value is passed as argument
+    q, args := buildPatchQuery(id, patch, actor(ctx))
+
+    // scan data to 'User', error is returned if the user is not found or
+    // its version does not match
+    u, err := pool.audited(ctx, ActionUpdate, id, func(tx pgx.Tx) (*User, error) {
+        return scanUser(tx.QueryRow(ctx, q, args...))
+    })
+    if err != nil {
+        return nil, pool.checkVersion(ctx, id, patch.Version, err)
     }
 
-    // return variable 'u' as User and nil/ no error
     return u, nil
 }
 
-// Delete method will delete user record based on its 'id'
-func (pool Database) Delete(id int) (*User, error) {
-    // query for deleting user data
-    q := `DELETE FROM users WHERE id = $1 RETURNING id,firstname,lastname,email,passkey;`
+// buildPatchQuery will build UPDATE query setting the column provided by
+// 'patch' and the update time/ actor 'by', the first argument is the user id
+// and the last argument is the expected version
+func buildPatchQuery(id int, patch UserPatch, by interface{}) (string, []interface{}) {
+    var set []string
+    args := []interface{}{id}
+    for _, name := range patchFields {
+        v := *patch.field(name)
+        if v == nil {
+            continue
+        }
+        args = append(args, *v)
+        value := "$" + strconv.Itoa(len(args))
+
+        // removed lastname is stored as NULL
+        if name == "lastname" {
+            value = "NULLIF(" + value + ", '')"
+        }
+        set = append(set, name+" = "+value)
+    }
+
+    args = append(args, by)
+    set = append(set, "version = version + 1", "updated_at = now()", "updated_by = $"+strconv.Itoa(len(args)))
+
+    args = append(args, patch.Version)
+    version := "$" + strconv.Itoa(len(args))
+
+    q := `UPDATE users SET ` + strings.Join(set, ", ") +
+        ` WHERE id = $1 AND deleted_at IS NULL AND (` + version + ` = 0 OR version = ` + version + `) RETURNING ` + userColumns
+
+    return q, args
+}
+
+// UpdatePassKey will replace passkey hash of user 'id' with 'hash', used to
+// rehash the passkey after the hashing parameters changed. the stored row is
+// changed, so the version and the update time/ actor are bumped as any update
+func (pool Database) UpdatePassKey(ctx context.Context, id int, hash string) error {
+    // apply query timeout of Update operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Update)
+    defer cancel()
+
+    q := `UPDATE users SET
+            passkey = $2,
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NULL
+          RETURNING ` + userColumns
+    _, err := pool.audited(ctx, ActionRehash, id, func(tx pgx.Tx) (*User, error) {
+        return scanUser(tx.QueryRow(ctx, q, id, hash, actor(ctx)))
+    })
+
+    return err
+}
+
+// Delete method will soft delete user record based on its 'id', the row is
+// kept until it is purged. non zero 'version' must match the current version,
+// otherwise ErrPreconditionFailed is returned
+func (pool Database) Delete(ctx context.Context, id, version int) (*User, error) {
+    // apply query timeout of Delete operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Delete)
+    defer cancel()
+
+    // query for marking the user deleted, deleting is also an update of the user
+    q := `UPDATE users SET
+            deleted_at = now(),
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+          RETURNING ` + userColumns
     
-    // execute query
-    row := pool.DB.QueryRow(context.Background(), q, id)
+    // execute query, scan deleted record. error is returned if the user is
+    // not found, already deleted or its version does not match
+    u, err := pool.audited(ctx, ActionDelete, id, func(tx pgx.Tx) (*User, error) {
+        return scanUser(tx.QueryRow(ctx, q, id, version, actor(ctx)))
+    })
+    if err != nil {
+        return nil, pool.checkVersion(ctx, id, version, err)
+    }
 
-    // create container variable for User
-    u := new(User)
+    return u, nil
+}
 
-    // if error occur, return the error
-    if err := row.Scan(
-        &u.ID,
-        &u.Firstname,
-        &u.Lastname,
-        &u.Email,
-        &u.PassKey,
-    ); err != nil {
+// Restore will undo soft delete of user 'id'. user which is not deleted is
+// returned unchanged. non zero 'version' must match the current version,
+// otherwise ErrPreconditionFailed is returned
+func (pool Database) Restore(ctx context.Context, id, version int) (*User, error) {
+    // apply query timeout of Update operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Update)
+    defer cancel()
+
+    q := `UPDATE users SET
+            deleted_at = NULL,
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NOT NULL AND ($2 = 0 OR version = $2)
+          RETURNING ` + userColumns
+    u, err := pool.audited(ctx, ActionRestore, id, func(tx pgx.Tx) (*User, error) {
+        return scanUser(tx.QueryRow(ctx, q, id, version, actor(ctx)))
+    })
+    if err == nil || !errors.Is(err, ErrNotFound) {
+        return u, err
+    }
+
+    // the user does not exist, is not deleted or its version does not match
+    cur, gErr := pool.get(ctx, id, true)
+    switch {
+    case gErr != nil:
+        return nil, err
+    case version != 0 && cur.Version != version:
+        return nil, ErrPreconditionFailed
+    case cur.DeletedAt == nil:
+        return cur, nil
+    default:
         return nil, err
     }
+}
 
-    // return nil if no error found
-    return u, nil
+// Purge will permanently delete user soft deleted before 'before' and get
+// the number of purged user, the audit entry of each user is written by the
+// same statement
+func (pool Database) Purge(ctx context.Context, before time.Time) (int64, error) {
+    // apply query timeout of Delete operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Delete)
+    defer cancel()
+
+    q := `WITH purged AS (DELETE FROM users WHERE deleted_at < $1 RETURNING id)
+          INSERT INTO account_audit (user_id,action) SELECT id, '` + ActionPurge + `' FROM purged`
+    tag, err := pool.DB.Exec(ctx, q, before)
+    if err != nil {
+        return 0, classifyQueryError(err)
+    }
+
+    return tag.RowsAffected(), nil
+}
+
+// History will get single page of audit entries of user 'id' matching
+// 'opts', the newest entry first, and the cursor of the next page. the
+// entries are kept after the user is purged, ErrNotFound is returned when
+// the user never existed
+func (pool Database) History(ctx context.Context, id int, opts HistoryOptions) ([]*AuditEntry, string, error) {
+    // validate the options before touching the database
+    opts, after, err := opts.query()
+    if err != nil {
+        return nil, "", err
+    }
+
+    // apply query timeout of Gets operation
+    ctx, cancel := pool.Timeouts.withTimeout(ctx, pool.Timeouts.Gets)
+    defer cancel()
+
+    // one extra row is fetched to know whether there is next page
+    q := `SELECT id, user_id, actor_id, action, changes, COALESCE(request_id, ''), created_at
+          FROM account_audit WHERE user_id = $1`
+    args := []interface{}{id}
+    if after != 0 {
+        args = append(args, after)
+        q += ` AND id < $2`
+    }
+    args = append(args, opts.Limit+1)
+    q += ` ORDER BY id DESC LIMIT $` + strconv.Itoa(len(args))
+
+    rows, err := pool.DB.Query(ctx, q, args...)
+    if err != nil {
+        return nil, "", classifyQueryError(err)
+    }
+    defer rows.Close()
+
+    var entries []*AuditEntry
+    for rows.Next() {
+        e := new(AuditEntry)
+        var changes []byte
+        if err := rows.Scan(&e.ID, &e.UserID, &e.ActorID, &e.Action, &changes, &e.RequestID, &e.CreatedAt); err != nil {
+            return nil, "", classifyQueryError(err)
+        }
+        if err := json.Unmarshal(changes, &e.Changes); err != nil {
+            return nil, "", err
+        }
+        entries = append(entries, e)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, "", classifyQueryError(err)
+    }
+
+    // user without any entry may not exist at all, purged user keep its
+    // entries so it is still found
+    if len(entries) == 0 && after == 0 {
+        var exists bool
+        q = `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`
+        if err := pool.DB.QueryRow(ctx, q, id).Scan(&exists); err != nil {
+            return nil, "", classifyQueryError(err)
+        }
+        if !exists {
+            return nil, "", ErrNotFound
+        }
+    }
+
+    var next string
+    if len(entries) > opts.Limit {
+        entries = entries[:opts.Limit]
+        next = historyCursor(entries[len(entries)-1])
+    }
 
+    return entries, next, nil
 }
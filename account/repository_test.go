@@ -6,17 +6,21 @@
 package account
 
 import (
+	"context"
 	"errors"
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/pashagolub/pgxmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
     // prepare mock
-    colums = []string{"id","firstname","lastname","email","passkey"}
+    colums = []string{"id","firstname","lastname","email","passkey","role","version","created_at","updated_at","created_by","updated_by","deleted_at"}
 
     // expected
     want = &User{
@@ -24,9 +28,16 @@ var (
         Firstname: "John",
         Lastname : "Doe",
         Email : "john@doe.com",
-        PassKey: "secret",
+        PassKey: "secret123",
+        Role: RoleUser,
+        Version: 1,
+        CreatedAt: testTime,
+        UpdatedAt: testTime,
     }
 
+    // creation/ update time of the expected user
+    testTime = time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
 )
 
 // Run will prepare our pgxmock connection interface
@@ -41,22 +52,50 @@ func Run(t *testing.T) pgxmock.PgxPoolIface{
     return mock
 }
 
+// userRows will get mocked rows of userColumns holding 'u'
+func userRows(mock pgxmock.PgxPoolIface, u *User) *pgxmock.Rows {
+    return mock.NewRows(colums).AddRow(u.ID, u.Firstname, u.Lastname, u.Email, u.PassKey, u.Role,
+        u.Version, u.CreatedAt, u.UpdatedAt, u.CreatedBy, u.UpdatedBy, u.DeletedAt)
+}
+
+// expectBegin will expect the audited mutation to begin its transaction and
+// lock 'before', the user before the mutation. nil 'before' is creation
+func expectBegin(mock pgxmock.PgxPoolIface, before *User) {
+    mock.ExpectBegin()
+    if before != nil {
+        mock.ExpectQuery(regexp.QuoteMeta(lockUserQuery)).
+            WithArgs(before.ID).
+            WillReturnRows(userRows(mock, before))
+    }
+}
+
+// expectAudit will expect audit entry of 'action' on user 'id' made by 'by'
+// to be written and the transaction to be committed
+func expectAudit(mock pgxmock.PgxPoolIface, id int, action string, by interface{}) {
+    mock.ExpectExec(regexp.QuoteMeta(auditQuery)).
+        WithArgs(id, by, action, pgxmock.AnyArg(), "").
+        WillReturnResult(pgxmock.NewResult("INSERT", 1))
+    mock.ExpectCommit()
+}
+
 // TestCreate will test our Create user method
 func TestCreate(t *testing.T) {
     mock := Run(t)
-    q := `INSERT INTO users (firstname,lastname,email,passkey) 
-          VALUES ($1,$2,$3,$4) RETURNING id,firstname,lastname,email,passkey`
+    q := `INSERT INTO users (firstname,lastname,email,passkey,role,created_by,updated_by) 
+          VALUES ($1,$2,$3,$4,$5,$6,$6) RETURNING ` + userColumns
     
     // Success
     t.Run("SUCCESS", func(t *testing.T){
+        expectBegin(mock, nil)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
-            WithArgs(want.Firstname,want.Lastname,want.Email,want.PassKey).
+            WithArgs(want.Firstname,want.Lastname,want.Email,want.PassKey,want.Role,nil).
             WillReturnRows(mock.NewRows(colums).
-                AddRow(want.ID,want.Firstname,want.Lastname,want.Email,want.PassKey))
+                AddRow(want.ID,want.Firstname,want.Lastname,want.Email,want.PassKey, want.Role, want.Version, testTime, testTime, nil, nil, nil))
+        expectAudit(mock, want.ID, ActionCreate, nil)
 
         // actual
         ops := NewDatabase(mock)
-        got, err := ops.Create(*want)
+        got, err := ops.Create(context.Background(), *want)
 
         assert.NoError(t, err)
         assert.NotNil(t, got)
@@ -64,14 +103,35 @@ func TestCreate(t *testing.T) {
         assert.Equal(t, got, want)
     })
 
+    // the authenticated caller is recorded as creator and last updater
+    t.Run("EXPECT SUCCESS created by caller", func(t *testing.T){
+        by := 7
+        expectBegin(mock, nil)
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.Firstname,want.Lastname,want.Email,want.PassKey,want.Role,by).
+            WillReturnRows(mock.NewRows(colums).
+                AddRow(want.ID,want.Firstname,want.Lastname,want.Email,want.PassKey, want.Role, want.Version, testTime, testTime, &by, &by, nil))
+        expectAudit(mock, want.ID, ActionCreate, by)
+
+        // actual
+        ctx := WithCaller(context.Background(), Caller{ID: by, Role: RoleAdmin})
+        got, err := NewDatabase(mock).Create(ctx, *want)
+
+        assert.NoError(t, err)
+        assert.Equal(t, &by, got.CreatedBy)
+        assert.Equal(t, &by, got.UpdatedBy)
+    })
+
     // Test expecting fail/ error
     t.Run("EXPECT FAIL", func(t *testing.T){
+        expectBegin(mock, nil)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
             WillReturnError(errors.New("error inserting user record"))
+        mock.ExpectRollback()
 
         // actual
         ops := NewDatabase(mock)
-        got, err := ops.Create(*want)
+        got, err := ops.Create(context.Background(), *want)
 
         // validation & verification
         assert.Error(t, err)
@@ -86,17 +146,17 @@ func TestCreate(t *testing.T) {
 // TestGet will test get one data from database
 func TestGet(t *testing.T) {
     mock := Run(t)
-    q := `SELECT * FROM users WHERE id = $1`
+    q := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
 
     t.Run("EXPECT SUCCESS", func(t *testing.T){
         mock.ExpectQuery(regexp.QuoteMeta(q)).
             WithArgs(1).
             WillReturnRows(mock.NewRows(colums).
-            AddRow(1, "John", "Doe", "john@doe.com", "secret"))
+            AddRow(1, "John", "Doe", "john@doe.com", "secret123", RoleUser, 1, testTime, testTime, nil, nil, nil))
 
         // actual
         ops := NewDatabase(mock)
-        got, err := ops.Get(1) 
+        got, err := ops.Get(context.Background(), 1) 
 
         assert.NoError(t, err)
         assert.Equal(t, got.ID, want.ID)
@@ -110,13 +170,200 @@ func TestGet(t *testing.T) {
 
         // actual
         ops := NewDatabase(mock)
-        got, err := ops.Get(1) 
+        got, err := ops.Get(context.Background(), 1) 
 
         assert.Error(t, err)
         assert.Nil(t, got)
         // assert.NotEqual(t, got, want)
     })
 
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(9).
+            WillReturnError(pgx.ErrNoRows)
+
+        // actual
+        ops := NewDatabase(mock)
+        got, err := ops.Get(context.Background(), 9)
+
+        assert.True(t, errors.Is(err, ErrNotFound))
+        assert.True(t, errors.Is(err, pgx.ErrNoRows))
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT FAIL query timeout", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(1).
+            WillDelayFor(time.Second).
+            WillReturnRows(mock.NewRows(colums))
+
+        // actual
+        ops := NewDatabase(mock).WithTimeouts(QueryTimeouts{Default: time.Second, Get: time.Millisecond * 10})
+        start := time.Now()
+        got, err := ops.Get(context.Background(), 1)
+
+        assert.ErrorIs(t, err, context.DeadlineExceeded)
+        assert.Nil(t, got)
+        assert.Less(t, time.Since(start), time.Second)
+    })
+
+    t.Run("EXPECT FAIL context cancelled", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(1).
+            WillDelayFor(time.Second).
+            WillReturnRows(mock.NewRows(colums))
+
+        // actual, cancelled request context
+        ctx, cancel := context.WithCancel(context.Background())
+        cancel()
+        ops := NewDatabase(mock)
+        got, err := ops.Get(ctx, 1)
+
+        assert.ErrorIs(t, err, context.Canceled)
+        assert.Nil(t, got)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
+// TestGetByEmail will test get user data by its email
+func TestGetByEmail(t *testing.T) {
+    mock := Run(t)
+    q := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1) AND deleted_at IS NULL`
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.Email).
+            WillReturnRows(mock.NewRows(colums).
+            AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, testTime, testTime, nil, nil, nil))
+
+        // actual
+        ops := NewDatabase(mock)
+        got, err := ops.GetByEmail(context.Background(), want.Email)
+
+        assert.NoError(t, err)
+        assert.Equal(t, got, want)
+    })
+
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs("nobody@doe.com").
+            WillReturnError(pgx.ErrNoRows)
+
+        // actual
+        ops := NewDatabase(mock)
+        got, err := ops.GetByEmail(context.Background(), "nobody@doe.com")
+
+        assert.True(t, errors.Is(err, ErrNotFound))
+        assert.Nil(t, got)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
+// TestBuildGetsQuery will test the filter and keyset condition of Gets query
+func TestBuildGetsQuery(t *testing.T) {
+    after := &cursor{Sort: "lastname", Value: "doe", ID: 1}
+    cases := []struct {
+        name  string
+        query listQuery
+        want  string
+        args  []interface{}
+    }{
+        {
+            "EXPECT SUCCESS first page",
+            listQuery{ListOptions: ListOptions{Limit: 20}, field: "id"},
+            `SELECT ` + userColumns + ` FROM users WHERE deleted_at IS NULL ORDER BY id ASC LIMIT $1`,
+            []interface{}{21},
+        },
+        {
+            "EXPECT SUCCESS include deleted",
+            listQuery{ListOptions: ListOptions{Limit: 20, IncludeDeleted: true}, field: "id"},
+            `SELECT ` + userColumns + ` FROM users ORDER BY id ASC LIMIT $1`,
+            []interface{}{21},
+        },
+        {
+            "EXPECT SUCCESS id cursor descending",
+            listQuery{ListOptions: ListOptions{Limit: 20}, field: "id", desc: true, after: &cursor{ID: 5}},
+            `SELECT ` + userColumns + ` FROM users WHERE deleted_at IS NULL AND id < $1 ORDER BY id DESC LIMIT $2`,
+            []interface{}{5, 21},
+        },
+        {
+            "EXPECT SUCCESS filter and cursor",
+            listQuery{
+                ListOptions: ListOptions{Limit: 10, Email: "John@Doe.com", NamePrefix: "jo%"},
+                field: "lastname", after: after,
+            },
+            `SELECT ` + userColumns + ` FROM users WHERE deleted_at IS NULL AND lower(email) = lower($1) AND (firstname ILIKE $2 OR lastname ILIKE $2) ` +
+            `AND (COALESCE(lastname, ''), id) > ($3, $4) ORDER BY COALESCE(lastname, '') ASC, id ASC LIMIT $5`,
+            []interface{}{"John@Doe.com", `jo\%%`, "doe", 1, 11},
+        },
+        {
+            "EXPECT SUCCESS time filter and timestamp cursor",
+            listQuery{
+                ListOptions: ListOptions{Limit: 10, CreatedAfter: testTime, UpdatedBefore: testTime},
+                field: "created_at", desc: true,
+                after: &cursor{Sort: "-created_at", Value: formatTime(testTime), ID: 4},
+            },
+            `SELECT ` + userColumns + ` FROM users WHERE deleted_at IS NULL AND created_at >= $1 AND updated_at < $2 ` +
+            `AND (created_at, id) < ($3::text::timestamptz, $4) ORDER BY created_at DESC, id DESC LIMIT $5`,
+            []interface{}{testTime, testTime, "2022-01-02T03:04:05Z", 4, 11},
+        },
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T) {
+            q, args := buildGetsQuery(tt.query)
+            assert.Equal(t, tt.want, q)
+            assert.Equal(t, tt.args, args)
+        })
+    }
+}
+
+// TestUpdatePassKey will test replacing passkey hash of the user
+func TestUpdatePassKey(t *testing.T) {
+    mock := Run(t)
+    q := `UPDATE users SET
+            passkey = $2,
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NULL
+          RETURNING ` + userColumns
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        rehashed := *want
+        rehashed.PassKey = "new-hash"
+        rehashed.Version = want.Version + 1
+        expectBegin(mock, want)
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(1, "new-hash", nil).
+            WillReturnRows(userRows(mock, &rehashed))
+        expectAudit(mock, 1, ActionRehash, nil)
+
+        // actual
+        err := NewDatabase(mock).UpdatePassKey(context.Background(), 1, "new-hash")
+
+        assert.NoError(t, err)
+    })
+
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(lockUserQuery)).
+            WithArgs(9).
+            WillReturnError(pgx.ErrNoRows)
+        mock.ExpectRollback()
+
+        // actual
+        err := NewDatabase(mock).UpdatePassKey(context.Background(), 9, "new-hash")
+
+        assert.True(t, errors.Is(err, ErrNotFound))
+    })
+
     if err := mock.ExpectationsWereMet(); err != nil {
         t.Errorf("there were unfulfilled expectation: %v\n", err)
     }
@@ -128,13 +375,13 @@ func TestGets(t *testing.T) {
     mock := Run(t)
 
     // query to get all user data
-    q := `SELECT * FROM users`
+    q := `SELECT ` + userColumns + ` FROM users`
     
     // for success test
     users := []*User{
-        {1, "john", "doe", "john@doe.com", "secret"},
-        {2, "jhonny", "the snail", "jhonny@snail.com", "cretse"},
-        {3, "donny", "trumpy", "donny@trumpy", "nohair"},
+        {1, "john", "doe", "john@doe.com", "secret", RoleAdmin, 1, testTime, testTime, nil, nil, nil},
+        {2, "jhonny", "the snail", "jhonny@snail.com", "cretse", RoleUser, 1, testTime, testTime, nil, nil, nil},
+        {3, "donny", "trumpy", "donny@trumpy", "nohair", RoleUser, 1, testTime, testTime, nil, nil, nil},
     }
 
     // SUCCESS test
@@ -143,25 +390,65 @@ func TestGets(t *testing.T) {
         WillReturnRows(mock.NewRows(colums).
             AddRow(
                 users[0].ID, users[0].Firstname,users[0].Lastname,
-                users[0].Email, users[0].PassKey,
+                users[0].Email, users[0].PassKey, users[0].Role, 1, testTime, testTime, nil, nil, nil,
             ).
             AddRow(
                 users[1].ID, users[1].Firstname,users[1].Lastname,
-                users[1].Email, users[1].PassKey,
+                users[1].Email, users[1].PassKey, users[1].Role, 1, testTime, testTime, nil, nil, nil,
             ).
             AddRow(
                 users[2].ID, users[2].Firstname,users[2].Lastname,
-                users[2].Email, users[2].PassKey,
+                users[2].Email, users[2].PassKey, users[2].Role, 1, testTime, testTime, nil, nil, nil,
             ),
         )
 
         ops := NewDatabase(mock)
-        got, err := ops.Gets()
+        got, next, err := ops.Gets(context.Background(), ListOptions{})
 
         assert.NoError(t, err)
         assert.NotNil(t, got)
         assert.Equal(t, got[0], users[0])
         assert.Equal(t, got, users)
+        assert.Empty(t, next)
+    })
+
+    // SUCCESS test with next page, one extra row is fetched and trimmed
+    t.Run("EXPECT SUCCESS next page", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q + ` WHERE deleted_at IS NULL ORDER BY firstname DESC, id DESC LIMIT $1`)).
+        WithArgs(3).
+        WillReturnRows(mock.NewRows(colums).
+            AddRow(
+                users[0].ID, users[0].Firstname,users[0].Lastname,
+                users[0].Email, users[0].PassKey, users[0].Role, 1, testTime, testTime, nil, nil, nil,
+            ).
+            AddRow(
+                users[1].ID, users[1].Firstname,users[1].Lastname,
+                users[1].Email, users[1].PassKey, users[1].Role, 1, testTime, testTime, nil, nil, nil,
+            ).
+            AddRow(
+                users[2].ID, users[2].Firstname,users[2].Lastname,
+                users[2].Email, users[2].PassKey, users[2].Role, 1, testTime, testTime, nil, nil, nil,
+            ),
+        )
+
+        ops := NewDatabase(mock)
+        got, next, err := ops.Gets(context.Background(), ListOptions{Limit: 2, Sort: "-firstname"})
+
+        assert.NoError(t, err)
+        assert.Equal(t, users[:2], got)
+
+        c, err := decodeCursor(next)
+        assert.NoError(t, err)
+        assert.Equal(t, &cursor{Sort: "-firstname", Value: "jhonny", ID: 2}, c)
+    })
+
+    // FAIL test invalid options, the database is not queried
+    t.Run("EXPECT FAIL invalid options", func(t *testing.T){
+        ops := NewDatabase(mock)
+        got, _, err := ops.Gets(context.Background(), ListOptions{Limit: MaxLimit + 1})
+
+        assert.ErrorIs(t, err, ErrValidation)
+        assert.Nil(t, got)
     })
 
     // FAIL test
@@ -172,7 +459,7 @@ func TestGets(t *testing.T) {
        
 
         ops := NewDatabase(mock)
-        got, err := ops.Gets()
+        got, _, err := ops.Gets(context.Background(), ListOptions{})
 
         // verify and validate
         assert.NotNil(t, ops)
@@ -191,21 +478,26 @@ func TestUpdate(t *testing.T) {
             firstname = $2,
             lastname  = $3,
             email = $4,
-            passkey = $5
-          WHERE id = $1
-          RETURNING id, firstname, lastname, email, passkey;
-         `
+            passkey = $5,
+            role = COALESCE(NULLIF($6, ''), role),
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $8
+          WHERE id = $1 AND deleted_at IS NULL AND ($7 = 0 OR version = $7)
+          RETURNING ` + userColumns
 
     // SUCCESS test
     t.Run("EXPECT SUCCESS", func(t *testing.T){
+        expectBegin(mock, want)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
-            WithArgs(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey).
+            WithArgs(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, nil).
             WillReturnRows(mock.NewRows(colums).
-            AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey),
+            AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, testTime, testTime, nil, nil, nil),
         )
+        expectAudit(mock, want.ID, ActionUpdate, nil)
 
         ops := NewDatabase(mock)
-        got, err := ops.Update(want.ID, *want)
+        got, err := ops.Update(context.Background(), want.ID, *want)
 
         // t.Logf("GOT :%v, ERR: %v", got, err)
         assert.NotNil(t, ops)
@@ -217,12 +509,14 @@ func TestUpdate(t *testing.T) {
 
     // FAIL test
     t.Run("EXPECT FAIL", func(t *testing.T){
+        expectBegin(mock, want)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
-            WithArgs(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey).
+            WithArgs(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, nil).
             WillReturnError(errors.New("update user error"))
+        mock.ExpectRollback()
 
         ops := NewDatabase(mock)
-        got, err := ops.Update(want.ID, *want)
+        got, err := ops.Update(context.Background(), want.ID, *want)
 
         // t.Logf("GOT :%v, ERR: %v", got, err)
         assert.NotNil(t, ops)
@@ -235,29 +529,149 @@ func TestUpdate(t *testing.T) {
     }
 }
 
+// TestPatch will test partial update of user
+func TestPatch(t *testing.T) {
+    mock := Run(t)
+    lastname, passkey := "", "hashed"
+    q := `UPDATE users SET lastname = NULLIF($2, ''), passkey = $3, version = version + 1, updated_at = now(), updated_by = $4 WHERE id = $1 AND deleted_at IS NULL AND ($5 = 0 OR version = $5) RETURNING ` + userColumns
+
+    // SUCCESS test, only the provided column is updated
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        expectBegin(mock, want)
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.ID, lastname, passkey, nil, 0).
+            WillReturnRows(mock.NewRows(colums).
+            AddRow(want.ID, want.Firstname, "", want.Email, passkey, want.Role, want.Version, testTime, testTime, nil, nil, nil),
+        )
+        expectAudit(mock, want.ID, ActionUpdate, nil)
+
+        ops := NewDatabase(mock)
+        got, err := ops.Patch(context.Background(), want.ID, UserPatch{Lastname: &lastname, PassKey: &passkey})
+
+        assert.NoError(t, err)
+        assert.Equal(t, &User{want.ID, want.Firstname, "", want.Email, passkey, want.Role, want.Version, testTime, testTime, nil, nil, nil}, got)
+    })
+
+    // SUCCESS test, empty patch get the current user
+    t.Run("EXPECT SUCCESS empty patch", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`)).
+            WithArgs(want.ID).
+            WillReturnRows(mock.NewRows(colums).
+            AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, testTime, testTime, nil, nil, nil),
+        )
+
+        ops := NewDatabase(mock)
+        got, err := ops.Patch(context.Background(), want.ID, UserPatch{})
+
+        assert.NoError(t, err)
+        assert.Equal(t, want, got)
+    })
+
+    // FAIL test
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(lockUserQuery)).
+            WithArgs(100).
+            WillReturnError(pgx.ErrNoRows)
+        mock.ExpectRollback()
+
+        ops := NewDatabase(mock)
+        got, err := ops.Patch(context.Background(), 100, UserPatch{Lastname: &lastname, PassKey: &passkey})
+
+        assert.ErrorIs(t, err, ErrNotFound)
+        assert.Nil(t, got)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
+// TestVersionMismatch will test conditional delete of changed or missing user
+func TestVersionMismatch(t *testing.T) {
+    mock := Run(t)
+    q := `UPDATE users SET
+            deleted_at = now(),
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+          RETURNING ` + userColumns
+    get := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+    // FAIL test, the user exist with other version
+    t.Run("EXPECT FAIL precondition failed", func(t *testing.T){
+        expectBegin(mock, want)
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.ID, 3, nil).
+            WillReturnError(pgx.ErrNoRows)
+        mock.ExpectRollback()
+        mock.ExpectQuery(regexp.QuoteMeta(get)).
+            WithArgs(want.ID).
+            WillReturnRows(mock.NewRows(colums).
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, 4, testTime, testTime, nil, nil, nil),
+            )
+
+        got, err := NewDatabase(mock).Delete(context.Background(), want.ID, 3)
+
+        assert.ErrorIs(t, err, ErrPreconditionFailed)
+        assert.Nil(t, got)
+    })
+
+    // FAIL test, the user does not exist
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(lockUserQuery)).
+            WithArgs(100).
+            WillReturnError(pgx.ErrNoRows)
+        mock.ExpectRollback()
+        mock.ExpectQuery(regexp.QuoteMeta(get)).
+            WithArgs(100).
+            WillReturnError(pgx.ErrNoRows)
+
+        got, err := NewDatabase(mock).Delete(context.Background(), 100, 3)
+
+        assert.ErrorIs(t, err, ErrNotFound)
+        assert.Nil(t, got)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
 // TestDelete will test the Delete method of our repository
 func TestDelete(t *testing.T) {
     mock := Run(t)
 
-    // query for deleting user data
-    // q := `DELETE FROM users WHERE id = $1 RETURNING id`
-    q := `DELETE FROM users WHERE id = $1 RETURNING id,firstname,lastname,email,passkey;`
+    // query for soft deleting user data
+    q := `UPDATE users SET
+            deleted_at = now(),
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+          RETURNING ` + userColumns
 
     // SUCCESS test
     t.Run("EXPECT SUCCESS", func(t *testing.T){
+        expectBegin(mock, want)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
-            WithArgs(1).
+            WithArgs(1, 0, nil).
             WillReturnRows(mock.NewRows(colums).
-                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey),
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version + 1, testTime, testTime, nil, nil, &testTime),
             )
+        expectAudit(mock, want.ID, ActionDelete, nil)
 
         ops := NewDatabase(mock)
-        got, err := ops.Delete(1)
+        got, err := ops.Delete(context.Background(), 1, 0)
 
         assert.NoError(t, err)
         assert.NotNil(t, ops)
-        assert.NotNil(t, got)
-        assert.Equal(t, got, want)
+        if assert.NotNil(t, got) {
+            assert.Equal(t, &testTime, got.DeletedAt)
+            assert.Equal(t, want.Version + 1, got.Version)
+        }
 
         if err := mock.ExpectationsWereMet(); err != nil {
             t.Errorf("there were unfulfilled expectation: %v\n", err)
@@ -266,16 +680,224 @@ func TestDelete(t *testing.T) {
 
     // FAIL Test
     t.Run("EXPECT FAIL", func(t *testing.T){
+        expectBegin(mock, want)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
-            WithArgs(1).
+            WithArgs(1, 0, nil).
             WillReturnError(errors.New("error deleting user"))
+        mock.ExpectRollback()
 
 
         ops := NewDatabase(mock)
-        got, err := ops.Delete(3)
+        got, err := ops.Delete(context.Background(), 1, 0)
 
         assert.Error(t, err)
         assert.NotNil(t, ops)
         assert.Nil(t, got)
     })
 }
+
+// TestRestore will test undoing soft delete of the user
+func TestRestore(t *testing.T) {
+    mock := Run(t)
+    q := `UPDATE users SET
+            deleted_at = NULL,
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NOT NULL AND ($2 = 0 OR version = $2)
+          RETURNING ` + userColumns
+    get := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+    row := func(version int, deletedAt *time.Time) *pgxmock.Rows {
+        return mock.NewRows(colums).
+            AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, version, testTime, testTime, nil, nil, deletedAt)
+    }
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        deleted := *want
+        deleted.DeletedAt = &testTime
+        expectBegin(mock, &deleted)
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.ID, 2, nil).
+            WillReturnRows(row(3, nil))
+        expectAudit(mock, want.ID, ActionRestore, nil)
+
+        got, err := NewDatabase(mock).Restore(context.Background(), want.ID, 2)
+
+        assert.NoError(t, err)
+        if assert.NotNil(t, got) {
+            assert.Nil(t, got.DeletedAt)
+            assert.Equal(t, 3, got.Version)
+        }
+    })
+
+    // restoring user which is not deleted is a no-op
+    t.Run("EXPECT SUCCESS not deleted", func(t *testing.T){
+        expectBegin(mock, want)
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.ID, 0, nil).
+            WillReturnError(pgx.ErrNoRows)
+        mock.ExpectRollback()
+        mock.ExpectQuery(regexp.QuoteMeta(get)).
+            WithArgs(want.ID).
+            WillReturnRows(row(want.Version, nil))
+
+        got, err := NewDatabase(mock).Restore(context.Background(), want.ID, 0)
+
+        assert.NoError(t, err)
+        assert.Equal(t, want, got)
+    })
+
+    t.Run("EXPECT FAIL precondition failed", func(t *testing.T){
+        expectBegin(mock, want)
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.ID, 1, nil).
+            WillReturnError(pgx.ErrNoRows)
+        mock.ExpectRollback()
+        mock.ExpectQuery(regexp.QuoteMeta(get)).
+            WithArgs(want.ID).
+            WillReturnRows(row(2, &testTime))
+
+        got, err := NewDatabase(mock).Restore(context.Background(), want.ID, 1)
+
+        assert.ErrorIs(t, err, ErrPreconditionFailed)
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(lockUserQuery)).
+            WithArgs(100).
+            WillReturnError(pgx.ErrNoRows)
+        mock.ExpectRollback()
+        mock.ExpectQuery(regexp.QuoteMeta(get)).
+            WithArgs(100).
+            WillReturnError(pgx.ErrNoRows)
+
+        got, err := NewDatabase(mock).Restore(context.Background(), 100, 0)
+
+        assert.ErrorIs(t, err, ErrNotFound)
+        assert.Nil(t, got)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
+// TestPurge will test permanently deleting user deleted before the given time
+func TestPurge(t *testing.T) {
+    mock := Run(t)
+    q := `WITH purged AS (DELETE FROM users WHERE deleted_at < $1 RETURNING id)
+          INSERT INTO account_audit (user_id,action) SELECT id, 'purge' FROM purged`
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        mock.ExpectExec(regexp.QuoteMeta(q)).
+            WithArgs(testTime).
+            WillReturnResult(pgxmock.NewResult("INSERT", 2))
+
+        n, err := NewDatabase(mock).Purge(context.Background(), testTime)
+
+        assert.NoError(t, err)
+        assert.Equal(t, int64(2), n)
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T){
+        mock.ExpectExec(regexp.QuoteMeta(q)).
+            WithArgs(testTime).
+            WillReturnError(errors.New("error purging users"))
+
+        n, err := NewDatabase(mock).Purge(context.Background(), testTime)
+
+        assert.Error(t, err)
+        assert.Zero(t, n)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
+// TestHistory will test listing audit entries of the user, newest first
+func TestHistory(t *testing.T) {
+    mock := Run(t)
+    q := `SELECT id, user_id, actor_id, action, changes, COALESCE(request_id, ''), created_at
+          FROM account_audit WHERE user_id = $1`
+    cols := []string{"id", "user_id", "actor_id", "action", "changes", "request_id", "created_at"}
+    by := 7
+
+    t.Run("EXPECT SUCCESS first page with next cursor", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q + ` ORDER BY id DESC LIMIT $2`)).
+            WithArgs(1, 3).
+            WillReturnRows(mock.NewRows(cols).
+                AddRow(int64(3), 1, &by, ActionUpdate, []byte(`{"email":{"before":"john@doe.com","after":"jd@doe.com"}}`), "req-1", testTime).
+                AddRow(int64(2), 1, nil, ActionRehash, []byte(`{"passkey":{"before":"[redacted]","after":"[redacted]"}}`), "", testTime).
+                AddRow(int64(1), 1, nil, ActionCreate, []byte(`{}`), "", testTime),
+            )
+
+        got, next, err := NewDatabase(mock).History(context.Background(), 1, HistoryOptions{Limit: 2})
+
+        require.NoError(t, err)
+        require.Len(t, got, 2)
+        assert.Equal(t, &AuditEntry{
+            ID: 3, UserID: 1, ActorID: &by, Action: ActionUpdate,
+            Changes:   map[string]FieldChange{"email": {Before: "john@doe.com", After: "jd@doe.com"}},
+            RequestID: "req-1", CreatedAt: testTime,
+        }, got[0])
+        assert.Nil(t, got[1].ActorID)
+        assert.Equal(t, historyCursor(got[1]), next)
+    })
+
+    t.Run("EXPECT SUCCESS next page", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q + ` AND id < $2 ORDER BY id DESC LIMIT $3`)).
+            WithArgs(1, int64(2), 3).
+            WillReturnRows(mock.NewRows(cols).
+                AddRow(int64(1), 1, nil, ActionCreate, []byte(`{}`), "", testTime),
+            )
+
+        got, next, err := NewDatabase(mock).History(context.Background(), 1, HistoryOptions{Limit: 2, Cursor: historyCursor(&AuditEntry{ID: 2})})
+
+        require.NoError(t, err)
+        assert.Len(t, got, 1)
+        assert.Empty(t, next)
+    })
+
+    t.Run("EXPECT SUCCESS user without entry", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q + ` ORDER BY id DESC LIMIT $2`)).
+            WithArgs(2, DefaultLimit+1).
+            WillReturnRows(mock.NewRows(cols))
+        mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`)).
+            WithArgs(2).
+            WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(true))
+
+        got, next, err := NewDatabase(mock).History(context.Background(), 2, HistoryOptions{})
+
+        assert.NoError(t, err)
+        assert.Empty(t, got)
+        assert.Empty(t, next)
+    })
+
+    t.Run("EXPECT FAIL unknown user", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q + ` ORDER BY id DESC LIMIT $2`)).
+            WithArgs(100, DefaultLimit+1).
+            WillReturnRows(mock.NewRows(cols))
+        mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`)).
+            WithArgs(100).
+            WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(false))
+
+        got, _, err := NewDatabase(mock).History(context.Background(), 100, HistoryOptions{})
+
+        assert.ErrorIs(t, err, ErrNotFound)
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT FAIL invalid option", func(t *testing.T){
+        got, _, err := NewDatabase(mock).History(context.Background(), 1, HistoryOptions{Cursor: "garbage"})
+
+        assert.ErrorIs(t, err, ErrValidation)
+        assert.Nil(t, got)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
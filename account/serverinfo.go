@@ -0,0 +1,127 @@
+/*
+    package account
+    serverinfo.go
+    - database server information collected while connecting to the database
+*/
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ServerInfo is information about the connected database server
+type ServerInfo struct {
+    Database   string `json:"database"`
+    User       string `json:"user"`
+
+    // Version is server version as reported by the server, eg "14.1"
+    Version    string `json:"version"`
+
+    // VersionNum is server version number, eg 140001 for 14.1 and 90624 for 9.6.24
+    VersionNum int    `json:"version_num"`
+
+    // Major and Minor is parsed from VersionNum, minor is the patch release for
+    // version 10 and above (14.1 is major 14 minor 1), while for version below
+    // 10 the major release is two part (9.6.24 is major 9 minor 6)
+    Major      int    `json:"major"`
+    Minor      int    `json:"minor"`
+
+    Encoding   string `json:"encoding"`
+    TimeZone   string `json:"timezone"`
+
+    // HotStandby is true if the server is read only replica in recovery mode
+    HotStandby bool   `json:"hot_standby"`
+}
+
+// AtLeast will report whether server version is equal or newer than major.minor
+func (si ServerInfo) AtLeast(major, minor int) bool {
+    if si.Major != major {
+        return si.Major > major
+    }
+    return si.Minor >= minor
+}
+
+// FetchServerInfo will query server information from the database
+func FetchServerInfo(ctx context.Context, db PgxIface) (*ServerInfo, error) {
+    q := `SELECT current_database(), current_user,
+            current_setting('server_version'),
+            current_setting('server_version_num')::int,
+            current_setting('server_encoding'),
+            current_setting('TimeZone'),
+            pg_is_in_recovery();`
+
+    info := new(ServerInfo)
+    err := db.QueryRow(ctx, q).Scan(
+        &info.Database,
+        &info.User,
+        &info.Version,
+        &info.VersionNum,
+        &info.Encoding,
+        &info.TimeZone,
+        &info.HotStandby,
+    )
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, &ConnError{Kind: ErrConnection, Err: err}
+	case err != nil:
+		return nil, classifyConnError(err)
+	}
+
+    info.Major, info.Minor = parseServerVersionNum(info.VersionNum)
+
+    return info, nil
+}
+
+// parseServerVersionNum will split server_version_num into major and minor version
+func parseServerVersionNum(num int) (major, minor int) {
+    // version 10 and above, eg 140001 is 14.1
+    if num >= 100000 {
+        return num / 10000, num % 10000
+    }
+
+    // version below 10, eg 90624 is 9.6.24
+    return num / 10000, (num / 100) % 100
+}
+
+// serverVersion is parsed minimum server version
+type serverVersion struct {
+    major int
+    minor int
+}
+
+// String will format server version as "major.minor"
+func (v serverVersion) String() string {
+    return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// parseMinServerVersion will parse "major" or "major.minor" version string
+func parseMinServerVersion(s string) (serverVersion, error) {
+    var v serverVersion
+    if s == "" {
+        return v, nil
+    }
+
+    parts := strings.SplitN(s, ".", 2)
+    major, err := strconv.Atoi(parts[0])
+    if err != nil || major < 0 {
+        return v, fmt.Errorf("invalid minimum server version %q", s)
+    }
+    v.major = major
+
+    if len(parts) == 2 {
+        minor, err := strconv.Atoi(parts[1])
+        if err != nil || minor < 0 {
+            return v, fmt.Errorf("invalid minimum server version %q", s)
+        }
+        v.minor = minor
+    }
+
+    return v, nil
+}
@@ -0,0 +1,153 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+    // server info query and its columns
+    serverInfoQuery = `SELECT current_database(), current_user,`
+    serverInfoColumns = []string{
+        "current_database", "current_user", "server_version", "server_version_num",
+        "server_encoding", "TimeZone", "pg_is_in_recovery",
+    }
+)
+
+// TestParseServerVersionNum will test parsing server_version_num
+func TestParseServerVersionNum(t *testing.T) {
+    cases := []struct{
+        num   int
+        major int
+        minor int
+    }{
+        {140001, 14, 1},
+        {100000, 10, 0},
+        {120012, 12, 12},
+        {90624, 9, 6},
+        {90500, 9, 5},
+    }
+
+    for _, tt := range cases {
+        major, minor := parseServerVersionNum(tt.num)
+        assert.Equal(t, tt.major, major)
+        assert.Equal(t, tt.minor, minor)
+    }
+}
+
+// TestParseMinServerVersion will test parsing minimum server version setting
+func TestParseMinServerVersion(t *testing.T) {
+    cases := []struct{
+        name    string
+        version string
+        want    serverVersion
+        wantErr bool
+    }{
+        {"EXPECT SUCCESS empty", "", serverVersion{}, false},
+        {"EXPECT SUCCESS major", "12", serverVersion{12, 0}, false},
+        {"EXPECT SUCCESS major minor", "9.6", serverVersion{9, 6}, false},
+        {"EXPECT FAIL not a number", "twelve", serverVersion{}, true},
+        {"EXPECT FAIL invalid minor", "9.x", serverVersion{}, true},
+        {"EXPECT FAIL negative", "-1", serverVersion{}, true},
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := parseMinServerVersion(tt.version)
+            if tt.wantErr {
+                assert.Error(t, err)
+                return
+            }
+            assert.NoError(t, err)
+            assert.Equal(t, tt.want, got)
+        })
+    }
+}
+
+// TestServerInfoAtLeast will test server version comparison
+func TestServerInfoAtLeast(t *testing.T) {
+    info := ServerInfo{Major: 12, Minor: 4}
+
+    assert.True(t, info.AtLeast(0, 0))
+    assert.True(t, info.AtLeast(10, 0))
+    assert.True(t, info.AtLeast(12, 4))
+    assert.False(t, info.AtLeast(12, 5))
+    assert.False(t, info.AtLeast(13, 0))
+}
+
+// TestValidateDBPool will test database validation and server info collection
+func TestValidateDBPool(t *testing.T) {
+    mock, err := pgxmock.NewPool(pgxmock.MonitorPingsOption(true))
+    if err != nil {
+        t.Fatalf("error creating stub connection: %v\n", err)
+    }
+    defer mock.Close()
+
+    // EXPECT SUCCESS
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        mock.ExpectPing()
+        mock.ExpectQuery(regexp.QuoteMeta(serverInfoQuery)).
+            WillReturnRows(mock.NewRows(serverInfoColumns).
+                AddRow("golangtest", "golang", "14.1", 140001, "UTF8", "UTC", false))
+
+        got, err := validateDBPool(context.Background(), mock, serverVersion{10, 0})
+
+        assert.NoError(t, err)
+        assert.Equal(t, &ServerInfo{
+            Database:   "golangtest",
+            User:       "golang",
+            Version:    "14.1",
+            VersionNum: 140001,
+            Major:      14,
+            Minor:      1,
+            Encoding:   "UTF8",
+            TimeZone:   "UTC",
+            HotStandby: false,
+        }, got)
+    })
+
+    // EXPECT FAIL unsupported server version
+    t.Run("EXPECT FAIL unsupported version", func(t *testing.T) {
+        mock.ExpectPing()
+        mock.ExpectQuery(regexp.QuoteMeta(serverInfoQuery)).
+            WillReturnRows(mock.NewRows(serverInfoColumns).
+                AddRow("golangtest", "golang", "9.6.24", 90624, "UTF8", "UTC", true))
+
+        got, err := validateDBPool(context.Background(), mock, serverVersion{10, 0})
+
+        assert.Nil(t, got)
+        assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+        assert.Contains(t, err.Error(), "9.6.24")
+    })
+
+    // EXPECT FAIL ping error
+    t.Run("EXPECT FAIL ping", func(t *testing.T) {
+        mock.ExpectPing().WillReturnError(errors.New("connection reset"))
+
+        got, err := validateDBPool(context.Background(), mock, serverVersion{})
+
+        assert.Nil(t, got)
+        assert.True(t, errors.Is(err, ErrConnection))
+    })
+
+    // EXPECT FAIL query error
+    t.Run("EXPECT FAIL query", func(t *testing.T) {
+        mock.ExpectPing()
+        mock.ExpectQuery(regexp.QuoteMeta(serverInfoQuery)).
+            WillReturnError(errors.New("query error"))
+
+        got, err := validateDBPool(context.Background(), mock, serverVersion{})
+
+        assert.Nil(t, got)
+        assert.True(t, errors.Is(err, ErrConnection))
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
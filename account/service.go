@@ -5,29 +5,115 @@
 */
 package account
 
+import (
+	"context"
+	"errors"
+	"log"
+	"pgxtest/problem"
+	"time"
+)
+
 // Interface to Account service
 type AccountService interface {
-    Get(id int) (*UserResponse, error)
-    Gets() ([]*UserResponse, error)
-    Create(user User) (*UserResponse, error)
-    Update(id int, user User) (*UserResponse, error)
-    Delete(id int) (*UserResponse, error)
+    Get(ctx context.Context, id int) (*UserResponse, error)
+    GetByEmail(ctx context.Context, email string) (*UserResponse, error)
+    Gets(ctx context.Context, opts ListOptions) (*UserPage, error)
+    Create(ctx context.Context, user User) (*UserResponse, error)
+    Update(ctx context.Context, id int, user User) (*UserResponse, error)
+    Patch(ctx context.Context, id int, patch UserPatch) (*UserResponse, error)
+    Delete(ctx context.Context, id, version int) (*UserResponse, error)
+    Restore(ctx context.Context, id, version int) (*UserResponse, error)
+    Version(ctx context.Context, id int) (int, error)
+    Purge(ctx context.Context, before time.Time) (int64, error)
+    History(ctx context.Context, id int, opts HistoryOptions) (*AuditPage, error)
+    Authenticate(ctx context.Context, email, passkey string) (*UserResponse, error)
 }
 
 // accountService is wrapper for Database struct
 type accountService struct {
     db Database
+    hasher PasswordHasher
 }
 
-// NewAccountService will create accountService instance
+// NewAccountService will create accountService instance, the passkey is
+// hashed using argon2id with the default parameters
 func NewAccountService(db Database) *accountService{
-    return &accountService{db: db}
+    return &accountService{db: db, hasher: DefaultArgon2id()}
+}
+
+// WithHasher will get copy of the service using 'hasher' to hash the passkey
+func (s *accountService) WithHasher(hasher PasswordHasher) *accountService {
+    svc := *s
+    svc.hasher = hasher
+    return &svc
+}
+
+// validator will get validator of the user input, the passkey is limited to
+// what the configured hasher use without truncating it
+func (s *accountService) validator() *validator {
+    return &validator{maxPassKeyBytes: maxPassKeyBytes(s.hasher)}
+}
+
+// hashPassKey will replace plain passkey of 'user' with its hash, so the
+// plain passkey never reach the database
+func (s *accountService) hashPassKey(user User) (User, error) {
+    hash, err := s.hasher.Hash(user.PassKey)
+    if err != nil {
+        return user, err
+    }
+    user.PassKey = hash
+
+    return user, nil
+}
+
+// checkRole will make sure the caller of 'ctx' may assign 'role' to a user.
+// only admin may assign role other than its own role, operation without
+// caller (eg from the command line) is trusted
+func checkRole(ctx context.Context, role string) error {
+    switch role {
+    case "":
+        return nil
+    case RoleUser, RoleAdmin:
+    default:
+        return &ValidationError{Fields: []problem.FieldError{
+            {Field: "role", Message: "must be " + RoleUser + " or " + RoleAdmin},
+        }}
+    }
+
+    caller, ok := CallerFrom(ctx)
+    if !ok || caller.IsAdmin() || caller.Role == role {
+        return nil
+    }
+
+    return ErrForbidden
 }
 
 // Create method will send create record request to datastore/ repository
-func (s *accountService) Create(user User) (*UserResponse, error) {
+func (s *accountService) Create(ctx context.Context, user User) (*UserResponse, error) {
+    // normalize and validate the input, every failing field is reported
+    user.Normalize()
+    v := s.validator()
+    user.validate(v)
+    if err := v.err(); err != nil {
+        return nil, err
+    }
+
+    // new user get the user role unless the role is given by admin
+    if err := checkRole(ctx, user.Role); err != nil {
+        return nil, err
+    }
+    if user.Role == "" {
+        user.Role = RoleUser
+    }
+
+    // hash the passkey before storing it
+    user, err := s.hashPassKey(user)
+    if err != nil {
+        return nil, err
+    }
+
     // call Create from repository/ datasstore
-    u, err := s.db.Create(user)
+    u, err := s.db.Create(ctx, user)
 
     // if error occur, return nil rfor the response as well as return the error
     if err != nil {
@@ -38,9 +124,9 @@ func (s *accountService) Create(user User) (*UserResponse, error) {
 }
 
 // Get method will get user record by id from repository/ datastore
-func (s *accountService) Get(id int) (*UserResponse, error) {
+func (s *accountService) Get(ctx context.Context, id int) (*UserResponse, error) {
     // call Get from repository/ datastore
-    user, err := s.db.Get(id)
+    user, err := s.db.Get(ctx, id)
 
     // if error occur, return nil rfor the response as well as return the error
     if err != nil {
@@ -51,36 +137,75 @@ func (s *accountService) Get(id int) (*UserResponse, error) {
     return UserToUserResponse(*user), nil 
 }
 
-// Gets method will get all user record from repository/ datastore
-func (s *accountService) Gets() ([]*UserResponse, error) {
-    // Call Gets from repository/ datastore to retreive all User record
-    users, err := s.db.Gets()
+// GetByEmail method will get user record by email from repository/ datastore,
+// the email case is ignored
+func (s *accountService) GetByEmail(ctx context.Context, email string) (*UserResponse, error) {
+    // call GetByEmail from repository/ datastore
+    user, err := s.db.GetByEmail(ctx, NormalizeEmail(email))
 
-    // if error occur, return nil for the response slice as well as return the error
+    // if error occur, return nil for the response as well as return the error
     if err != nil {
         return nil, err
     }
 
-    // if no error found, convert all 'User' record to UserResponse dto 
-    var uRes []*UserResponse
+    // return the user response DTO and nil for the error
+    return UserToUserResponse(*user), nil
+}
+
+// Gets method will get single page of user record matching 'opts' from
+// repository/ datastore
+func (s *accountService) Gets(ctx context.Context, opts ListOptions) (*UserPage, error) {
+    // deleted user is only listed for admin, operation without caller is trusted
+    if caller, ok := CallerFrom(ctx); opts.IncludeDeleted && ok && !caller.IsAdmin() {
+        return nil, ErrForbidden
+    }
+
+    // Call Gets from repository/ datastore to retreive the page of User record
+    users, next, err := s.db.Gets(ctx, opts)
+
+    // if error occur, return nil for the response page as well as return the error
+    if err != nil {
+        return nil, err
+    }
+
+    // if no error found, convert all 'User' record to UserResponse dto. empty
+    // page is responded as [] instead of null
+    uRes := make([]*UserResponse, 0, len(users))
     for _, user := range users {
         uRes = append(uRes, UserToUserResponse(*user))
     }
 
-    // return response slice and nil if no error found
-    return uRes, nil
+    // return response page and nil if no error found
+    return &UserPage{Users: uRes, NextCursor: next}, nil
 }
 
 // Update will send update request to datastore/ repository
-func (s *accountService) Update(id int, user User) (*UserResponse, error) {
-    // check if user data is valid
-    // field 'firstname', 'email', and 'passkey' is required
-    if err := user.IsValid(); err != nil {
+func (s *accountService) Update(ctx context.Context, id int, user User) (*UserResponse, error) {
+    // check if user data is valid, the id of the body is optional but must
+    // match 'id' when it is given
+    user.Normalize()
+    v := s.validator()
+    if user.ID != 0 && user.ID != id {
+        v.add("id", "must match the id of the path")
+    }
+    user.validate(v)
+    if err := v.err(); err != nil {
+        return nil, err
+    }
+
+    // empty role keep the current role
+    if err := checkRole(ctx, user.Role); err != nil {
+        return nil, err
+    }
+
+    // hash the new passkey before storing it
+    user, err := s.hashPassKey(user)
+    if err != nil {
         return nil, err
     }
 
     // call Update method from repository/ datastore to update certain record
-    u, err := s.db.Update(id, user)
+    u, err := s.db.Update(ctx, id, user)
 
     // return nil and the error if error occur
     if err != nil {
@@ -91,11 +216,47 @@ func (s *accountService) Update(id int, user User) (*UserResponse, error) {
     return UserToUserResponse(*u), nil
 }
 
-// Delete method will send request to delete record to datastore/ repository
-// based on user 'id'
-func (s *accountService) Delete(id int) (*UserResponse, error) {
+// Patch will send partial update request to datastore/ repository, only the
+// field provided by 'patch' is changed
+func (s *accountService) Patch(ctx context.Context, id int, patch UserPatch) (*UserResponse, error) {
+    // provided field is validated using the same rule as create and update
+    patch.Normalize()
+    v := s.validator()
+    patch.validate(v)
+    if err := v.err(); err != nil {
+        return nil, err
+    }
+
+    if patch.Role != nil {
+        if err := checkRole(ctx, *patch.Role); err != nil {
+            return nil, err
+        }
+    }
+
+    // hash the new passkey before storing it
+    if patch.PassKey != nil {
+        hash, err := s.hasher.Hash(*patch.PassKey)
+        if err != nil {
+            return nil, err
+        }
+        patch.PassKey = &hash
+    }
+
+    // call Patch method from repository/ datastore to update certain column
+    u, err := s.db.Patch(ctx, id, patch)
+    if err != nil {
+        return nil, err
+    }
+
+    // return user response dto and nil for the error
+    return UserToUserResponse(*u), nil
+}
+
+// Delete method will send request to soft delete record to datastore/
+// repository based on user 'id'. non zero 'version' must match the current version
+func (s *accountService) Delete(ctx context.Context, id, version int) (*UserResponse, error) {
     // call Delete method from repository/ datastore
-    u, err := s.db.Delete(id)
+    u, err := s.db.Delete(ctx, id, version)
 
     // check if error occur while executing Delete method
     if err != nil {
@@ -106,12 +267,109 @@ func (s *accountService) Delete(id int) (*UserResponse, error) {
     return UserToUserResponse(*u), nil
 }
 
+// Restore method will send request to undo soft delete of user 'id' to
+// datastore/ repository. non zero 'version' must match the current version
+func (s *accountService) Restore(ctx context.Context, id, version int) (*UserResponse, error) {
+    u, err := s.db.Restore(ctx, id, version)
+    if err != nil {
+        return nil, err
+    }
+
+    return UserToUserResponse(*u), nil
+}
+
+// Version method will get current version of user 'id', soft deleted user
+// included, so If-Match listing several entity tags can be checked before
+// the conditional operation
+func (s *accountService) Version(ctx context.Context, id int) (int, error) {
+    u, err := s.db.get(ctx, id, true)
+    if err != nil {
+        return 0, err
+    }
+
+    return u.Version, nil
+}
+
+// Purge method will permanently delete user soft deleted before 'before'
+// and get the number of purged user
+func (s *accountService) Purge(ctx context.Context, before time.Time) (int64, error) {
+    return s.db.Purge(ctx, before)
+}
+
+// History method will get single page of audit entries of user 'id' from
+// repository/ datastore, the newest entry first
+func (s *accountService) History(ctx context.Context, id int, opts HistoryOptions) (*AuditPage, error) {
+    entries, next, err := s.db.History(ctx, id, opts)
+    if err != nil {
+        return nil, err
+    }
+
+    // empty page is responded as [] instead of null
+    if entries == nil {
+        entries = []*AuditEntry{}
+    }
+
+    return &AuditPage{Entries: entries, NextCursor: next}, nil
+}
+
+// Authenticate will verify 'passkey' of user with 'email'. ErrInvalidCredentials
+// is returned if the email does not exist or the passkey does not match. the
+// passkey is rehashed when it was hashed using other algorithm or parameters
+func (s *accountService) Authenticate(ctx context.Context, email, passkey string) (*UserResponse, error) {
+    user, err := s.db.GetByEmail(ctx, NormalizeEmail(email))
+    if errors.Is(err, ErrNotFound) {
+        // hash the passkey anyway, so unknown email take about the same time
+        // as wrong passkey and can not be discovered from the response time
+        s.hasher.Hash(passkey)
+        return nil, ErrInvalidCredentials
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    // passkey stored in plaintext by the older version is not a valid hash,
+    // treat it as mismatch so the passkey must be reset
+    ok, err := verifierFor(user.PassKey, s.hasher).Verify(user.PassKey, passkey)
+    if err != nil && !errors.Is(err, ErrInvalidHash) {
+        return nil, err
+    }
+    if !ok {
+        return nil, ErrInvalidCredentials
+    }
+
+    // failing to rehash must not fail the login, it is retried on the next login
+    if s.hasher.NeedsRehash(user.PassKey) {
+        if err := s.rehashPassKey(ctx, user.ID, passkey); err != nil {
+            log.Printf("rehashing passkey of user %d: %v\n", user.ID, err)
+        }
+    }
+
+    return UserToUserResponse(*user), nil
+}
+
+// rehashPassKey will store new hash of 'passkey' for user 'id'
+func (s *accountService) rehashPassKey(ctx context.Context, id int, passkey string) error {
+    hash, err := s.hasher.Hash(passkey)
+    if err != nil {
+        return err
+    }
+
+    return s.db.UpdatePassKey(ctx, id, hash)
+}
+
 // UserResponse is to response the client/request with 'user' data
 type UserResponse struct {
-    ID        int       `json:"id"`
-    Firstname string    `json:"first_name"`
-    Lastname  string    `json:"last_name,omitempty"`
-    Email     string    `json:"email"`
+    ID        int        `json:"id"`
+    Firstname string     `json:"first_name"`
+    Lastname  string     `json:"last_name,omitempty"`
+    Email     string     `json:"email"`
+    Role      string     `json:"role"`
+    Version   int        `json:"version"`
+    CreatedAt time.Time  `json:"created_at"`
+    UpdatedAt time.Time  `json:"updated_at"`
+    CreatedBy *int       `json:"created_by,omitempty"`
+    UpdatedBy *int       `json:"updated_by,omitempty"`
+    DeletedAt *time.Time `json:"deleted_at,omitempty"`
     /*
     // must be hidden and not exposed
     password string 
@@ -125,5 +383,21 @@ func UserToUserResponse(u User) *UserResponse{
         Firstname : u.Firstname,
         Lastname : u.Lastname,
         Email : u.Email,
+        Role : u.Role,
+        Version : u.Version,
+        CreatedAt : u.CreatedAt.UTC(),
+        UpdatedAt : u.UpdatedAt.UTC(),
+        CreatedBy : u.CreatedBy,
+        UpdatedBy : u.UpdatedBy,
+        DeletedAt : utcTime(u.DeletedAt),
+    }
+}
+
+// utcTime will get copy of 't' in UTC, nil if 't' is nil
+func utcTime(t *time.Time) *time.Time {
+    if t == nil {
+        return nil
     }
+    utc := t.UTC()
+    return &utc
 }
@@ -6,14 +6,29 @@
 package account
 
 import (
+	"context"
 	"errors"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/pashagolub/pgxmock"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// testHasher is PasswordHasher for the test, the hash is predictable so it
+// can be used as query argument expectation
+type testHasher struct{}
+
+func testHash(password string) string { return "hashed:" + password }
+
+func (testHasher) Hash(password string) (string, error) { return testHash(password), nil }
+func (testHasher) Verify(encoded, password string) (bool, error) { return encoded == testHash(password), nil }
+func (testHasher) NeedsRehash(encoded string) bool { return false }
+
 // Setup will prepare mock and account service instance
 func Setup(t *testing.T) (pgxmock.PgxPoolIface, accountService){
     t.Helper()
@@ -25,7 +40,7 @@ func Setup(t *testing.T) (pgxmock.PgxPoolIface, accountService){
     defer mock.Close()
 
     db := NewDatabase(mock)
-    svc := NewAccountService(db)
+    svc := NewAccountService(db).WithHasher(testHasher{})
 
     assert.NotNil(t, db)
     assert.NotNil(t, svc)
@@ -39,19 +54,21 @@ func TestAccountServiceCreate(t *testing.T) {
     mock, service := Setup(t)
 
     // sql for inserting new record
-    q := `INSERT INTO users (firstname,lastname,email,passkey)
-          VALUES ($1,$2,$3,$4) RETURNING id,firstname,lastname,email,passkey`
+    q := `INSERT INTO users (firstname,lastname,email,passkey,role,created_by,updated_by)
+          VALUES ($1,$2,$3,$4,$5,$6,$6) RETURNING ` + userColumns
 
     // SUCCESS test
     t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        expectBegin(mock, nil)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
-            WithArgs(want.Firstname, want.Lastname, want.Email, want.PassKey).
+            WithArgs(want.Firstname, want.Lastname, want.Email, testHash(want.PassKey), want.Role, nil).
             WillReturnRows(pgxmock.NewRows(colums).
-                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey),
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, testTime, testTime, nil, nil, nil),
             )
+        expectAudit(mock, want.ID, ActionCreate, nil)
 
         // actual
-        got, err := service.Create(*want)
+        got, err := service.Create(context.Background(), *want)
 
         // validation and verification
         assert.NoError(t, err)
@@ -66,7 +83,7 @@ func TestAccountServiceCreate(t *testing.T) {
             WillReturnError(errors.New("error inserting user record"))
 
         // actual
-        got, err := service.Create(*want)
+        got, err := service.Create(context.Background(), *want)
 
         // validation and verification
         assert.Error(t, err)
@@ -78,18 +95,18 @@ func TestAccountServiceCreate(t *testing.T) {
 func TestAccountServiceGet(t *testing.T) {
     // prepare mock and service
     mock, service := Setup(t)
-    q := `SELECT * FROM users WHERE id = $1`
+    q := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
 
     // SUCCESS test
     t.Run("EXPECT SUCCESS", func(t *testing.T){
         mock.ExpectQuery(regexp.QuoteMeta(q)).
             WithArgs(1).
             WillReturnRows(mock.NewRows(colums).AddRow(
-                want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey,
+                want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, 1, testTime, testTime, nil, nil, nil,
             ))
 
         // actual
-        got, err := service.Get(1)
+        got, err := service.Get(context.Background(), 1)
 
         // validation and verification
         assert.NoError(t, err)
@@ -103,7 +120,7 @@ func TestAccountServiceGet(t *testing.T) {
             WillReturnError(errors.New("user not found"))
 
         // actual
-        got, err := service.Get(3)
+        got, err := service.Get(context.Background(), 3)
 
         // validation and verification
         assert.Error(t, err)
@@ -118,27 +135,27 @@ func TestAccountServiceGet(t *testing.T) {
 // TestAccountServiceGets to test Gets Service from AccountService
 func TestAccountServiceGets(t *testing.T) {
     mock, service := Setup(t)
-    q := `SELECT * FROM users`
+    q := `SELECT ` + userColumns + ` FROM users`
 
     // SUCCESS test
     t.Run("EXPECT SUCCESS", func(t *testing.T){
         mock.ExpectQuery(regexp.QuoteMeta(q)).
             WillReturnRows(mock.NewRows(colums).
-                AddRow(1, "john", "doe", "john@doe.com", "secret").
-                AddRow(2, "donny", "trumpy", "donny@trumpy.com", "nohair"),
+                AddRow(1, "john", "doe", "john@doe.com", "secret", RoleUser, 1, testTime, testTime, nil, nil, nil).
+                AddRow(2, "donny", "trumpy", "donny@trumpy.com", "nohair", RoleUser, 1, testTime, testTime, nil, nil, nil),
             )
 
             want := []*UserResponse{
-                {ID:1,Firstname:"john",Lastname:"doe",Email:"john@doe.com"},
-                {ID:2,Firstname:"donny",Lastname:"trumpy",Email:"donny@trumpy.com"},
+                {ID:1,Firstname:"john",Lastname:"doe",Email:"john@doe.com",Role:RoleUser,Version:1,CreatedAt:testTime,UpdatedAt:testTime},
+                {ID:2,Firstname:"donny",Lastname:"trumpy",Email:"donny@trumpy.com",Role:RoleUser,Version:1,CreatedAt:testTime,UpdatedAt:testTime},
             }
 
         // actual
-        got, err := service.Gets()
+        got, err := service.Gets(context.Background(), ListOptions{})
 
         // validation and verification
         assert.NoError(t, err)
-        assert.Equal(t, got, want)
+        assert.Equal(t, &UserPage{Users: want}, got)
     })
 
     // FAIL test
@@ -147,13 +164,23 @@ func TestAccountServiceGets(t *testing.T) {
             WillReturnError(errors.New("user not found"))
 
         // actual
-        got, err := service.Gets()
+        got, err := service.Gets(context.Background(), ListOptions{})
 
         // validation and verification
         assert.Error(t, err)
         assert.Nil(t, got)
     })
 
+    // FAIL test, only admin may list deleted user
+    t.Run("EXPECT FAIL include deleted by user", func(t *testing.T){
+        ctx := WithCaller(context.Background(), Caller{ID: 2, Role: RoleUser})
+
+        got, err := service.Gets(ctx, ListOptions{IncludeDeleted: true})
+
+        assert.ErrorIs(t, err, ErrForbidden)
+        assert.Nil(t, got)
+    })
+
     if err := mock.ExpectationsWereMet(); err != nil {
         t.Errorf("there were unfulfilled expectation: %v\n", err)
     }
@@ -169,21 +196,26 @@ func TestAccountServiceUpdate(t *testing.T) {
             firstname = $2,
             lastname  = $3,
             email = $4,
-            passkey = $5
-          WHERE id = $1
-          RETURNING id, firstname, lastname, email, passkey;
-         `
+            passkey = $5,
+            role = COALESCE(NULLIF($6, ''), role),
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $8
+          WHERE id = $1 AND deleted_at IS NULL AND ($7 = 0 OR version = $7)
+          RETURNING ` + userColumns
 
     // EXPECT SUCCESS test
     t.Run("EXPECT SUCCESS", func(t *testing.T){
+        expectBegin(mock, want)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
-            WithArgs(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey).
+            WithArgs(want.ID, want.Firstname, want.Lastname, want.Email, testHash(want.PassKey), want.Role, want.Version, nil).
             WillReturnRows(pgxmock.NewRows(colums).
-                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey),
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, testTime, testTime, nil, nil, nil),
             )
+        expectAudit(mock, want.ID, ActionUpdate, nil)
 
         // acctual
-        got, err := service.Update(want.ID, *want)
+        got, err := service.Update(context.Background(), want.ID, *want)
 
         assert.NoError(t, err)
         assert.NotNil(t, got)
@@ -196,12 +228,14 @@ func TestAccountServiceUpdate(t *testing.T) {
 
     // EXPECT FAIL test
     t.Run("EXPECT FAIL", func(t *testing.T){
+        expectBegin(mock, want)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
             // WithArgs(want.ID, want.Firstname,want.Lastname, want.Email, want.PassKey).
             WillReturnError(errors.New("error updating user"))
+        mock.ExpectRollback()
 
         // acctual
-        got, err := service.Update(3, *want)
+        got, err := service.Update(context.Background(), want.ID, *want)
 
         assert.Error(t, err)
         assert.Nil(t, got)
@@ -225,32 +259,109 @@ func TestAccountServiceUpdate(t *testing.T) {
             Email: "",
             PassKey: want.PassKey,
         }
-        got, err := service.Update(3, invalidUserInput)
+        got, err := service.Update(context.Background(), 3, invalidUserInput)
 
         assert.Error(t, err)
-        assert.Equal(t, err, errors.New("user data invalid"))
+        assert.True(t, errors.Is(err, ErrValidation))
+        assert.EqualError(t, err, "validation failed: firstname is required, email is required")
+        assert.Nil(t, got)
+    })
+
+    // EXPECT FAIL id of the body does not match the path
+    t.Run("EXPECT FAIL ID MISMATCH", func(t *testing.T){
+        got, err := service.Update(context.Background(), 3, *want)
+
+        assert.ErrorIs(t, err, ErrValidation)
+        assert.EqualError(t, err, "validation failed: id must match the id of the path")
         assert.Nil(t, got)
     })
 }
 
+// TestAccountServicePatch will test Patch method of the account service layer
+func TestAccountServicePatch(t *testing.T) {
+    // prepare mock and service
+    mock, service := Setup(t)
+    q := `UPDATE users SET passkey = $2, version = version + 1, updated_at = now(), updated_by = $3 WHERE id = $1 AND deleted_at IS NULL AND ($4 = 0 OR version = $4) RETURNING ` + userColumns
+
+    // EXPECT SUCCESS test, the new passkey is hashed
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        passkey := "newsecret1"
+        expectBegin(mock, want)
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.ID, testHash(passkey), nil, 0).
+            WillReturnRows(pgxmock.NewRows(colums).
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, testHash(passkey), want.Role, want.Version, testTime, testTime, nil, nil, nil),
+            )
+        expectAudit(mock, want.ID, ActionUpdate, nil)
+
+        got, err := service.Patch(context.Background(), want.ID, UserPatch{PassKey: &passkey})
+
+        assert.NoError(t, err)
+        assert.Equal(t, UserToUserResponse(*want), got)
+    })
+
+    // EXPECT FAIL INVALID INPUT test, the database is not queried
+    t.Run("EXPECT FAIL INVALID INPUT", func(t *testing.T){
+        empty := ""
+        got, err := service.Patch(context.Background(), want.ID, UserPatch{Email: &empty})
+
+        assert.ErrorIs(t, err, ErrValidation)
+        assert.EqualError(t, err, "validation failed: email is required")
+        assert.Nil(t, got)
+    })
+
+    // EXPECT FAIL passkey longer than bcrypt use, the database is not queried
+    t.Run("EXPECT FAIL bcrypt passkey too long", func(t *testing.T){
+        passkey := strings.Repeat("a1", 37)
+        svc := service.WithHasher(BcryptHasher{Cost: bcrypt.MinCost})
+        got, err := svc.Patch(context.Background(), want.ID, UserPatch{PassKey: &passkey})
+
+        assert.ErrorIs(t, err, ErrValidation)
+        assert.EqualError(t, err, "validation failed: passkey must be at most 72 bytes")
+        assert.Nil(t, got)
+    })
+
+    // EXPECT FAIL non admin changing the role
+    t.Run("EXPECT FAIL forbidden role", func(t *testing.T){
+        role := RoleAdmin
+        ctx := WithCaller(context.Background(), Caller{ID: want.ID, Role: RoleUser})
+        got, err := service.Patch(ctx, want.ID, UserPatch{Role: &role})
+
+        assert.ErrorIs(t, err, ErrForbidden)
+        assert.Nil(t, got)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
 // TestAccountServiceDelete will test Delete method of account service layer
 func TestAccountServiceDelete(t *testing.T) {
     // prepare mock and service
     mock, service := Setup(t)
 
-    // query for deleting user data
-    q := `DELETE FROM users WHERE id = $1 RETURNING id,firstname,lastname,email,passkey;`
+    // query for soft deleting user data
+    q := `UPDATE users SET
+            deleted_at = now(),
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+          RETURNING ` + userColumns
 
     // EXPECT SUCCESS test 
     t.Run("EXPECT SUCCESS", func(t *testing.T){
+        expectBegin(mock, want)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
-            WithArgs(want.ID).
+            WithArgs(want.ID, 0, nil).
             WillReturnRows(pgxmock.NewRows(colums).
-                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey),
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, testTime, testTime, nil, nil, nil),
             )
+        expectAudit(mock, want.ID, ActionDelete, nil)
 
         // actual
-        got, err := service.Delete(want.ID)
+        got, err := service.Delete(context.Background(), want.ID, 0)
 
         // verify and validate
         assert.NoError(t, err)
@@ -258,12 +369,14 @@ func TestAccountServiceDelete(t *testing.T) {
     })
 
     // EXPECT FAIL test 
-    t.Run("EXPECT SUCCESS", func(t *testing.T){
+    t.Run("EXPECT FAIL", func(t *testing.T){
+        expectBegin(mock, want)
         mock.ExpectQuery(regexp.QuoteMeta(q)).
             WillReturnError(errors.New("error deleting data"))
+        mock.ExpectRollback()
 
         // actual
-        got, err := service.Delete(5)
+        got, err := service.Delete(context.Background(), want.ID, 0)
 
         // verify and validate
         assert.Error(t, err)
@@ -275,6 +388,213 @@ func TestAccountServiceDelete(t *testing.T) {
     }
 }
 
+// TestAccountServiceVersion will test Version method of account service layer
+func TestAccountServiceVersion(t *testing.T) {
+    mock, service := Setup(t)
+    q := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+
+    // EXPECT SUCCESS soft deleted user has version too
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.ID).
+            WillReturnRows(mock.NewRows(colums).AddRow(
+                want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, 4, testTime, testTime, nil, nil, &testTime,
+            ))
+
+        got, err := service.Version(context.Background(), want.ID)
+
+        assert.NoError(t, err)
+        assert.Equal(t, 4, got)
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(7).
+            WillReturnError(pgx.ErrNoRows)
+
+        _, err := service.Version(context.Background(), 7)
+
+        assert.ErrorIs(t, err, ErrNotFound)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
+// TestAccountServiceGetByEmail will test GetByEmail method of account service layer
+func TestAccountServiceGetByEmail(t *testing.T) {
+    // prepare mock and service
+    mock, service := Setup(t)
+    q := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1) AND deleted_at IS NULL`
+
+    // EXPECT SUCCESS test, the email is normalized before the lookup
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.Email).
+            WillReturnRows(pgxmock.NewRows(colums).
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, want.PassKey, want.Role, want.Version, testTime, testTime, nil, nil, nil),
+            )
+
+        got, err := service.GetByEmail(context.Background(), " John@Doe.com")
+
+        assert.NoError(t, err)
+        assert.Equal(t, UserToUserResponse(*want), got)
+    })
+
+    // EXPECT FAIL test
+    t.Run("EXPECT FAIL not found", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs("nobody@doe.com").
+            WillReturnError(pgx.ErrNoRows)
+
+        got, err := service.GetByEmail(context.Background(), "nobody@doe.com")
+
+        assert.ErrorIs(t, err, ErrNotFound)
+        assert.Nil(t, got)
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
+// TestAccountServiceAuthenticate will test Authenticate method of account service layer
+func TestAccountServiceAuthenticate(t *testing.T) {
+    // prepare mock and service
+    mock, service := Setup(t)
+
+    q := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1) AND deleted_at IS NULL`
+    updateQ := `UPDATE users SET
+            passkey = $2,
+            version = version + 1,
+            updated_at = now(),
+            updated_by = $3
+          WHERE id = $1 AND deleted_at IS NULL
+          RETURNING ` + userColumns
+
+    // EXPECT SUCCESS test
+    t.Run("EXPECT SUCCESS", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.Email).
+            WillReturnRows(pgxmock.NewRows(colums).
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, testHash(want.PassKey), want.Role, want.Version, testTime, testTime, nil, nil, nil),
+            )
+
+        // actual
+        got, err := service.Authenticate(context.Background(), want.Email, want.PassKey)
+
+        // verify and validate
+        assert.NoError(t, err)
+        assert.Equal(t, got, UserToUserResponse(*want))
+    })
+
+    // EXPECT FAIL wrong passkey test
+    t.Run("EXPECT FAIL wrong passkey", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.Email).
+            WillReturnRows(pgxmock.NewRows(colums).
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, testHash(want.PassKey), want.Role, want.Version, testTime, testTime, nil, nil, nil),
+            )
+
+        // actual
+        got, err := service.Authenticate(context.Background(), want.Email, "wrong")
+
+        // verify and validate
+        assert.ErrorIs(t, err, ErrInvalidCredentials)
+        assert.Nil(t, got)
+    })
+
+    // EXPECT FAIL unknown email test
+    t.Run("EXPECT FAIL unknown email", func(t *testing.T){
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs("nobody@doe.com").
+            WillReturnError(pgx.ErrNoRows)
+
+        // actual
+        got, err := service.Authenticate(context.Background(), "nobody@doe.com", want.PassKey)
+
+        // verify and validate
+        assert.ErrorIs(t, err, ErrInvalidCredentials)
+        assert.Nil(t, got)
+    })
+
+    // EXPECT SUCCESS rehash test, passkey hashed with bcrypt is verified and
+    // rehashed with the configured argon2id hasher
+    t.Run("EXPECT SUCCESS rehash", func(t *testing.T){
+        hash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash(want.PassKey)
+        assert.NoError(t, err)
+
+        hasher := Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+        svc := service.WithHasher(hasher)
+
+        mock.ExpectQuery(regexp.QuoteMeta(q)).
+            WithArgs(want.Email).
+            WillReturnRows(pgxmock.NewRows(colums).
+                AddRow(want.ID, want.Firstname, want.Lastname, want.Email, hash, want.Role, want.Version, testTime, testTime, nil, nil, nil),
+            )
+        stored := *want
+        stored.PassKey = hash
+        expectBegin(mock, &stored)
+        mock.ExpectQuery(regexp.QuoteMeta(updateQ)).
+            WithArgs(want.ID, pgxmock.AnyArg(), nil).
+            WillReturnRows(userRows(mock, want))
+        expectAudit(mock, want.ID, ActionRehash, nil)
+
+        // actual
+        got, err := svc.Authenticate(context.Background(), want.Email, want.PassKey)
+
+        // verify and validate
+        assert.NoError(t, err)
+        assert.Equal(t, got, UserToUserResponse(*want))
+    })
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unfulfilled expectation: %v\n", err)
+    }
+}
+
+// TestCheckRole will test role assignment rule of the caller
+func TestCheckRole(t *testing.T) {
+    admin := WithCaller(context.Background(), Caller{ID: 1, Role: RoleAdmin})
+    user := WithCaller(context.Background(), Caller{ID: 2, Role: RoleUser})
+
+    cases := []struct{
+        name string
+        ctx  context.Context
+        role string
+        want error
+    }{
+        {"EXPECT SUCCESS empty role", user, "", nil},
+        {"EXPECT SUCCESS own role", user, RoleUser, nil},
+        {"EXPECT SUCCESS admin assign admin", admin, RoleAdmin, nil},
+        {"EXPECT SUCCESS without caller", context.Background(), RoleAdmin, nil},
+        {"EXPECT FAIL user assign admin", user, RoleAdmin, ErrForbidden},
+        {"EXPECT FAIL unknown role", admin, "root", ErrValidation},
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T){
+            err := checkRole(tt.ctx, tt.role)
+            if tt.want == nil {
+                assert.NoError(t, err)
+            } else {
+                assert.ErrorIs(t, err, tt.want)
+            }
+        })
+    }
+
+    t.Run("EXPECT FAIL update own role", func(t *testing.T){
+        _, service := Setup(t)
+        u := *want
+        u.Role = RoleAdmin
+
+        got, err := service.Update(user, u.ID, u)
+        assert.ErrorIs(t, err, ErrForbidden)
+        assert.Nil(t, got)
+    })
+}
+
 // TestUserToUserResponse is to test UserToUserResponse function
 func TestUserToUserResponse(t *testing.T) {
     u := User{
@@ -291,4 +611,11 @@ func TestUserToUserResponse(t *testing.T) {
     assert.Equal(t, got.Firstname, "john")
     assert.Equal(t, got.Lastname, "doe")
     assert.Equal(t, got.Email, "john@doe.com")
+    assert.Nil(t, got.DeletedAt)
+
+    // deleted time is converted to UTC
+    deletedAt := time.Date(2022, 1, 2, 10, 4, 5, 0, time.FixedZone("WIB", 7*60*60))
+    u.DeletedAt = &deletedAt
+    got = UserToUserResponse(u)
+    assert.Equal(t, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC), *got.DeletedAt)
 }
@@ -0,0 +1,128 @@
+/*
+    package account
+    validate.go
+    - validation and normalization of user input. every failing field is
+      collected, so the client get all field errors at once
+*/
+package account
+
+import (
+	"net/mail"
+	"pgxtest/problem"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// length limit of the user field, matching the users table column
+const (
+    maxNameLength  = 30
+    maxEmailLength = 75
+)
+
+// passkey strength policy, the maximum length bound the hashing cost
+const (
+    minPassKeyLength = 8
+    maxPassKeyLength = 128
+)
+
+// validator will collect field errors of single input
+type validator struct {
+    fields []problem.FieldError
+
+    // maxPassKeyBytes is the longest passkey in bytes the password hasher
+    // use without truncating it, zero means no limit (see maxPassKeyBytes)
+    maxPassKeyBytes int
+}
+
+// add will add failure of 'field'
+func (v *validator) add(field, message string) {
+    v.fields = append(v.fields, problem.FieldError{Field: field, Message: message})
+}
+
+// err will get *ValidationError listing every failure, nil if there is none
+func (v *validator) err() error {
+    if len(v.fields) == 0 {
+        return nil
+    }
+    return &ValidationError{Fields: v.fields}
+}
+
+// NormalizeEmail will trim 'email' and lowercase it, so the same address
+// written in other case is the same user
+func NormalizeEmail(email string) string {
+    return strings.ToLower(strings.TrimSpace(email))
+}
+
+// name will validate first name or last name 'value' of 'field'. the name
+// must start with a letter and contain only letter, space, apostrophe,
+// hyphen or period
+func (v *validator) name(field, value string, required bool) {
+    if value == "" {
+        if required {
+            v.add(field, "is required")
+        }
+        return
+    }
+    if utf8.RuneCountInString(value) > maxNameLength {
+        v.add(field, "must be at most "+strconv.Itoa(maxNameLength)+" characters")
+        return
+    }
+
+    for i, r := range value {
+        if unicode.IsLetter(r) || (i > 0 && (unicode.IsMark(r) || strings.ContainsRune(" '-.", r))) {
+            continue
+        }
+        v.add(field, "must start with a letter and contain only letters, spaces, apostrophes, hyphens or periods")
+        return
+    }
+}
+
+// email will validate normalized 'email', display name or comment is not allowed
+func (v *validator) email(email string) {
+    if email == "" {
+        v.add("email", "is required")
+        return
+    }
+    if len(email) > maxEmailLength {
+        v.add("email", "must be at most "+strconv.Itoa(maxEmailLength)+" characters")
+        return
+    }
+
+    addr, err := mail.ParseAddress(email)
+    if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndexByte(email, '@'):], ".") {
+        v.add("email", "must be a valid email address")
+    }
+}
+
+// passKey will validate plain 'passkey' against the strength policy
+func (v *validator) passKey(passkey string) {
+    if passkey == "" {
+        v.add("passkey", "is required")
+        return
+    }
+
+    n := utf8.RuneCountInString(passkey)
+    if n < minPassKeyLength || n > maxPassKeyLength {
+        v.add("passkey", "must be between "+strconv.Itoa(minPassKeyLength)+" and "+
+            strconv.Itoa(maxPassKeyLength)+" characters")
+        return
+    }
+    if v.maxPassKeyBytes > 0 && len(passkey) > v.maxPassKeyBytes {
+        v.add("passkey", "must be at most "+strconv.Itoa(v.maxPassKeyBytes)+" bytes")
+        return
+    }
+
+    var letter, other bool
+    for _, r := range passkey {
+        if unicode.IsLetter(r) {
+            letter = true
+        } else {
+            other = true
+        }
+    }
+    if !letter || !other {
+        v.add("passkey", "must contain a letter and a digit or symbol")
+    }
+}
@@ -0,0 +1,62 @@
+/*
+    package account
+    validate_test.go
+    - test the field rule of user input validation
+*/
+package account
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidator will test the name, email and passkey rule
+func TestValidator(t *testing.T) {
+    cases := []struct {
+        name  string
+        check func(v *validator)
+        valid bool
+    }{
+        {"EXPECT VALID name", func(v *validator) { v.name("firstname", "Zoë O'Neil-Smith Jr.", true) }, true},
+        {"EXPECT VALID empty optional name", func(v *validator) { v.name("lastname", "", false) }, true},
+        {"EXPECT INVALID empty required name", func(v *validator) { v.name("firstname", "", true) }, false},
+        {"EXPECT INVALID name digit", func(v *validator) { v.name("firstname", "j0hn", true) }, false},
+        {"EXPECT INVALID name start with space", func(v *validator) { v.name("firstname", " john", true) }, false},
+        {"EXPECT INVALID long name", func(v *validator) { v.name("firstname", strings.Repeat("a", 31), true) }, false},
+        {"EXPECT VALID email", func(v *validator) { v.email("john.doe+test@doe.co.id") }, true},
+        {"EXPECT INVALID email without domain dot", func(v *validator) { v.email("john@doe") }, false},
+        {"EXPECT INVALID email display name", func(v *validator) { v.email("John <john@doe.com>") }, false},
+        {"EXPECT INVALID email", func(v *validator) { v.email("john.doe.com") }, false},
+        {"EXPECT INVALID long email", func(v *validator) { v.email(strings.Repeat("a", 70) + "@doe.com") }, false},
+        {"EXPECT VALID passkey", func(v *validator) { v.passKey("secret123") }, true},
+        {"EXPECT VALID passkey symbol", func(v *validator) { v.passKey("correct horse") }, true},
+        {"EXPECT INVALID short passkey", func(v *validator) { v.passKey("secre1") }, false},
+        {"EXPECT INVALID letter only passkey", func(v *validator) { v.passKey("secretsecret") }, false},
+        {"EXPECT INVALID digit only passkey", func(v *validator) { v.passKey("12345678") }, false},
+        {"EXPECT INVALID long passkey", func(v *validator) { v.passKey(strings.Repeat("a1", 65)) }, false},
+        {"EXPECT VALID passkey within byte limit", func(v *validator) {
+            v.maxPassKeyBytes = bcryptMaxBytes
+            v.passKey(strings.Repeat("a1", 36))
+        }, true},
+        {"EXPECT INVALID passkey over byte limit", func(v *validator) {
+            // 72 characters but 73 bytes
+            v.maxPassKeyBytes = bcryptMaxBytes
+            v.passKey(strings.Repeat("a1", 35) + "éa")
+        }, false},
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T) {
+            v := new(validator)
+            tt.check(v)
+            if tt.valid {
+                assert.NoError(t, v.err())
+            } else {
+                assert.ErrorIs(t, v.err(), ErrValidation)
+                assert.Len(t, v.fields, 1)
+            }
+        })
+    }
+}
@@ -0,0 +1,107 @@
+/*
+    package auth
+    handler.go
+    - handler/ controller layer for auth package, login, refresh and logout
+      endpoint
+*/
+package auth
+
+import (
+	"net/http"
+	"pgxtest/account"
+	"pgxtest/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginRequest is request body of the login endpoint
+type LoginRequest struct {
+    Email   string `json:"email" binding:"required"`
+    PassKey string `json:"passkey" binding:"required"`
+}
+
+// RefreshRequest is request body of the refresh and logout endpoint
+type RefreshRequest struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// authHandler is type wrapper for AuthService interface
+type authHandler struct {
+    Service AuthService
+}
+
+// NewAuthHandler is new instance for authHandler
+func NewAuthHandler(svc AuthService) authHandler {
+    return authHandler{Service: svc}
+}
+
+// LoginHandler will verify the credentials and response with new access and
+// refresh token
+func (h *authHandler) LoginHandler(c *gin.Context) {
+    var req LoginRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        errorResponse(c, invalidBody("email and passkey"))
+        return
+    }
+
+    res, err := h.Service.Login(c.Request.Context(), req.Email, req.PassKey)
+    if err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, res)
+}
+
+// RefreshHandler will rotate the refresh token and response with new access
+// and refresh token
+func (h *authHandler) RefreshHandler(c *gin.Context) {
+    var req RefreshRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        errorResponse(c, invalidBody("refresh_token"))
+        return
+    }
+
+    res, err := h.Service.Refresh(c.Request.Context(), req.RefreshToken)
+    if err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, res)
+}
+
+// LogoutHandler will revoke the refresh token and response with 204/ no content
+func (h *authHandler) LogoutHandler(c *gin.Context) {
+    var req RefreshRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        errorResponse(c, invalidBody("refresh_token"))
+        return
+    }
+
+    if err := h.Service.Logout(c.Request.Context(), req.RefreshToken); err != nil {
+        errorResponse(c, err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
+
+// invalidBody will get validation error of request body that can not be
+// decoded or missing the required 'fields'
+func invalidBody(fields string) error {
+    return &account.ValidationError{Fields: []problem.FieldError{
+        {Field: "body", Message: "must be a json object with " + fields},
+    }}
+}
+
+// errorMapper is account.ErrorMapper extended with the token error
+var errorMapper = account.ErrorMapper.With(
+    problem.Mapping{Err: ErrInvalidToken, Status: http.StatusUnauthorized, Detail: "the credentials or token is invalid"},
+)
+
+// errorResponse will abort the request and response with problem details
+// matching 'err'. server error is logged together with the request id
+func errorResponse(c *gin.Context, err error) {
+    errorMapper.Respond(c, err)
+}
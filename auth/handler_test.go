@@ -0,0 +1,119 @@
+/*
+    package auth
+    handler_test.go
+    - test handler/ controller layer for auth package
+*/
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pgxtest/account"
+	"pgxtest/problem"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockAuthService is AuthService double, "secret" is the only valid passkey
+// and "refresh" the only valid refresh token
+type mockAuthService struct{}
+
+var testTokens = &TokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "next", RefreshExpiresIn: 3600}
+
+func (mockAuthService) Login(ctx context.Context, email, passkey string) (*TokenResponse, error) {
+    if passkey != "secret" {
+        return nil, account.ErrInvalidCredentials
+    }
+    return testTokens, nil
+}
+
+func (mockAuthService) Refresh(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+    if refreshToken != "refresh" {
+        return nil, ErrInvalidToken
+    }
+    return testTokens, nil
+}
+
+func (mockAuthService) Logout(ctx context.Context, refreshToken string) error {
+    if refreshToken == "broken" {
+        return errors.New("database is gone")
+    }
+    return nil
+}
+
+// newTestRouter will prepare router serving the auth endpoint
+func newTestRouter() *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    h := NewAuthHandler(mockAuthService{})
+
+    r := gin.New()
+    r.POST("/login", h.LoginHandler)
+    r.POST("/refresh", h.RefreshHandler)
+    r.POST("/logout", h.LogoutHandler)
+
+    return r
+}
+
+// doRequest will send POST request with json 'body' to 'path'
+func doRequest(t *testing.T, r *gin.Engine, path, body string) *httptest.ResponseRecorder {
+    t.Helper()
+    req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+    req.Header.Set("Content-Type", "application/json")
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+
+    return w
+}
+
+// TestHandlers will test login, refresh and logout endpoint
+func TestHandlers(t *testing.T) {
+    r := newTestRouter()
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        for _, tc := range []struct{ path, body string }{
+            {"/login", `{"email":"john@doe.com","passkey":"secret"}`},
+            {"/refresh", `{"refresh_token":"refresh"}`},
+        } {
+            w := doRequest(t, r, tc.path, tc.body)
+            require.Equal(t, http.StatusOK, w.Code, tc.path)
+
+            var got TokenResponse
+            assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+            assert.Equal(t, *testTokens, got)
+        }
+
+        w := doRequest(t, r, "/logout", `{"refresh_token":"refresh"}`)
+        assert.Equal(t, http.StatusNoContent, w.Code)
+        assert.Empty(t, w.Body.String())
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T) {
+        for _, tc := range []struct {
+            path, body string
+            code       int
+        }{
+            {"/login", `{"email":"john@doe.com","passkey":"wrong"}`, http.StatusUnauthorized},
+            {"/login", `{"email":"john@doe.com"}`, http.StatusBadRequest},
+            {"/login", `not json`, http.StatusBadRequest},
+            {"/refresh", `{"refresh_token":"stolen"}`, http.StatusUnauthorized},
+            {"/refresh", `{}`, http.StatusBadRequest},
+            {"/logout", `{"refresh_token":"broken"}`, http.StatusInternalServerError},
+        } {
+            w := doRequest(t, r, tc.path, tc.body)
+            assert.Equal(t, tc.code, w.Code, tc.path+" "+tc.body)
+            assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+
+            var p problem.Problem
+            assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+            assert.Equal(t, tc.code, p.Status)
+            assert.NotContains(t, w.Body.String(), "database is gone")
+        }
+    })
+}
@@ -0,0 +1,120 @@
+/*
+    package auth
+    middleware.go
+    - gin middleware validating the bearer access token and enforcing the
+      access rule of the route. the caller identity is put into the request
+      context as account.Caller
+*/
+package auth
+
+import (
+	"net/http"
+	"pgxtest/account"
+	"pgxtest/problem"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenParser will verify access token and get its claims, satisfied by TokenIssuer
+type TokenParser interface {
+    Parse(token string) (*Claims, error)
+}
+
+// realm is realm of the WWW-Authenticate challenge
+const realm = "pgxtest"
+
+// Authenticate is middleware requiring valid bearer access token, the
+// request is aborted with 401 if the token is missing or invalid
+func Authenticate(tokens TokenParser) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        header := c.GetHeader("Authorization")
+        if header == "" {
+            unauthorized(c, `Bearer realm="`+realm+`"`, "the request requires a bearer access token")
+            return
+        }
+
+        // scheme is case insensitive (RFC 7235)
+        scheme, token, ok := cutSpace(header)
+        if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+            unauthorized(c, `Bearer realm="`+realm+`", error="invalid_request"`,
+                "the authorization header must use the bearer scheme")
+            return
+        }
+
+        claims, err := tokens.Parse(token)
+        var id int
+        if err == nil {
+            id, err = claims.UserID()
+        }
+        if err != nil {
+            unauthorized(c, `Bearer realm="`+realm+`", error="invalid_token"`, "the access token is invalid or expired")
+            return
+        }
+
+        caller := account.Caller{ID: id, Email: claims.Email, Role: claims.Role}
+        c.Request = c.Request.WithContext(account.WithCaller(c.Request.Context(), caller))
+        c.Next()
+    }
+}
+
+// RequireAdmin is middleware allowing only admin, it must be used after Authenticate
+func RequireAdmin() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        caller, ok := account.CallerFrom(c.Request.Context())
+        if !ok {
+            unauthorized(c, `Bearer realm="`+realm+`"`, "the request requires a bearer access token")
+            return
+        }
+        if !caller.IsAdmin() {
+            forbidden(c)
+            return
+        }
+        c.Next()
+    }
+}
+
+// RequireSelfOrAdmin is middleware allowing admin or the user whose id is the
+// path parameter 'param', it must be used after Authenticate
+func RequireSelfOrAdmin(param string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        caller, ok := account.CallerFrom(c.Request.Context())
+        if !ok {
+            unauthorized(c, `Bearer realm="`+realm+`"`, "the request requires a bearer access token")
+            return
+        }
+        if caller.IsAdmin() {
+            c.Next()
+            return
+        }
+
+        // non integer id never match the caller, the handler is not reached
+        if id, err := strconv.Atoi(c.Param(param)); err != nil || id != caller.ID {
+            forbidden(c)
+            return
+        }
+        c.Next()
+    }
+}
+
+// cutSpace will split 'header' into the scheme and its credentials
+func cutSpace(header string) (string, string, bool) {
+    i := strings.IndexByte(header, ' ')
+    if i < 0 {
+        return "", "", false
+    }
+    return header[:i], strings.TrimSpace(header[i+1:]), true
+}
+
+// unauthorized will abort the request with 401 and 'challenge' as the
+// WWW-Authenticate header
+func unauthorized(c *gin.Context, challenge, detail string) {
+    c.Header("WWW-Authenticate", challenge)
+    problem.Write(c, problem.New(http.StatusUnauthorized, detail))
+}
+
+// forbidden will abort the request with 403
+func forbidden(c *gin.Context) {
+    problem.Write(c, problem.New(http.StatusForbidden, "the caller is not allowed to access the resource"))
+}
@@ -0,0 +1,86 @@
+/*
+    package auth
+    middleware_test.go
+    - test bearer token authentication and the access rule middleware
+*/
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pgxtest/account"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newProtectedRouter will prepare router with the account like access rule,
+// the handler response with the caller found in the request context
+func newProtectedRouter(t *testing.T) (*gin.Engine, *TokenIssuer) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    tokens, err := testConfig().TokenIssuer()
+    require.NoError(t, err)
+
+    caller := func(c *gin.Context) {
+        caller, _ := account.CallerFrom(c.Request.Context())
+        c.JSON(http.StatusOK, caller)
+    }
+
+    r := gin.New()
+    g := r.Group("/account", Authenticate(tokens))
+    g.GET("/", RequireAdmin(), caller)
+    g.GET("/:id", RequireSelfOrAdmin("id"), caller)
+
+    return r, tokens
+}
+
+// TestMiddleware will test the authentication and the access rule
+func TestMiddleware(t *testing.T) {
+    r, tokens := newProtectedRouter(t)
+
+    bearer := func(id int, role string) string {
+        token, _, err := tokens.AccessToken(id, "john@doe.com", role)
+        require.NoError(t, err)
+        return "Bearer " + token
+    }
+
+    cases := []struct {
+        name   string
+        path   string
+        header string
+        want   int
+    }{
+        {"EXPECT SUCCESS admin list", "/account/", bearer(1, account.RoleAdmin), http.StatusOK},
+        {"EXPECT SUCCESS admin read other", "/account/2", bearer(1, account.RoleAdmin), http.StatusOK},
+        {"EXPECT SUCCESS user read itself", "/account/2", bearer(2, account.RoleUser), http.StatusOK},
+        {"EXPECT SUCCESS lowercase scheme", "/account/2", "bearer " + bearer(2, account.RoleUser)[7:], http.StatusOK},
+        {"EXPECT FAIL user list", "/account/", bearer(2, account.RoleUser), http.StatusForbidden},
+        {"EXPECT FAIL user read other", "/account/3", bearer(2, account.RoleUser), http.StatusForbidden},
+        {"EXPECT FAIL user non integer id", "/account/abc", bearer(2, account.RoleUser), http.StatusForbidden},
+        {"EXPECT FAIL missing token", "/account/2", "", http.StatusUnauthorized},
+        {"EXPECT FAIL basic scheme", "/account/2", "Basic am9objpzZWNyZXQ=", http.StatusUnauthorized},
+        {"EXPECT FAIL invalid token", "/account/2", "Bearer not.a.token", http.StatusUnauthorized},
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+            if tt.header != "" {
+                req.Header.Set("Authorization", tt.header)
+            }
+            w := httptest.NewRecorder()
+            r.ServeHTTP(w, req)
+
+            assert.Equal(t, tt.want, w.Code)
+            if tt.want == http.StatusUnauthorized {
+                assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+            }
+            if tt.want == http.StatusOK {
+                assert.Contains(t, w.Body.String(), `"Email":"john@doe.com"`)
+            }
+        })
+    }
+}
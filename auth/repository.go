@@ -0,0 +1,141 @@
+/*
+    package auth
+    repository.go
+    - database operation of the refresh token. the token is stored as its hash,
+      rotated on every refresh and revoked on logout
+*/
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pgxtest/account"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Database is refresh token repository wrapping account.PgxIface
+type Database struct {
+    DB account.PgxIface
+
+    // Timeout is maximum duration of each operation, zero means no timeout
+    // other than the deadline of the given context
+    Timeout time.Duration
+}
+
+// NewDatabase will create refresh token repository using 'db'
+func NewDatabase(db account.PgxIface) Database {
+    return Database{DB: db}
+}
+
+// WithTimeout will get copy of the repository using 'timeout' as its query timeout
+func (d Database) WithTimeout(timeout time.Duration) Database {
+    d.Timeout = timeout
+    return d
+}
+
+// withTimeout will derive context of operation with the query timeout
+func (d Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    if d.Timeout <= 0 {
+        return context.WithCancel(ctx)
+    }
+    return context.WithTimeout(ctx, d.Timeout)
+}
+
+// Create will store refresh token 'hash' of user 'userID' valid until 'expiresAt'
+func (d Database) Create(ctx context.Context, userID int, hash string, expiresAt time.Time) error {
+    ctx, cancel := d.withTimeout(ctx)
+    defer cancel()
+
+    q := `INSERT INTO refresh_tokens (user_id,token_hash,expires_at) VALUES ($1,$2,$3)`
+    if _, err := d.DB.Exec(ctx, q, userID, hash, expiresAt); err != nil {
+        return fmt.Errorf("storing refresh token: %w", err)
+    }
+
+    return nil
+}
+
+// Rotate will revoke refresh token 'hash' and store 'newHash' valid until
+// 'expiresAt' in its place, the owner of the token is returned. 'check' is
+// called with the owner while the token is locked, its error roll back the
+// rotation so the token stays usable only while the owner does. reusing
+// rotated token means the token was stolen, so every token of the owner is
+// revoked and the owner must login again. token revoked on logout is only
+// invalid
+func (d Database) Rotate(ctx context.Context, hash, newHash string, expiresAt time.Time, check func(userID int) error) (int, error) {
+    ctx, cancel := d.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := d.DB.Begin(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("rotating refresh token: %w", err)
+    }
+    // rollback is no-op after commit
+    defer tx.Rollback(ctx)
+
+    // lock the token so concurrent refresh using the same token is serialized
+    var (
+        userID    int
+        expires   time.Time
+        revokedAt *time.Time
+        rotatedAt *time.Time
+    )
+    q := `SELECT user_id,expires_at,revoked_at,rotated_at FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+    if err := tx.QueryRow(ctx, q, hash).Scan(&userID, &expires, &revokedAt, &rotatedAt); err != nil {
+        if errors.Is(err, pgx.ErrNoRows) {
+            return 0, ErrInvalidToken
+        }
+        return 0, fmt.Errorf("rotating refresh token: %w", err)
+    }
+
+    if revokedAt != nil && rotatedAt == nil {
+        return 0, ErrInvalidToken
+    }
+    if revokedAt != nil {
+        q = `UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`
+        if _, err := tx.Exec(ctx, q, userID); err != nil {
+            return 0, fmt.Errorf("revoking refresh token of user %d: %w", userID, err)
+        }
+        if err := tx.Commit(ctx); err != nil {
+            return 0, fmt.Errorf("revoking refresh token of user %d: %w", userID, err)
+        }
+        return 0, fmt.Errorf("%w: refresh token reused", ErrInvalidToken)
+    }
+    if !expires.After(time.Now()) {
+        return 0, ErrInvalidToken
+    }
+    if err := check(userID); err != nil {
+        return 0, err
+    }
+
+    q = `UPDATE refresh_tokens SET revoked_at = now(), rotated_at = now() WHERE token_hash = $1`
+    if _, err := tx.Exec(ctx, q, hash); err != nil {
+        return 0, fmt.Errorf("rotating refresh token: %w", err)
+    }
+    q = `INSERT INTO refresh_tokens (user_id,token_hash,expires_at) VALUES ($1,$2,$3)`
+    if _, err := tx.Exec(ctx, q, userID, newHash, expiresAt); err != nil {
+        return 0, fmt.Errorf("rotating refresh token: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return 0, fmt.Errorf("rotating refresh token: %w", err)
+    }
+
+    return userID, nil
+}
+
+// Revoke will revoke refresh token 'hash', revoking unknown or already
+// revoked token is not an error
+func (d Database) Revoke(ctx context.Context, hash string) error {
+    ctx, cancel := d.withTimeout(ctx)
+    defer cancel()
+
+    q := `UPDATE refresh_tokens SET revoked_at = now() WHERE token_hash = $1 AND revoked_at IS NULL`
+    if _, err := d.DB.Exec(ctx, q, hash); err != nil {
+        return fmt.Errorf("revoking refresh token: %w", err)
+    }
+
+    return nil
+}
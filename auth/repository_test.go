@@ -0,0 +1,182 @@
+/*
+    package auth
+    repository_test.go
+    - test refresh token database operation
+*/
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+    // query executed by the refresh token repository
+    insertQuery    = `INSERT INTO refresh_tokens (user_id,token_hash,expires_at) VALUES ($1,$2,$3)`
+    selectQuery    = `SELECT user_id,expires_at,revoked_at,rotated_at FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+    revokeQuery    = `UPDATE refresh_tokens SET revoked_at = now() WHERE token_hash = $1`
+    rotateQuery    = `UPDATE refresh_tokens SET revoked_at = now(), rotated_at = now() WHERE token_hash = $1`
+    revokeAllQuery = `UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`
+
+    tokenColumns = []string{"user_id", "expires_at", "revoked_at", "rotated_at"}
+
+    // allowUser is Rotate check accepting every user
+    allowUser = func(int) error { return nil }
+)
+
+// newTestDatabase will prepare pgxmock pool and refresh token repository
+func newTestDatabase(t *testing.T) (pgxmock.PgxPoolIface, Database) {
+    t.Helper()
+    mock, err := pgxmock.NewPool()
+    if err != nil {
+        t.Fatalf("error creating stub connection: %v\n", err)
+    }
+    t.Cleanup(mock.Close)
+
+    return mock, NewDatabase(mock).WithTimeout(time.Second)
+}
+
+// TestDatabaseCreate will test storing new refresh token
+func TestDatabaseCreate(t *testing.T) {
+    mock, db := newTestDatabase(t)
+    expiresAt := time.Now().Add(time.Hour)
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        mock.ExpectExec(regexp.QuoteMeta(insertQuery)).
+            WithArgs(1, "hash", expiresAt).
+            WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+        err := db.Create(context.Background(), 1, "hash", expiresAt)
+        assert.NoError(t, err)
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T) {
+        mock.ExpectExec(regexp.QuoteMeta(insertQuery)).
+            WithArgs(1, "hash", expiresAt).
+            WillReturnError(errors.New("insert failed"))
+
+        err := db.Create(context.Background(), 1, "hash", expiresAt)
+        assert.Error(t, err)
+    })
+
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDatabaseRotate will test replacing refresh token
+func TestDatabaseRotate(t *testing.T) {
+    mock, db := newTestDatabase(t)
+    expiresAt := time.Now().Add(time.Hour)
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+            WithArgs("old").
+            WillReturnRows(mock.NewRows(tokenColumns).AddRow(1, expiresAt, nil, nil))
+        mock.ExpectExec(regexp.QuoteMeta(rotateQuery)).
+            WithArgs("old").
+            WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+        mock.ExpectExec(regexp.QuoteMeta(insertQuery)).
+            WithArgs(1, "new", expiresAt).
+            WillReturnResult(pgxmock.NewResult("INSERT", 1))
+        mock.ExpectCommit()
+
+        userID, err := db.Rotate(context.Background(), "old", "new", expiresAt, allowUser)
+        assert.NoError(t, err)
+        assert.Equal(t, 1, userID)
+    })
+
+    t.Run("EXPECT FAIL check rolled back", func(t *testing.T) {
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+            WithArgs("old").
+            WillReturnRows(mock.NewRows(tokenColumns).AddRow(1, expiresAt, nil, nil))
+        mock.ExpectRollback()
+
+        _, err := db.Rotate(context.Background(), "old", "new", expiresAt, func(int) error { return ErrInvalidToken })
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+
+    t.Run("EXPECT FAIL unknown token", func(t *testing.T) {
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+            WithArgs("unknown").
+            WillReturnError(pgx.ErrNoRows)
+        mock.ExpectRollback()
+
+        _, err := db.Rotate(context.Background(), "unknown", "new", expiresAt, allowUser)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+
+    t.Run("EXPECT FAIL expired token", func(t *testing.T) {
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+            WithArgs("old").
+            WillReturnRows(mock.NewRows(tokenColumns).AddRow(1, time.Now().Add(-time.Minute), nil, nil))
+        mock.ExpectRollback()
+
+        _, err := db.Rotate(context.Background(), "old", "new", expiresAt, allowUser)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+
+    t.Run("EXPECT FAIL reused token revoke every token of the user", func(t *testing.T) {
+        revokedAt := time.Now().Add(-time.Minute)
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+            WithArgs("old").
+            WillReturnRows(mock.NewRows(tokenColumns).AddRow(1, expiresAt, &revokedAt, &revokedAt))
+        mock.ExpectExec(regexp.QuoteMeta(revokeAllQuery)).
+            WithArgs(1).
+            WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+        mock.ExpectCommit()
+
+        _, err := db.Rotate(context.Background(), "old", "new", expiresAt, allowUser)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+
+    t.Run("EXPECT FAIL token revoked on logout is only invalid", func(t *testing.T) {
+        revokedAt := time.Now().Add(-time.Minute)
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+            WithArgs("old").
+            WillReturnRows(mock.NewRows(tokenColumns).AddRow(1, expiresAt, &revokedAt, nil))
+        mock.ExpectRollback()
+
+        _, err := db.Rotate(context.Background(), "old", "new", expiresAt, allowUser)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDatabaseRevoke will test revoking refresh token
+func TestDatabaseRevoke(t *testing.T) {
+    mock, db := newTestDatabase(t)
+    q := revokeQuery + ` AND revoked_at IS NULL`
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        mock.ExpectExec(regexp.QuoteMeta(q)).
+            WithArgs("hash").
+            WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+        err := db.Revoke(context.Background(), "hash")
+        assert.NoError(t, err)
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T) {
+        mock.ExpectExec(regexp.QuoteMeta(q)).
+            WithArgs("hash").
+            WillReturnError(errors.New("update failed"))
+
+        err := db.Revoke(context.Background(), "hash")
+        assert.Error(t, err)
+    })
+
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
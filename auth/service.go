@@ -0,0 +1,111 @@
+/*
+    package auth
+    service.go
+    - service layer for auth package. login verify the user credentials and
+      issue the tokens, refresh rotate the refresh token and logout revoke it
+*/
+package auth
+
+import (
+	"context"
+	"errors"
+	"pgxtest/account"
+	"time"
+)
+
+// AuthService is interface to auth service
+type AuthService interface {
+    Login(ctx context.Context, email, passkey string) (*TokenResponse, error)
+    Refresh(ctx context.Context, refreshToken string) (*TokenResponse, error)
+    Logout(ctx context.Context, refreshToken string) error
+}
+
+// TokenResponse is to response the client with the issued tokens
+type TokenResponse struct {
+    AccessToken      string `json:"access_token"`
+    TokenType        string `json:"token_type"`
+    ExpiresIn        int64  `json:"expires_in"`
+    RefreshToken     string `json:"refresh_token"`
+    RefreshExpiresIn int64  `json:"refresh_expires_in"`
+}
+
+// authService is wrapper for the account service, refresh token repository
+// and token issuer
+type authService struct {
+    users  account.AccountService
+    db     Database
+    tokens *TokenIssuer
+}
+
+// NewAuthService will create authService instance
+func NewAuthService(users account.AccountService, db Database, tokens *TokenIssuer) *authService {
+    return &authService{users: users, db: db, tokens: tokens}
+}
+
+// Login will verify 'passkey' of user with 'email' and issue new access and
+// refresh token. account.ErrInvalidCredentials is returned if the
+// credentials does not match
+func (s *authService) Login(ctx context.Context, email, passkey string) (*TokenResponse, error) {
+    user, err := s.users.Authenticate(ctx, email, passkey)
+    if err != nil {
+        return nil, err
+    }
+
+    refresh, hash, refreshExpiresAt, err := s.tokens.RefreshToken()
+    if err != nil {
+        return nil, err
+    }
+    if err := s.db.Create(ctx, user.ID, hash, refreshExpiresAt); err != nil {
+        return nil, err
+    }
+
+    return s.tokenResponse(user, refresh)
+}
+
+// Refresh will replace 'refreshToken' with new refresh token and issue new
+// access token. ErrInvalidToken is returned if the token is unknown, expired,
+// already used or its user is deleted
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+    refresh, hash, refreshExpiresAt, err := s.tokens.RefreshToken()
+    if err != nil {
+        return nil, err
+    }
+
+    // the user may be deleted after the token was issued, it is checked
+    // before the rotation is committed so no token is left for deleted user
+    var user *account.UserResponse
+    check := func(userID int) error {
+        user, err = s.users.Get(ctx, userID)
+        if errors.Is(err, account.ErrNotFound) {
+            return ErrInvalidToken
+        }
+        return err
+    }
+    if _, err := s.db.Rotate(ctx, hashToken(refreshToken), hash, refreshExpiresAt, check); err != nil {
+        return nil, err
+    }
+
+    return s.tokenResponse(user, refresh)
+}
+
+// Logout will revoke 'refreshToken', the access token stays valid until it expire
+func (s *authService) Logout(ctx context.Context, refreshToken string) error {
+    return s.db.Revoke(ctx, hashToken(refreshToken))
+}
+
+// tokenResponse will sign access token of 'user' and build the response
+// together with refresh token 'refresh'
+func (s *authService) tokenResponse(user *account.UserResponse, refresh string) (*TokenResponse, error) {
+    access, _, err := s.tokens.AccessToken(user.ID, user.Email, user.Role)
+    if err != nil {
+        return nil, err
+    }
+
+    return &TokenResponse{
+        AccessToken:      access,
+        TokenType:        "Bearer",
+        ExpiresIn:        int64(s.tokens.accessTTL / time.Second),
+        RefreshToken:     refresh,
+        RefreshExpiresIn: int64(s.tokens.refreshTTL / time.Second),
+    }, nil
+}
@@ -0,0 +1,139 @@
+/*
+    package auth
+    service_test.go
+    - test login, refresh and logout business logic
+*/
+package auth
+
+import (
+	"context"
+	"pgxtest/account"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockUsers is account.AccountService double, only Authenticate and Get are
+// used by the auth service
+type mockUsers struct {
+    account.AccountService
+}
+
+// testUser is the only user known by mockUsers, the passkey is "secret"
+var testUser = &account.UserResponse{ID: 1, Firstname: "john", Email: "john@doe.com"}
+
+func (mockUsers) Authenticate(ctx context.Context, email, passkey string) (*account.UserResponse, error) {
+    if email != testUser.Email || passkey != "secret" {
+        return nil, account.ErrInvalidCredentials
+    }
+    return testUser, nil
+}
+
+func (mockUsers) Get(ctx context.Context, id int) (*account.UserResponse, error) {
+    if id != testUser.ID {
+        return nil, account.ErrNotFound
+    }
+    return testUser, nil
+}
+
+// newTestService will prepare pgxmock pool and auth service
+func newTestService(t *testing.T) (pgxmock.PgxPoolIface, *authService) {
+    t.Helper()
+    mock, db := newTestDatabase(t)
+    tokens, err := testConfig().TokenIssuer()
+    require.NoError(t, err)
+
+    return mock, NewAuthService(mockUsers{}, db, tokens)
+}
+
+// TestAuthServiceLogin will test Login method of the auth service
+func TestAuthServiceLogin(t *testing.T) {
+    mock, svc := newTestService(t)
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        mock.ExpectExec(regexp.QuoteMeta(insertQuery)).
+            WithArgs(testUser.ID, pgxmock.AnyArg(), pgxmock.AnyArg()).
+            WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+        got, err := svc.Login(context.Background(), testUser.Email, "secret")
+        require.NoError(t, err)
+        assert.Equal(t, "Bearer", got.TokenType)
+        assert.Equal(t, int64(15*60), got.ExpiresIn)
+        assert.Equal(t, int64(60*60), got.RefreshExpiresIn)
+        assert.NotEmpty(t, got.RefreshToken)
+
+        claims, err := svc.tokens.Parse(got.AccessToken)
+        require.NoError(t, err)
+        assert.Equal(t, testUser.Email, claims.Email)
+    })
+
+    t.Run("EXPECT FAIL wrong passkey", func(t *testing.T) {
+        got, err := svc.Login(context.Background(), testUser.Email, "wrong")
+        assert.ErrorIs(t, err, account.ErrInvalidCredentials)
+        assert.Nil(t, got)
+    })
+
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAuthServiceRefresh will test Refresh method of the auth service
+func TestAuthServiceRefresh(t *testing.T) {
+    mock, svc := newTestService(t)
+
+    // expectLock will prepare expectation of locking valid 'token' owned by 'userID'
+    expectLock := func(token string, userID int) {
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+            WithArgs(hashToken(token)).
+            WillReturnRows(mock.NewRows(tokenColumns).AddRow(userID, time.Now().Add(time.Hour), nil, nil))
+    }
+
+    // expectRotate will prepare expectation of rotating 'token' owned by 'userID'
+    expectRotate := func(token string, userID int) {
+        expectLock(token, userID)
+        mock.ExpectExec(regexp.QuoteMeta(rotateQuery)).
+            WithArgs(hashToken(token)).
+            WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+        mock.ExpectExec(regexp.QuoteMeta(insertQuery)).
+            WithArgs(userID, pgxmock.AnyArg(), pgxmock.AnyArg()).
+            WillReturnResult(pgxmock.NewResult("INSERT", 1))
+        mock.ExpectCommit()
+    }
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        expectRotate("refresh", testUser.ID)
+
+        got, err := svc.Refresh(context.Background(), "refresh")
+        require.NoError(t, err)
+        assert.NotEqual(t, "refresh", got.RefreshToken)
+        assert.NotEmpty(t, got.AccessToken)
+    })
+
+    // the token of deleted user is not rotated
+    t.Run("EXPECT FAIL deleted user", func(t *testing.T) {
+        expectLock("refresh", 9)
+        mock.ExpectRollback()
+
+        got, err := svc.Refresh(context.Background(), "refresh")
+        assert.ErrorIs(t, err, ErrInvalidToken)
+        assert.Nil(t, got)
+    })
+
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAuthServiceLogout will test Logout method of the auth service
+func TestAuthServiceLogout(t *testing.T) {
+    mock, svc := newTestService(t)
+    mock.ExpectExec(regexp.QuoteMeta(revokeQuery)).
+        WithArgs(hashToken("refresh")).
+        WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+    err := svc.Logout(context.Background(), "refresh")
+    assert.NoError(t, err)
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,209 @@
+/*
+    package auth
+    token.go
+    - signed access token (JWT) and opaque refresh token. the access token is
+      signed using HMAC (HS256) secret or Ed25519 (EdDSA) private key from the
+      configuration, the refresh token is random string stored as its hash
+*/
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrInvalidToken is returned when the access or refresh token is malformed,
+// expired, revoked or signed by other key
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// signing algorithm name of the access token
+const (
+    AlgorithmHS256 = "HS256"
+    AlgorithmEdDSA = "EdDSA"
+)
+
+// minSecretLength is minimum length of HS256 secret, shorter secret can be
+// brute forced from a single token
+const minSecretLength = 32
+
+// exampleSecret is the placeholder secret of the older config.example.yaml,
+// it is publicly known so it is never accepted
+const exampleSecret = "change-me-to-a-random-string-of-32-chars"
+
+// refreshTokenLength is number of random byte of the refresh token
+const refreshTokenLength = 32
+
+// Config is configuration of the token issuing
+type Config struct {
+    // Algorithm is "HS256" or "EdDSA", empty value will use HS256
+    Algorithm string `yaml:"algorithm"`
+
+    // Secret is HMAC secret used by HS256, at least 32 characters
+    Secret string `yaml:"secret"`
+
+    // PrivateKeyFile is path to PEM encoded (PKCS #8) Ed25519 private key
+    // used by EdDSA
+    PrivateKeyFile string `yaml:"private_key_file"`
+
+    // Issuer is "iss" claim of the access token
+    Issuer string `yaml:"issuer"`
+
+    // AccessTTL is lifetime of the access token
+    AccessTTL time.Duration `yaml:"access_ttl"`
+
+    // RefreshTTL is lifetime of the refresh token
+    RefreshTTL time.Duration `yaml:"refresh_ttl"`
+}
+
+// Claims is claims of the access token, the user id is the subject
+type Claims struct {
+    Email string `json:"email"`
+    Role  string `json:"role"`
+    jwt.RegisteredClaims
+}
+
+// UserID will get user id from the subject of the token
+func (c *Claims) UserID() (int, error) {
+    id, err := strconv.Atoi(c.Subject)
+    if err != nil {
+        return 0, ErrInvalidToken
+    }
+    return id, nil
+}
+
+// TokenIssuer will sign and parse access token and generate refresh token
+type TokenIssuer struct {
+    method     jwt.SigningMethod
+    signKey    interface{}
+    verifyKey  interface{}
+    issuer     string
+    accessTTL  time.Duration
+    refreshTTL time.Duration
+
+    // now is current time, replaced by the test
+    now func() time.Time
+}
+
+// TokenIssuer will create TokenIssuer from the configuration, the secret or
+// private key is required by the selected algorithm
+func (c Config) TokenIssuer() (*TokenIssuer, error) {
+    if c.AccessTTL <= 0 || c.RefreshTTL <= 0 {
+        return nil, errors.New("invalid auth configuration: access_ttl and refresh_ttl must be positive")
+    }
+
+    t := &TokenIssuer{
+        issuer:     c.Issuer,
+        accessTTL:  c.AccessTTL,
+        refreshTTL: c.RefreshTTL,
+        now:        time.Now,
+    }
+
+    switch c.Algorithm {
+    case "", AlgorithmHS256:
+        if len(c.Secret) < minSecretLength {
+            return nil, fmt.Errorf("invalid auth configuration: %s secret must be at least %d characters",
+                AlgorithmHS256, minSecretLength)
+        }
+        if c.Secret == exampleSecret {
+            return nil, fmt.Errorf("invalid auth configuration: %s secret is the example placeholder", AlgorithmHS256)
+        }
+        t.method = jwt.SigningMethodHS256
+        t.signKey = []byte(c.Secret)
+        t.verifyKey = []byte(c.Secret)
+    case AlgorithmEdDSA:
+        if c.PrivateKeyFile == "" {
+            return nil, fmt.Errorf("invalid auth configuration: %s private_key_file is required", AlgorithmEdDSA)
+        }
+        b, err := ioutil.ReadFile(c.PrivateKeyFile)
+        if err != nil {
+            return nil, fmt.Errorf("reading auth private key: %w", err)
+        }
+        key, err := jwt.ParseEdPrivateKeyFromPEM(b)
+        if err != nil {
+            return nil, fmt.Errorf("parsing auth private key %s: %w", c.PrivateKeyFile, err)
+        }
+        t.method = jwt.SigningMethodEdDSA
+        t.signKey = key
+        t.verifyKey = key.(ed25519.PrivateKey).Public()
+    default:
+        return nil, fmt.Errorf("invalid auth configuration: unknown algorithm %q, must be %q or %q",
+            c.Algorithm, AlgorithmHS256, AlgorithmEdDSA)
+    }
+
+    return t, nil
+}
+
+// AccessToken will create signed access token of user 'id' with 'email' and
+// 'role', the expiration time of the token is returned together with the token
+func (t *TokenIssuer) AccessToken(id int, email, role string) (string, time.Time, error) {
+    now := t.now()
+    expiresAt := now.Add(t.accessTTL)
+    claims := Claims{
+        Email: email,
+        Role:  role,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Issuer:    t.issuer,
+            Subject:   strconv.Itoa(id),
+            IssuedAt:  jwt.NewNumericDate(now),
+            NotBefore: jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(expiresAt),
+        },
+    }
+
+    token, err := jwt.NewWithClaims(t.method, claims).SignedString(t.signKey)
+    if err != nil {
+        return "", time.Time{}, fmt.Errorf("signing access token: %w", err)
+    }
+
+    return token, expiresAt, nil
+}
+
+// Parse will verify signature, issuer and expiration time of access token
+// 'token' and get its claims. ErrInvalidToken is returned if the token is not valid
+func (t *TokenIssuer) Parse(token string) (*Claims, error) {
+    // only the configured algorithm is accepted, so "none" or token signed
+    // using the public key as HMAC secret is refused
+    parser := jwt.NewParser(jwt.WithValidMethods([]string{t.method.Alg()}))
+
+    claims := new(Claims)
+    _, err := parser.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+        return t.verifyKey, nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+    }
+    if t.issuer != "" && !claims.VerifyIssuer(t.issuer, true) {
+        return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+    }
+
+    return claims, nil
+}
+
+// RefreshToken will generate random refresh token, only the hash of the token
+// is stored so leaked database can not be used to refresh the access token
+func (t *TokenIssuer) RefreshToken() (token, hash string, expiresAt time.Time, err error) {
+    b := make([]byte, refreshTokenLength)
+    if _, err := rand.Read(b); err != nil {
+        return "", "", time.Time{}, fmt.Errorf("generating refresh token: %w", err)
+    }
+    token = base64.RawURLEncoding.EncodeToString(b)
+
+    return token, hashToken(token), t.now().Add(t.refreshTTL), nil
+}
+
+// hashToken will get hex encoded sha256 hash of refresh token 'token'. the
+// token is random, so salted/ slow hash is not needed
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
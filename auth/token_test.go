@@ -0,0 +1,184 @@
+/*
+    package auth
+    token_test.go
+    - test access token signing/ parsing and refresh token generation
+*/
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSecret is HS256 secret for the test
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// testConfig will get HS256 configuration for the test
+func testConfig() Config {
+    return Config{
+        Algorithm:  AlgorithmHS256,
+        Secret:     testSecret,
+        Issuer:     "pgxtest",
+        AccessTTL:  time.Minute * 15,
+        RefreshTTL: time.Hour,
+    }
+}
+
+// writeEdKey will write new PEM encoded Ed25519 private key to temporary file
+func writeEdKey(t *testing.T) string {
+    t.Helper()
+    _, key, err := ed25519.GenerateKey(rand.Reader)
+    require.NoError(t, err)
+    der, err := x509.MarshalPKCS8PrivateKey(key)
+    require.NoError(t, err)
+
+    path := filepath.Join(t.TempDir(), "auth.pem")
+    err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+    require.NoError(t, err)
+
+    return path
+}
+
+// TestTokenIssuer will test creating TokenIssuer from the configuration
+func TestTokenIssuer(t *testing.T) {
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        edCfg := testConfig()
+        edCfg.Algorithm, edCfg.Secret, edCfg.PrivateKeyFile = AlgorithmEdDSA, "", writeEdKey(t)
+
+        for _, cfg := range []Config{testConfig(), edCfg} {
+            tokens, err := cfg.TokenIssuer()
+            require.NoError(t, err, cfg.Algorithm)
+            assert.Equal(t, cfg.Algorithm, tokens.method.Alg())
+        }
+    })
+
+    t.Run("EXPECT FAIL", func(t *testing.T) {
+        shortSecret := testConfig()
+        shortSecret.Secret = "secret"
+        exampleSecret := testConfig()
+        exampleSecret.Secret = "change-me-to-a-random-string-of-32-chars"
+        missingKey := testConfig()
+        missingKey.Algorithm = AlgorithmEdDSA
+        keyNotFound := missingKey
+        keyNotFound.PrivateKeyFile = filepath.Join(t.TempDir(), "missing.pem")
+        unknown := testConfig()
+        unknown.Algorithm = "none"
+        noTTL := testConfig()
+        noTTL.AccessTTL = 0
+
+        for _, cfg := range []Config{shortSecret, exampleSecret, missingKey, keyNotFound, unknown, noTTL} {
+            tokens, err := cfg.TokenIssuer()
+            assert.Error(t, err, cfg)
+            assert.Nil(t, tokens)
+        }
+    })
+}
+
+// TestAccessToken will test signing and parsing the access token
+func TestAccessToken(t *testing.T) {
+    tokens, err := testConfig().TokenIssuer()
+    require.NoError(t, err)
+
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        token, expiresAt, err := tokens.AccessToken(7, "john@doe.com", "user")
+        require.NoError(t, err)
+        assert.WithinDuration(t, time.Now().Add(time.Minute*15), expiresAt, time.Second*2)
+
+        claims, err := tokens.Parse(token)
+        require.NoError(t, err)
+        id, err := claims.UserID()
+        assert.NoError(t, err)
+        assert.Equal(t, 7, id)
+        assert.Equal(t, "john@doe.com", claims.Email)
+        assert.Equal(t, "user", claims.Role)
+        assert.Equal(t, "pgxtest", claims.Issuer)
+    })
+
+    t.Run("EXPECT SUCCESS EdDSA", func(t *testing.T) {
+        cfg := testConfig()
+        cfg.Algorithm, cfg.PrivateKeyFile = AlgorithmEdDSA, writeEdKey(t)
+        edTokens, err := cfg.TokenIssuer()
+        require.NoError(t, err)
+
+        token, _, err := edTokens.AccessToken(7, "john@doe.com", "user")
+        require.NoError(t, err)
+
+        claims, err := edTokens.Parse(token)
+        require.NoError(t, err)
+        assert.Equal(t, "7", claims.Subject)
+
+        // EdDSA token is refused by HS256 issuer
+        _, err = tokens.Parse(token)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+
+    t.Run("EXPECT FAIL expired", func(t *testing.T) {
+        expired := *tokens
+        expired.now = func() time.Time { return time.Now().Add(-time.Hour) }
+        token, _, err := expired.AccessToken(7, "john@doe.com", "user")
+        require.NoError(t, err)
+
+        claims, err := tokens.Parse(token)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+        assert.Nil(t, claims)
+    })
+
+    t.Run("EXPECT FAIL other secret", func(t *testing.T) {
+        cfg := testConfig()
+        cfg.Secret = "abcdef0123456789abcdef0123456789"
+        other, err := cfg.TokenIssuer()
+        require.NoError(t, err)
+        token, _, err := other.AccessToken(7, "john@doe.com", "user")
+        require.NoError(t, err)
+
+        _, err = tokens.Parse(token)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+
+    t.Run("EXPECT FAIL other issuer", func(t *testing.T) {
+        cfg := testConfig()
+        cfg.Issuer = "someone-else"
+        other, err := cfg.TokenIssuer()
+        require.NoError(t, err)
+        token, _, err := other.AccessToken(7, "john@doe.com", "user")
+        require.NoError(t, err)
+
+        _, err = tokens.Parse(token)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+
+    t.Run("EXPECT FAIL unsigned token", func(t *testing.T) {
+        claims := Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "7", Issuer: "pgxtest"}}
+        token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+        require.NoError(t, err)
+
+        _, err = tokens.Parse(token)
+        assert.ErrorIs(t, err, ErrInvalidToken)
+    })
+}
+
+// TestRefreshToken will test generating the refresh token
+func TestRefreshToken(t *testing.T) {
+    tokens, err := testConfig().TokenIssuer()
+    require.NoError(t, err)
+
+    token, hash, expiresAt, err := tokens.RefreshToken()
+    require.NoError(t, err)
+    other, _, _, err := tokens.RefreshToken()
+    require.NoError(t, err)
+
+    assert.NotEqual(t, token, other)
+    assert.Equal(t, hashToken(token), hash)
+    assert.Len(t, hash, 64)
+    assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Second*2)
+}
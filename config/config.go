@@ -0,0 +1,529 @@
+/*
+    package config
+    config.go
+    - loading application configuration (database and http server setting)
+      from config file, environment variables and command-line flags
+*/
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pgxtest/account"
+	"pgxtest/auth"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is wrapper for all of the application configuration
+type Config struct {
+    Database  account.DatabaseConfig `yaml:"database"`
+    Server    ServerConfig           `yaml:"server"`
+    Migration MigrationConfig        `yaml:"migration"`
+    Password  account.PasswordConfig `yaml:"password"`
+    Auth      auth.Config            `yaml:"auth"`
+    Purge     account.PurgeConfig    `yaml:"purge"`
+}
+
+// MigrationConfig is configuration for database schema migration
+type MigrationConfig struct {
+    // Auto will apply pending migration when the server start
+    Auto bool `yaml:"auto"`
+}
+
+// ServerConfig is configuration for the http server
+type ServerConfig struct {
+    // Address is the address the http server listen to, eg ":8000"
+    Address string `yaml:"address"`
+
+    // Mode is gin mode, one of "debug", "release" or "test"
+    Mode string `yaml:"mode"`
+
+    // HealthTimeout is maximum time to wait for the database ping of the
+    // readiness probe
+    HealthTimeout time.Duration `yaml:"health_timeout"`
+
+    // ShutdownDelay is wait time after readiness start failing and before the
+    // server stop accepting new connection, so load balancer has time to take
+    // the instance out of rotation
+    ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+
+    // ShutdownTimeout is maximum time to wait for in-flight requests to finish
+    // while shutting down
+    ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// field describe single configuration value and where it can be loaded from
+type field struct {
+    name   string
+    env    string
+    flag   string
+    usage  string
+    isBool bool
+    set    func(c *Config, v string) error
+    get    func(c *Config) string
+}
+
+// flagValue is flag.Value holding raw flag value until it is applied to the
+// configuration, so flag only override the value when it is set
+type flagValue struct {
+    value  string
+    isBool bool
+}
+
+func (v *flagValue) String() string { return v.value }
+func (v *flagValue) Set(s string) error { v.value = s; return nil }
+
+// IsBoolFlag allow boolean flag to be set without value, eg "-auto-migrate"
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
+
+// stringField is helper to create field for plain string value
+func stringField(name, env, flag, usage string, target func(c *Config) *string) field {
+    return field{
+        name:  name,
+        env:   env,
+        flag:  flag,
+        usage: usage,
+        set:   func(c *Config, v string) error { *target(c) = v; return nil },
+        get:   func(c *Config) string { return *target(c) },
+    }
+}
+
+// durationField is helper to create field for time.Duration value. plain
+// integer is treated as number of second to follow libpq convention
+func durationField(name, env, flag, usage string, target func(c *Config) *time.Duration) field {
+    return field{
+        name:  name,
+        env:   env,
+        flag:  flag,
+        usage: usage,
+        set: func(c *Config, v string) error {
+            if n, err := strconv.Atoi(v); err == nil {
+                *target(c) = time.Duration(n) * time.Second
+                return nil
+            }
+            d, err := time.ParseDuration(v)
+            if err != nil {
+                return err
+            }
+            *target(c) = d
+            return nil
+        },
+        get: func(c *Config) string { return target(c).String() },
+    }
+}
+
+// int32Field is helper to create field for int32 value
+func int32Field(name, env, flag, usage string, target func(c *Config) *int32) field {
+    return field{
+        name:  name,
+        env:   env,
+        flag:  flag,
+        usage: usage,
+        set: func(c *Config, v string) error {
+            n, err := strconv.ParseInt(v, 10, 32)
+            if err != nil {
+                return err
+            }
+            *target(c) = int32(n)
+            return nil
+        },
+        get: func(c *Config) string { return strconv.Itoa(int(*target(c))) },
+    }
+}
+
+// float64Field is helper to create field for float64 value
+func float64Field(name, env, flag, usage string, target func(c *Config) *float64) field {
+    return field{
+        name:  name,
+        env:   env,
+        flag:  flag,
+        usage: usage,
+        set: func(c *Config, v string) error {
+            n, err := strconv.ParseFloat(v, 64)
+            if err != nil {
+                return err
+            }
+            *target(c) = n
+            return nil
+        },
+        get: func(c *Config) string { return strconv.FormatFloat(*target(c), 'g', -1, 64) },
+    }
+}
+
+// intField is helper to create field for int value
+func intField(name, env, flag, usage string, target func(c *Config) *int) field {
+    return field{
+        name:  name,
+        env:   env,
+        flag:  flag,
+        usage: usage,
+        set: func(c *Config, v string) error {
+            n, err := strconv.Atoi(v)
+            if err != nil {
+                return err
+            }
+            *target(c) = n
+            return nil
+        },
+        get: func(c *Config) string { return strconv.Itoa(*target(c)) },
+    }
+}
+
+// boolField is helper to create field for bool value
+func boolField(name, env, flag, usage string, target func(c *Config) *bool) field {
+    return field{
+        name:   name,
+        env:    env,
+        flag:   flag,
+        usage:  usage,
+        isBool: true,
+        set: func(c *Config, v string) error {
+            b, err := strconv.ParseBool(v)
+            if err != nil {
+                return err
+            }
+            *target(c) = b
+            return nil
+        },
+        get: func(c *Config) string { return strconv.FormatBool(*target(c)) },
+    }
+}
+
+// configEnv is environment variable holding the path to the config file
+const configEnv = "APP_CONFIG"
+
+// fields is list of all configurable value, environment variables are
+// following the libpq PG* naming so existing tooling setting can be reused
+var fields = []field{
+    stringField("database.hostname", "PGHOST", "db-host", "database server hostname",
+        func(c *Config) *string { return &c.Database.Hostname }),
+    stringField("database.port", "PGPORT", "db-port", "database server port",
+        func(c *Config) *string { return &c.Database.Port }),
+    stringField("database.username", "PGUSER", "db-user", "database username",
+        func(c *Config) *string { return &c.Database.Username }),
+    stringField("database.password", "PGPASSWORD", "db-password", "database password",
+        func(c *Config) *string { return &c.Database.Password }),
+    stringField("database.dbname", "PGDATABASE", "db-name", "database name",
+        func(c *Config) *string { return &c.Database.DBName }),
+    stringField("database.sslmode", "PGSSLMODE", "db-sslmode",
+        "database ssl mode (disable, allow, prefer, require, verify-ca or verify-full)",
+        func(c *Config) *string { return &c.Database.SSLMode }),
+    stringField("database.sslrootcert", "PGSSLROOTCERT", "db-sslrootcert", "path to database CA certificate",
+        func(c *Config) *string { return &c.Database.SSLRootCert }),
+    stringField("database.sslcert", "PGSSLCERT", "db-sslcert", "path to database client certificate",
+        func(c *Config) *string { return &c.Database.SSLCert }),
+    stringField("database.sslkey", "PGSSLKEY", "db-sslkey", "path to database client certificate key",
+        func(c *Config) *string { return &c.Database.SSLKey }),
+    stringField("database.application_name", "PGAPPNAME", "db-application-name", "application name reported to database",
+        func(c *Config) *string { return &c.Database.ApplicationName }),
+    stringField("database.search_path", "APP_DB_SEARCH_PATH", "db-search-path", "database schema search path",
+        func(c *Config) *string { return &c.Database.SearchPath }),
+    durationField("database.connect_timeout", "PGCONNECT_TIMEOUT", "db-connect-timeout",
+        "database connect timeout, eg 5s",
+        func(c *Config) *time.Duration { return &c.Database.ConnectTimeout }),
+    int32Field("database.max_conns", "APP_DB_MAX_CONNS", "db-max-conns", "maximum size of the connection pool",
+        func(c *Config) *int32 { return &c.Database.MaxConns }),
+    int32Field("database.min_conns", "APP_DB_MIN_CONNS", "db-min-conns", "minimum size of the connection pool",
+        func(c *Config) *int32 { return &c.Database.MinConns }),
+    durationField("database.max_conn_lifetime", "APP_DB_MAX_CONN_LIFETIME", "db-max-conn-lifetime",
+        "maximum lifetime of a pooled connection, eg 1h",
+        func(c *Config) *time.Duration { return &c.Database.MaxConnLifetime }),
+    durationField("database.max_conn_idle_time", "APP_DB_MAX_CONN_IDLE_TIME", "db-max-conn-idle-time",
+        "maximum idle time of a pooled connection, eg 30m",
+        func(c *Config) *time.Duration { return &c.Database.MaxConnIdleTime }),
+    durationField("database.health_check_period", "APP_DB_HEALTH_CHECK_PERIOD", "db-health-check-period",
+        "how often idle pooled connection is checked, eg 1m",
+        func(c *Config) *time.Duration { return &c.Database.HealthCheckPeriod }),
+    stringField("database.min_server_version", "APP_DB_MIN_SERVER_VERSION", "db-min-server-version",
+        "minimum supported postgres version, eg 10 or 9.6",
+        func(c *Config) *string { return &c.Database.MinServerVersion }),
+    durationField("database.query_timeout.default", "APP_DB_QUERY_TIMEOUT", "db-query-timeout",
+        "default maximum duration of database query, eg 5s",
+        func(c *Config) *time.Duration { return &c.Database.QueryTimeout.Default }),
+    durationField("database.query_timeout.create", "APP_DB_QUERY_TIMEOUT_CREATE", "db-query-timeout-create",
+        "maximum duration of create user query",
+        func(c *Config) *time.Duration { return &c.Database.QueryTimeout.Create }),
+    durationField("database.query_timeout.get", "APP_DB_QUERY_TIMEOUT_GET", "db-query-timeout-get",
+        "maximum duration of get user query",
+        func(c *Config) *time.Duration { return &c.Database.QueryTimeout.Get }),
+    durationField("database.query_timeout.gets", "APP_DB_QUERY_TIMEOUT_GETS", "db-query-timeout-gets",
+        "maximum duration of get all users query",
+        func(c *Config) *time.Duration { return &c.Database.QueryTimeout.Gets }),
+    durationField("database.query_timeout.update", "APP_DB_QUERY_TIMEOUT_UPDATE", "db-query-timeout-update",
+        "maximum duration of update user query",
+        func(c *Config) *time.Duration { return &c.Database.QueryTimeout.Update }),
+    durationField("database.query_timeout.delete", "APP_DB_QUERY_TIMEOUT_DELETE", "db-query-timeout-delete",
+        "maximum duration of delete user query",
+        func(c *Config) *time.Duration { return &c.Database.QueryTimeout.Delete }),
+    intField("database.retry.max_attempts", "APP_DB_RETRY_MAX_ATTEMPTS", "db-retry-max-attempts",
+        "maximum database connection attempts at startup",
+        func(c *Config) *int { return &c.Database.Retry.MaxAttempts }),
+    durationField("database.retry.initial_backoff", "APP_DB_RETRY_INITIAL_BACKOFF", "db-retry-initial-backoff",
+        "wait time after the first failed connection attempt, eg 1s",
+        func(c *Config) *time.Duration { return &c.Database.Retry.InitialBackoff }),
+    durationField("database.retry.max_backoff", "APP_DB_RETRY_MAX_BACKOFF", "db-retry-max-backoff",
+        "maximum wait time between connection attempts, eg 30s",
+        func(c *Config) *time.Duration { return &c.Database.Retry.MaxBackoff }),
+    float64Field("database.retry.multiplier", "APP_DB_RETRY_MULTIPLIER", "db-retry-multiplier",
+        "backoff multiplier after each failed connection attempt",
+        func(c *Config) *float64 { return &c.Database.Retry.Multiplier }),
+    float64Field("database.retry.jitter", "APP_DB_RETRY_JITTER", "db-retry-jitter",
+        "random backoff variation, fraction between 0 and 1",
+        func(c *Config) *float64 { return &c.Database.Retry.Jitter }),
+    durationField("database.retry.timeout", "APP_DB_RETRY_TIMEOUT", "db-retry-timeout",
+        "total time to wait for the database at startup, eg 2m",
+        func(c *Config) *time.Duration { return &c.Database.Retry.Timeout }),
+    stringField("server.address", "APP_ADDRESS", "addr", "http server listen address",
+        func(c *Config) *string { return &c.Server.Address }),
+    stringField("server.mode", "APP_MODE", "mode", "gin mode (debug, release or test)",
+        func(c *Config) *string { return &c.Server.Mode }),
+    durationField("server.health_timeout", "APP_HEALTH_TIMEOUT", "health-timeout",
+        "database ping timeout of the readiness probe, eg 2s",
+        func(c *Config) *time.Duration { return &c.Server.HealthTimeout }),
+    durationField("server.shutdown_delay", "APP_SHUTDOWN_DELAY", "shutdown-delay",
+        "wait time between failing readiness and stopping the server, eg 5s",
+        func(c *Config) *time.Duration { return &c.Server.ShutdownDelay }),
+    durationField("server.shutdown_timeout", "APP_SHUTDOWN_TIMEOUT", "shutdown-timeout",
+        "maximum time to wait for in-flight requests while shutting down, eg 15s",
+        func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout }),
+    stringField("password.algorithm", "APP_PASSWORD_ALGORITHM", "password-algorithm",
+        "passkey hashing algorithm (argon2id or bcrypt)",
+        func(c *Config) *string { return &c.Password.Algorithm }),
+    intField("password.bcrypt_cost", "APP_PASSWORD_BCRYPT_COST", "password-bcrypt-cost",
+        "bcrypt cost factor",
+        func(c *Config) *int { return &c.Password.BcryptCost }),
+    intField("password.argon2_memory", "APP_PASSWORD_ARGON2_MEMORY", "password-argon2-memory",
+        "argon2id memory in KiB",
+        func(c *Config) *int { return &c.Password.Argon2Memory }),
+    intField("password.argon2_iterations", "APP_PASSWORD_ARGON2_ITERATIONS", "password-argon2-iterations",
+        "argon2id number of iterations",
+        func(c *Config) *int { return &c.Password.Argon2Iterations }),
+    intField("password.argon2_parallelism", "APP_PASSWORD_ARGON2_PARALLELISM", "password-argon2-parallelism",
+        "argon2id degree of parallelism",
+        func(c *Config) *int { return &c.Password.Argon2Parallelism }),
+    stringField("auth.algorithm", "APP_AUTH_ALGORITHM", "auth-algorithm",
+        "access token signing algorithm (HS256 or EdDSA)",
+        func(c *Config) *string { return &c.Auth.Algorithm }),
+    stringField("auth.secret", "APP_AUTH_SECRET", "auth-secret",
+        "HS256 access token signing secret, at least 32 characters",
+        func(c *Config) *string { return &c.Auth.Secret }),
+    stringField("auth.private_key_file", "APP_AUTH_PRIVATE_KEY_FILE", "auth-private-key-file",
+        "path to PEM encoded Ed25519 private key used by EdDSA",
+        func(c *Config) *string { return &c.Auth.PrivateKeyFile }),
+    stringField("auth.issuer", "APP_AUTH_ISSUER", "auth-issuer", "issuer (iss claim) of the access token",
+        func(c *Config) *string { return &c.Auth.Issuer }),
+    durationField("auth.access_ttl", "APP_AUTH_ACCESS_TTL", "auth-access-ttl",
+        "lifetime of the access token, eg 15m",
+        func(c *Config) *time.Duration { return &c.Auth.AccessTTL }),
+    durationField("auth.refresh_ttl", "APP_AUTH_REFRESH_TTL", "auth-refresh-ttl",
+        "lifetime of the refresh token, eg 720h",
+        func(c *Config) *time.Duration { return &c.Auth.RefreshTTL }),
+    durationField("purge.retention", "APP_PURGE_RETENTION", "purge-retention",
+        "how long deleted user is kept before it is purged, 0 keep it forever, eg 720h",
+        func(c *Config) *time.Duration { return &c.Purge.Retention }),
+    durationField("purge.interval", "APP_PURGE_INTERVAL", "purge-interval",
+        "wait time between purging deleted users, eg 1h",
+        func(c *Config) *time.Duration { return &c.Purge.Interval }),
+    boolField("migration.auto", "APP_AUTO_MIGRATE", "auto-migrate", "apply pending database migration on startup",
+        func(c *Config) *bool { return &c.Migration.Auto }),
+}
+
+// required is list of field name that must not be empty after loading
+var required = []string{
+    "database.hostname",
+    "database.port",
+    "database.username",
+    "database.dbname",
+    "server.address",
+    "server.mode",
+}
+
+// Default will return configuration with its default value
+func Default() Config {
+    return Config{
+        Database: account.DatabaseConfig{
+            Hostname: "localhost",
+            Port:     "5432",
+            MinServerVersion: "10",
+            QueryTimeout: account.QueryTimeouts{
+                Default: time.Duration(time.Second * 5),
+            },
+            Retry: account.RetryConfig{
+                MaxAttempts:    10,
+                InitialBackoff: time.Duration(time.Second),
+                MaxBackoff:     time.Duration(time.Second * 30),
+                Multiplier:     2,
+                Jitter:         0.2,
+                Timeout:        time.Duration(time.Minute * 2),
+            },
+        },
+        Server: ServerConfig{
+            Address: ":8000",
+            Mode:    gin.ReleaseMode,
+            HealthTimeout:   time.Duration(time.Second * 2),
+            ShutdownTimeout: time.Duration(time.Second * 15),
+        },
+        Auth: auth.Config{
+            Algorithm:  auth.AlgorithmHS256,
+            Issuer:     "pgxtest",
+            AccessTTL:  time.Duration(time.Minute * 15),
+            RefreshTTL: time.Duration(time.Hour * 24 * 30),
+        },
+        Purge: account.PurgeConfig{
+            Retention: time.Duration(time.Hour * 24 * 30),
+            Interval:  time.Duration(time.Hour),
+        },
+    }
+}
+
+// Load will register configuration flags to 'fs', parse 'args' and build the
+// configuration. value precedence from the lowest to the highest is:
+// default value, config file, environment variables and command-line flags
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+    // register flags, the value will only be applied when the flag is set
+    path := fs.String("config", "", "path to yaml config file (env "+configEnv+")")
+    values := make(map[string]*flagValue, len(fields))
+    for _, f := range fields {
+        values[f.flag] = &flagValue{isBool: f.isBool}
+        fs.Var(values[f.flag], f.flag, fmt.Sprintf("%s (env %s)", f.usage, f.env))
+    }
+
+    if err := fs.Parse(args); err != nil {
+        return nil, err
+    }
+
+    cfg := Default()
+
+    // config file, flag take precedence over environment variable
+    if *path == "" {
+        *path = os.Getenv(configEnv)
+    }
+    if *path != "" {
+        if err := cfg.loadFile(*path); err != nil {
+            return nil, err
+        }
+    }
+
+    // environment variables, empty variable is treated as not set
+    for _, f := range fields {
+        if v := os.Getenv(f.env); v != "" {
+            if err := f.set(&cfg, v); err != nil {
+                return nil, fmt.Errorf("config: invalid value for %s (env %s): %v", f.name, f.env, err)
+            }
+        }
+    }
+
+    // command-line flags
+    var err error
+    fs.Visit(func(fl *flag.Flag) {
+        for _, f := range fields {
+            if f.flag != fl.Name || err != nil {
+                continue
+            }
+            if e := f.set(&cfg, values[f.flag].value); e != nil {
+                err = fmt.Errorf("config: invalid value for %s (flag -%s): %v", f.name, f.flag, e)
+            }
+        }
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    if err := cfg.Validate(); err != nil {
+        return nil, err
+    }
+
+    return &cfg, nil
+}
+
+// loadFile will read yaml config file and place the value on 'c'
+func (c *Config) loadFile(path string) error {
+    b, err := ioutil.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("config: reading config file: %w", err)
+    }
+
+    // use strict mode so typo on the config key is reported instead of ignored
+    if err := yaml.UnmarshalStrict(b, c); err != nil {
+        return fmt.Errorf("config: parsing config file %s: %w", path, err)
+    }
+
+    return nil
+}
+
+// Validate will make sure all required value is available
+func (c Config) Validate() error {
+    for _, name := range required {
+        f := lookupField(name)
+        if strings.TrimSpace(f.get(&c)) == "" {
+            return fmt.Errorf("config: missing required field %s (set env %s or flag -%s)",
+                f.name, f.env, f.flag)
+        }
+    }
+
+    if c.Database.Retry.Jitter < 0 || c.Database.Retry.Jitter > 1 {
+        return fmt.Errorf("config: invalid value for database.retry.jitter %v, must be between 0 and 1",
+            c.Database.Retry.Jitter)
+    }
+
+    qt := c.Database.QueryTimeout
+    for _, d := range []time.Duration{qt.Default, qt.Create, qt.Get, qt.Gets, qt.Update, qt.Delete} {
+        if d < 0 {
+            return errors.New("config: database.query_timeout must not be negative")
+        }
+    }
+
+    if c.Server.ShutdownDelay < 0 || c.Server.ShutdownTimeout < 0 {
+        return errors.New("config: server.shutdown_delay and server.shutdown_timeout must not be negative")
+    }
+
+    // make sure database setting can be used to build connection configuration
+    if _, err := c.Database.ParseConfig(); err != nil {
+        return fmt.Errorf("config: %w", err)
+    }
+
+    // make sure password hasher can be created
+    if _, err := c.Password.Hasher(); err != nil {
+        return fmt.Errorf("config: %w", err)
+    }
+
+    // the secret/ private key is only required by the server, so it is
+    // checked when the server start instead of here
+    switch c.Auth.Algorithm {
+    case auth.AlgorithmHS256, auth.AlgorithmEdDSA:
+    default:
+        return fmt.Errorf("config: invalid value for auth.algorithm %q, must be %q or %q",
+            c.Auth.Algorithm, auth.AlgorithmHS256, auth.AlgorithmEdDSA)
+    }
+    if c.Auth.AccessTTL <= 0 || c.Auth.RefreshTTL <= 0 {
+        return errors.New("config: auth.access_ttl and auth.refresh_ttl must be positive")
+    }
+
+    switch c.Server.Mode {
+    case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+    default:
+        return fmt.Errorf("config: invalid value for server.mode %q, must be one of %q, %q or %q",
+            c.Server.Mode, gin.DebugMode, gin.ReleaseMode, gin.TestMode)
+    }
+
+    return nil
+}
+
+// lookupField will get field by its name
+func lookupField(name string) field {
+    for _, f := range fields {
+        if f.name == name {
+            return f
+        }
+    }
+    panic("config: unknown field " + name)
+}
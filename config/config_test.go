@@ -0,0 +1,350 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv will make sure no environment variable from the test machine
+// leaking to the test
+func clearEnv(t *testing.T) {
+    t.Helper()
+    t.Setenv(configEnv, "")
+    for _, f := range fields {
+        t.Setenv(f.env, "")
+    }
+}
+
+// writeConfigFile will write 'content' to temporary config file and return its path
+func writeConfigFile(t *testing.T, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "config.yaml")
+    err := ioutil.WriteFile(path, []byte(content), 0600)
+    require.NoError(t, err)
+
+    return path
+}
+
+// newFlagSet will create new flag set for each test so flags can be re-registered
+func newFlagSet() *flag.FlagSet {
+    fs := flag.NewFlagSet("test", flag.ContinueOnError)
+    fs.SetOutput(ioutil.Discard)
+    return fs
+}
+
+// TestLoad will test configuration loading and its precedence
+func TestLoad(t *testing.T) {
+    file := `
+database:
+  hostname: filehost
+  port: 6543
+  username: fileuser
+  password: filepass
+  dbname: filedb
+server:
+  address: ":9000"
+  mode: debug
+`
+
+    t.Run("EXPECT SUCCESS default and env", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("PGUSER", "golang")
+        t.Setenv("PGPASSWORD", "golang")
+        t.Setenv("PGDATABASE", "golangtest")
+
+        got, err := Load(newFlagSet(), nil)
+        require.NoError(t, err)
+
+        assert.Equal(t, "localhost", got.Database.Hostname)
+        assert.Equal(t, "5432", got.Database.Port)
+        assert.Equal(t, "golang", got.Database.Username)
+        assert.Equal(t, "golang", got.Database.Password)
+        assert.Equal(t, "golangtest", got.Database.DBName)
+        assert.Equal(t, ":8000", got.Server.Address)
+        assert.Equal(t, "release", got.Server.Mode)
+        assert.Equal(t, time.Duration(time.Second*2), got.Server.HealthTimeout)
+        assert.Equal(t, time.Duration(time.Second*15), got.Server.ShutdownTimeout)
+    })
+
+    t.Run("EXPECT SUCCESS config file", func(t *testing.T) {
+        clearEnv(t)
+        path := writeConfigFile(t, file)
+
+        got, err := Load(newFlagSet(), []string{"-config", path})
+        require.NoError(t, err)
+
+        assert.Equal(t, "filehost", got.Database.Hostname)
+        assert.Equal(t, "6543", got.Database.Port)
+        assert.Equal(t, "fileuser", got.Database.Username)
+        assert.Equal(t, "filepass", got.Database.Password)
+        assert.Equal(t, "filedb", got.Database.DBName)
+        assert.Equal(t, ":9000", got.Server.Address)
+        assert.Equal(t, "debug", got.Server.Mode)
+    })
+
+    t.Run("EXPECT SUCCESS flag over env over file", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv(configEnv, writeConfigFile(t, file))
+        t.Setenv("PGUSER", "envuser")
+        t.Setenv("PGHOST", "envhost")
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "flaguser", "-mode", "test"})
+        require.NoError(t, err)
+
+        assert.Equal(t, "flaguser", got.Database.Username)
+        assert.Equal(t, "envhost", got.Database.Hostname)
+        assert.Equal(t, "filedb", got.Database.DBName)
+        assert.Equal(t, "test", got.Server.Mode)
+    })
+
+    t.Run("EXPECT SUCCESS connection parameters", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("PGSSLMODE", "disable")
+        t.Setenv("PGCONNECT_TIMEOUT", "10")
+
+        got, err := Load(newFlagSet(), []string{
+            "-db-user", "golang", "-db-name", "golangtest",
+            "-db-application-name", "pgxtest", "-db-search-path", "app,public",
+        })
+        require.NoError(t, err)
+
+        assert.Equal(t, "disable", got.Database.SSLMode)
+        assert.Equal(t, time.Duration(time.Second*10), got.Database.ConnectTimeout)
+        assert.Equal(t, "pgxtest", got.Database.ApplicationName)
+        assert.Equal(t, "app,public", got.Database.SearchPath)
+    })
+
+    t.Run("EXPECT SUCCESS pool tuning", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("APP_DB_MAX_CONNS", "25")
+        t.Setenv("APP_DB_MAX_CONN_IDLE_TIME", "30m")
+
+        got, err := Load(newFlagSet(), []string{
+            "-db-user", "golang", "-db-name", "golangtest",
+            "-db-min-conns", "5", "-db-health-check-period", "1m",
+        })
+        require.NoError(t, err)
+
+        assert.Equal(t, int32(25), got.Database.MaxConns)
+        assert.Equal(t, int32(5), got.Database.MinConns)
+        assert.Equal(t, time.Duration(time.Minute*30), got.Database.MaxConnIdleTime)
+        assert.Equal(t, time.Duration(time.Minute), got.Database.HealthCheckPeriod)
+    })
+
+    t.Run("EXPECT FAIL invalid pool size", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("APP_DB_MAX_CONNS", "many")
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest"})
+        assert.Nil(t, got)
+        require.Error(t, err)
+        assert.Contains(t, err.Error(), "database.max_conns")
+    })
+
+    t.Run("EXPECT SUCCESS retry", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("APP_DB_RETRY_MAX_ATTEMPTS", "5")
+        t.Setenv("APP_DB_RETRY_TIMEOUT", "30s")
+
+        got, err := Load(newFlagSet(), []string{
+            "-db-user", "golang", "-db-name", "golangtest",
+            "-db-retry-jitter", "0.5", "-db-retry-initial-backoff", "200ms",
+        })
+        require.NoError(t, err)
+
+        assert.Equal(t, 5, got.Database.Retry.MaxAttempts)
+        assert.Equal(t, time.Duration(time.Second*30), got.Database.Retry.Timeout)
+        assert.Equal(t, time.Duration(time.Millisecond*200), got.Database.Retry.InitialBackoff)
+        assert.Equal(t, 0.5, got.Database.Retry.Jitter)
+        assert.Equal(t, float64(2), got.Database.Retry.Multiplier)
+    })
+
+    t.Run("EXPECT FAIL invalid jitter", func(t *testing.T) {
+        clearEnv(t)
+
+        got, err := Load(newFlagSet(), []string{
+            "-db-user", "golang", "-db-name", "golangtest", "-db-retry-jitter", "2",
+        })
+        assert.Nil(t, got)
+        require.Error(t, err)
+        assert.Contains(t, err.Error(), "database.retry.jitter")
+    })
+
+    t.Run("EXPECT SUCCESS auto migrate", func(t *testing.T) {
+        clearEnv(t)
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest", "-auto-migrate"})
+        require.NoError(t, err)
+        assert.True(t, got.Migration.Auto)
+
+        t.Setenv("APP_AUTO_MIGRATE", "true")
+        got, err = Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest", "-auto-migrate=false"})
+        require.NoError(t, err)
+        assert.False(t, got.Migration.Auto)
+    })
+
+    t.Run("EXPECT SUCCESS shutdown setting", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("APP_SHUTDOWN_DELAY", "5")
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest", "-shutdown-timeout", "30s"})
+        require.NoError(t, err)
+        assert.Equal(t, time.Duration(time.Second*5), got.Server.ShutdownDelay)
+        assert.Equal(t, time.Duration(time.Second*30), got.Server.ShutdownTimeout)
+    })
+
+    t.Run("EXPECT FAIL negative shutdown timeout", func(t *testing.T) {
+        clearEnv(t)
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest", "-shutdown-timeout", "-1s"})
+        assert.Error(t, err)
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT SUCCESS query timeout", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("APP_DB_QUERY_TIMEOUT_GETS", "30s")
+        path := writeConfigFile(t, `
+database:
+  username: golang
+  dbname: golangtest
+  query_timeout:
+    default: 3s
+    create: 1s
+`)
+
+        got, err := Load(newFlagSet(), []string{"-config", path, "-db-query-timeout-get", "500ms"})
+        require.NoError(t, err)
+        assert.Equal(t, time.Duration(time.Second*3), got.Database.QueryTimeout.Default)
+        assert.Equal(t, time.Duration(time.Second), got.Database.QueryTimeout.Create)
+        assert.Equal(t, time.Duration(time.Millisecond*500), got.Database.QueryTimeout.Get)
+        assert.Equal(t, time.Duration(time.Second*30), got.Database.QueryTimeout.Gets)
+    })
+
+    t.Run("EXPECT SUCCESS password hashing", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("APP_PASSWORD_ALGORITHM", "bcrypt")
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest", "-password-bcrypt-cost", "12"})
+        require.NoError(t, err)
+        assert.Equal(t, "bcrypt", got.Password.Algorithm)
+        assert.Equal(t, 12, got.Password.BcryptCost)
+    })
+
+    t.Run("EXPECT FAIL unknown password algorithm", func(t *testing.T) {
+        clearEnv(t)
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest", "-password-algorithm", "md5"})
+        assert.Error(t, err)
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT SUCCESS purge", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("APP_PURGE_RETENTION", "0")
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest", "-purge-interval", "10m"})
+        require.NoError(t, err)
+        assert.Zero(t, got.Purge.Retention)
+        assert.Equal(t, time.Duration(time.Minute*10), got.Purge.Interval)
+        assert.Equal(t, time.Duration(time.Hour*24*30), Default().Purge.Retention)
+    })
+
+    t.Run("EXPECT SUCCESS auth", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("APP_AUTH_SECRET", "0123456789abcdef0123456789abcdef")
+        t.Setenv("APP_AUTH_ACCESS_TTL", "300")
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest", "-auth-refresh-ttl", "24h"})
+        require.NoError(t, err)
+        assert.Equal(t, "HS256", got.Auth.Algorithm)
+        assert.Equal(t, "0123456789abcdef0123456789abcdef", got.Auth.Secret)
+        assert.Equal(t, "pgxtest", got.Auth.Issuer)
+        assert.Equal(t, time.Duration(time.Minute*5), got.Auth.AccessTTL)
+        assert.Equal(t, time.Duration(time.Hour*24), got.Auth.RefreshTTL)
+    })
+
+    t.Run("EXPECT FAIL invalid auth setting", func(t *testing.T) {
+        for _, args := range [][]string{
+            {"-auth-algorithm", "RS256"},
+            {"-auth-access-ttl", "0"},
+        } {
+            clearEnv(t)
+            got, err := Load(newFlagSet(), append([]string{"-db-user", "golang", "-db-name", "golangtest"}, args...))
+            assert.Error(t, err, args)
+            assert.Nil(t, got)
+        }
+    })
+
+    t.Run("EXPECT FAIL invalid sslmode", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("PGSSLMODE", "always")
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest"})
+        assert.Nil(t, got)
+        assert.Error(t, err)
+    })
+
+    t.Run("EXPECT FAIL invalid connect timeout", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("PGCONNECT_TIMEOUT", "soon")
+
+        got, err := Load(newFlagSet(), []string{"-db-user", "golang", "-db-name", "golangtest"})
+        assert.Nil(t, got)
+        require.Error(t, err)
+        assert.Contains(t, err.Error(), "database.connect_timeout")
+    })
+
+    t.Run("EXPECT FAIL missing required field", func(t *testing.T) {
+        clearEnv(t)
+        t.Setenv("PGDATABASE", "golangtest")
+
+        got, err := Load(newFlagSet(), nil)
+        assert.Nil(t, got)
+        require.Error(t, err)
+        assert.Contains(t, err.Error(), "database.username")
+        assert.Contains(t, err.Error(), "PGUSER")
+    })
+
+    t.Run("EXPECT FAIL invalid mode", func(t *testing.T) {
+        clearEnv(t)
+
+        got, err := Load(newFlagSet(), []string{
+            "-db-user", "golang", "-db-name", "golangtest", "-mode", "production",
+        })
+        assert.Nil(t, got)
+        require.Error(t, err)
+        assert.Contains(t, err.Error(), "server.mode")
+    })
+
+    t.Run("EXPECT FAIL unknown config key", func(t *testing.T) {
+        clearEnv(t)
+        path := writeConfigFile(t, "database:\n  hostnme: typo\n")
+
+        got, err := Load(newFlagSet(), []string{"-config", path})
+        assert.Nil(t, got)
+        assert.Error(t, err)
+    })
+
+    t.Run("EXPECT FAIL config file not found", func(t *testing.T) {
+        clearEnv(t)
+
+        got, err := Load(newFlagSet(), []string{"-config", "/not/exist.yaml"})
+        assert.Nil(t, got)
+        assert.Error(t, err)
+    })
+
+    t.Run("EXPECT FAIL unknown flag", func(t *testing.T) {
+        clearEnv(t)
+
+        got, err := Load(newFlagSet(), []string{"-unknown"})
+        assert.Nil(t, got)
+        assert.Error(t, err)
+    })
+}
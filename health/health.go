@@ -0,0 +1,183 @@
+/*
+    package health
+    health.go
+    - liveness and readiness probe of the application. readiness check the
+      database connection and report the connection pool statistic
+*/
+package health
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// status value of the response and each check
+const (
+    StatusOK   = "ok"
+    StatusFail = "fail"
+)
+
+// defaultTimeout is database ping timeout used when the timeout is not set
+const defaultTimeout = time.Duration(time.Second * 2)
+
+// errDatabaseUnavailable is error of the failing database check, the probe is
+// unauthenticated so the driver error (host, user, database) is only logged
+const errDatabaseUnavailable = "database unavailable"
+
+// Pinger is database interface needed by the checker, satisfied by pgxpool.Pool
+type Pinger interface {
+    Ping(context.Context) error
+}
+
+// Check is result of single check
+type Check struct {
+    Status    string  `json:"status"`
+    LatencyMS float64 `json:"latency_ms,omitempty"`
+    Error     string  `json:"error,omitempty"`
+}
+
+// PoolStats is connection pool statistic taken from pgxpool.Stat
+type PoolStats struct {
+    TotalConns           int32   `json:"total_conns"`
+    IdleConns            int32   `json:"idle_conns"`
+    AcquiredConns        int32   `json:"acquired_conns"`
+    ConstructingConns    int32   `json:"constructing_conns"`
+    MaxConns             int32   `json:"max_conns"`
+    AcquireCount         int64   `json:"acquire_count"`
+    AcquireDurationMS    float64 `json:"acquire_duration_ms"`
+    EmptyAcquireCount    int64   `json:"empty_acquire_count"`
+    CanceledAcquireCount int64   `json:"canceled_acquire_count"`
+}
+
+// NewPoolStats will convert pgxpool.Stat to PoolStats
+func NewPoolStats(s *pgxpool.Stat) *PoolStats {
+    return &PoolStats{
+        TotalConns:           s.TotalConns(),
+        IdleConns:            s.IdleConns(),
+        AcquiredConns:        s.AcquiredConns(),
+        ConstructingConns:    s.ConstructingConns(),
+        MaxConns:             s.MaxConns(),
+        AcquireCount:         s.AcquireCount(),
+        AcquireDurationMS:    milliseconds(s.AcquireDuration()),
+        EmptyAcquireCount:    s.EmptyAcquireCount(),
+        CanceledAcquireCount: s.CanceledAcquireCount(),
+    }
+}
+
+// Response is response of the probe endpoint
+type Response struct {
+    Status string           `json:"status"`
+    Uptime string           `json:"uptime,omitempty"`
+    Checks map[string]Check `json:"checks,omitempty"`
+    Pool   *PoolStats       `json:"pool,omitempty"`
+}
+
+// Checker is liveness and readiness checker of the application
+type Checker struct {
+    db       Pinger
+    stat     func() *pgxpool.Stat
+    timeout  time.Duration
+    started  time.Time
+    draining int32
+}
+
+// New will create checker instance. 'stat' is used to report the pool
+// statistic and can be nil, eg pgxpool.Pool.Stat. 'timeout' is maximum time
+// to wait for the database ping, zero will use 2 seconds
+func New(db Pinger, stat func() *pgxpool.Stat, timeout time.Duration) *Checker {
+    if timeout <= 0 {
+        timeout = defaultTimeout
+    }
+
+    return &Checker{db: db, stat: stat, timeout: timeout, started: time.Now()}
+}
+
+// Drain will mark the server as draining, so readiness start failing
+func (c *Checker) Drain() {
+    atomic.StoreInt32(&c.draining, 1)
+}
+
+// Draining will report whether the server is draining
+func (c *Checker) Draining() bool {
+    return atomic.LoadInt32(&c.draining) == 1
+}
+
+// Liveness will report the process is alive, it does not check the database
+// so the process is not restarted while the database is down
+func (c *Checker) Liveness() Response {
+    return Response{
+        Status: StatusOK,
+        Uptime: time.Since(c.started).Round(time.Second).String(),
+    }
+}
+
+// Readiness will check whether the server can serve request: the server is
+// not draining and the database can be reached within the timeout
+func (c *Checker) Readiness(ctx context.Context) Response {
+    res := Response{Status: StatusOK, Checks: make(map[string]Check, 2)}
+
+    server := Check{Status: StatusOK}
+    if c.Draining() {
+        server = Check{Status: StatusFail, Error: "server is shutting down"}
+    }
+    res.Checks["server"] = server
+
+    res.Checks["database"] = c.ping(ctx)
+
+    for _, check := range res.Checks {
+        if check.Status != StatusOK {
+            res.Status = StatusFail
+        }
+    }
+
+    if c.stat != nil {
+        res.Pool = NewPoolStats(c.stat())
+    }
+
+    return res
+}
+
+// ping will ping the database and measure its latency
+func (c *Checker) ping(ctx context.Context) Check {
+    ctx, cancel := context.WithTimeout(ctx, c.timeout)
+    defer cancel()
+
+    start := time.Now()
+    err := c.db.Ping(ctx)
+    check := Check{Status: StatusOK, LatencyMS: milliseconds(time.Since(start))}
+    if err != nil {
+        log.Printf("readiness: pinging database: %v\n", err)
+        check.Status = StatusFail
+        check.Error = errDatabaseUnavailable
+    }
+
+    return check
+}
+
+// LivenessHandler is liveness probe handler, eg GET /healthz
+func (c *Checker) LivenessHandler(ctx *gin.Context) {
+    ctx.JSON(http.StatusOK, c.Liveness())
+}
+
+// ReadinessHandler is readiness probe handler, eg GET /readyz. it return 503
+// if any of the check fail
+func (c *Checker) ReadinessHandler(ctx *gin.Context) {
+    res := c.Readiness(ctx.Request.Context())
+    if res.Status != StatusOK {
+        ctx.JSON(http.StatusServiceUnavailable, res)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, res)
+}
+
+// milliseconds will convert 'd' to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+    return float64(d) / float64(time.Millisecond)
+}
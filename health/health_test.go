@@ -0,0 +1,134 @@
+/*
+    package health
+    health_test.go
+    - test liveness and readiness probe
+*/
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestChecker will prepare pgxmock pool monitoring ping and checker for the test
+func newTestChecker(t *testing.T, stat func() *pgxpool.Stat) (pgxmock.PgxPoolIface, *Checker) {
+    t.Helper()
+    mock, err := pgxmock.NewPool(pgxmock.MonitorPingsOption(true))
+    if err != nil {
+        t.Fatalf("error creating stub connection: %v\n", err)
+    }
+    t.Cleanup(mock.Close)
+
+    return mock, New(mock, stat, 50*time.Millisecond)
+}
+
+// lazyPoolStat will get Stat function of pool that never connect to database
+func lazyPoolStat(t *testing.T) func() *pgxpool.Stat {
+    t.Helper()
+    cfg, err := pgxpool.ParseConfig("postgres://user@localhost:5432/testdb?pool_max_conns=7")
+    require.NoError(t, err)
+    cfg.LazyConnect = true
+
+    pool, err := pgxpool.ConnectConfig(context.Background(), cfg)
+    require.NoError(t, err)
+    t.Cleanup(pool.Close)
+
+    return pool.Stat
+}
+
+// serve will serve 'path' request using checker handlers and decode the response
+func serve(t *testing.T, c *Checker, path string) (int, Response) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.GET("/healthz", c.LivenessHandler)
+    r.GET("/readyz", c.ReadinessHandler)
+
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+    var res Response
+    require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+    return w.Code, res
+}
+
+// TestLivenessHandler will test liveness probe
+func TestLivenessHandler(t *testing.T) {
+    // liveness must not touch the database
+    mock, c := newTestChecker(t, nil)
+
+    code, res := serve(t, c, "/healthz")
+
+    assert.Equal(t, http.StatusOK, code)
+    assert.Equal(t, StatusOK, res.Status)
+    assert.NotEmpty(t, res.Uptime)
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestReadinessHandler will test readiness probe
+func TestReadinessHandler(t *testing.T) {
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        mock, c := newTestChecker(t, lazyPoolStat(t))
+        mock.ExpectPing()
+
+        code, res := serve(t, c, "/readyz")
+
+        assert.Equal(t, http.StatusOK, code)
+        assert.Equal(t, StatusOK, res.Status)
+        assert.Equal(t, StatusOK, res.Checks["database"].Status)
+        assert.Equal(t, StatusOK, res.Checks["server"].Status)
+        require.NotNil(t, res.Pool)
+        assert.Equal(t, int32(7), res.Pool.MaxConns)
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT FAIL database down", func(t *testing.T) {
+        mock, c := newTestChecker(t, nil)
+        mock.ExpectPing().WillReturnError(errors.New("failed to connect to `host=db user=app database=users`: connection refused"))
+
+        code, res := serve(t, c, "/readyz")
+
+        // the driver error is not exposed
+        assert.Equal(t, http.StatusServiceUnavailable, code)
+        assert.Equal(t, StatusFail, res.Status)
+        assert.Equal(t, StatusFail, res.Checks["database"].Status)
+        assert.Equal(t, errDatabaseUnavailable, res.Checks["database"].Error)
+        assert.Nil(t, res.Pool)
+    })
+
+    t.Run("EXPECT FAIL ping timeout", func(t *testing.T) {
+        mock, c := newTestChecker(t, nil)
+        mock.ExpectPing().WillDelayFor(time.Second)
+
+        start := time.Now()
+        code, res := serve(t, c, "/readyz")
+
+        assert.Equal(t, http.StatusServiceUnavailable, code)
+        assert.Equal(t, StatusFail, res.Checks["database"].Status)
+        assert.Less(t, time.Since(start), time.Second)
+    })
+
+    t.Run("EXPECT FAIL draining", func(t *testing.T) {
+        mock, c := newTestChecker(t, nil)
+        mock.ExpectPing()
+        c.Drain()
+
+        code, res := serve(t, c, "/readyz")
+
+        assert.Equal(t, http.StatusServiceUnavailable, code)
+        assert.Equal(t, StatusFail, res.Checks["server"].Status)
+        assert.Equal(t, StatusOK, res.Checks["database"].Status)
+    })
+}
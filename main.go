@@ -1,61 +1,121 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
 	"pgxtest/account"
-
-	"github.com/gin-gonic/gin"
+	"pgxtest/config"
+	"strings"
 )
 
 func main() {
     // separate the code from the 'main' function so we can test it.
     // all code that available in main function were not testable
-    Run()
-}
-
-func Run() {
-    // prepare gin
-    // uncomment below mode if want to get back to default debug mode
-    gin.SetMode(gin.ReleaseMode)
-
-    // gin with default setup
-    r := gin.New()
-    // r.Use(gin.Logger())
-    r.Use(gin.Recovery())
-
-    // prepare database, remember to create "golangtest" database first
-    dbPool, _, err := account.NewDBPool(account.DatabaseConfig{
-        Username : "golang",
-        Password : "golang",
-        Hostname : "localhost",
-        Port : "5432",
-        DBName : "golangtest",
-    })
-    
-    defer dbPool.Close()
-
-    // log for error if error occur while connecting to the database
+    if err := Run(os.Args[1:], os.Stdout); err != nil {
+        log.Fatalf("%v\n", err)
+    }
+}
+
+// command is single subcommand of the application
+type command struct {
+    name  string
+    usage string
+    run   func(args []string, out io.Writer) error
+}
+
+// commands is list of available subcommand
+var commands = []command{
+    {"serve", "start the http server", serveCmd},
+    {"migrate", "manage database migration (up, down, status)", migrateCmd},
+    {"seed", "load fixture users into the database", seedCmd},
+    {"user", "manage users (create, get, list, delete, restore)", userCmd},
+}
+
+// Run will run subcommand from 'args' and write the command output to 'out'.
+// 'serve' is used when no command is given, so "main -config app.yaml" will
+// still start the server
+func Run(args []string, out io.Writer) error {
+    name := "serve"
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        name, args = args[0], args[1:]
+    }
+
+    for _, cmd := range commands {
+        if cmd.name == name {
+            err := cmd.run(args, out)
+
+            // help was requested, the usage is already printed by the flag set
+            if errors.Is(err, flag.ErrHelp) {
+                return nil
+            }
+            return err
+        }
+    }
+
+    if name != "help" {
+        fmt.Fprintf(out, "unknown command %q\n\n", name)
+    }
+    usage(out)
+    if name != "help" {
+        return fmt.Errorf("unknown command %q", name)
+    }
+
+    return nil
+}
+
+// usage will print list of available command to 'out'
+func usage(out io.Writer) {
+    fmt.Fprintf(out, "usage: %s <command> [flags] [args]\n\ncommands:\n", os.Args[0])
+    for _, cmd := range commands {
+        fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.usage)
+    }
+    fmt.Fprintf(out, "\nrun '%s <command> -h' to see the flags of the command\n", os.Args[0])
+}
+
+// loadConfig will load configuration using 'fs', command specific flags must
+// be registered to 'fs' before calling it. the remaining non-flag arguments
+// are available from fs.Args()
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, error) {
+    cfg, err := config.Load(fs, args)
+    if err != nil {
+        // return flag.ErrHelp as is so it can be handled by Run
+        if errors.Is(err, flag.ErrHelp) {
+            return nil, err
+        }
+        return nil, fmt.Errorf("unexpected error while loading configuration: %w", err)
+    }
+
+    return cfg, nil
+}
+
+// connect will create database pool using 'cfg' and return function to close
+// the pool. connection will be retried while the database is starting
+func connect(ctx context.Context, cfg *config.Config) (account.Datastore, func(), error) {
+    ds, closeDB, err := account.NewDBPool(ctx, cfg.Database)
     if err != nil {
-        log.Fatalf("unexpected error while tried to connect to database: %v\n", err)
+        return ds, closeDB, fmt.Errorf("unexpected error while tried to connect to database: %w", err)
     }
 
-    // datastore := account.NewDatastore(dbPool)
-    accDB := account.NewDatabase(dbPool)
-    accService := account.NewAccountService(accDB)
-    accAPI := account.NewAccountHandler(accService)
+    info := ds.ServerInfo()
+    log.Printf("connected to database %q as %q (PostgreSQL %s, encoding %s, timezone %s, hot standby %t)\n",
+        info.Database, info.User, info.Version, info.Encoding, info.TimeZone, info.HotStandby)
 
-    // prepare router
-    // main group api endpoint url : http://domain.com/v1
-    v1 := r.Group("/v1")
+    return ds, closeDB, nil
+}
 
-    // account app group api endpoint : http://domainname.com/v1/account
-    accRouter := v1.Group("/account")
-    accRouter.POST("/", accAPI.UserCreateHandler)
-    accRouter.PUT("/:id", accAPI.UserUpdateHandler)
-    accRouter.DELETE("/:id", accAPI.UserDeleteHandler)
-    accRouter.GET("/:id", accAPI.UserGetHandler)
-    accRouter.GET("/", accAPI.UserGetsHandler)
+// newAccountService will create account service using 'db' with the query
+// timeout and passkey hashing from 'cfg'
+func newAccountService(db account.PgxIface, cfg *config.Config) (account.AccountService, error) {
+    hasher, err := cfg.Password.Hasher()
+    if err != nil {
+        return nil, err
+    }
 
-    // run the server
-    log.Fatalf("%v", r.Run(":8000"))
+    accDB := account.NewDatabase(db).WithTimeouts(cfg.Database.QueryTimeout)
+    return account.NewAccountService(accDB).WithHasher(hasher), nil
 }
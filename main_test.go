@@ -0,0 +1,298 @@
+/*
+    main_test.go
+    - test command dispatching and the command helpers
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"pgxtest/account"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+    // user table columns
+    columns = []string{"id", "firstname", "lastname", "email", "passkey", "role", "version", "created_at", "updated_at", "created_by", "updated_by", "deleted_at"}
+
+    // query executed by account repository
+    getsQuery    = `SELECT id, firstname, COALESCE(lastname, '') AS lastname, email, passkey, role, version,
+    created_at, updated_at, created_by, updated_by, deleted_at FROM users`
+    createQuery  = `INSERT INTO users (firstname,lastname,email,passkey,role,created_by,updated_by)`
+    deleteQuery  = `UPDATE users SET
+            deleted_at = now(),`
+    restoreQuery = `UPDATE users SET
+            deleted_at = NULL,`
+    lockQuery    = `FROM users WHERE id = $1 FOR UPDATE`
+    auditQuery   = `INSERT INTO account_audit (user_id,actor_id,action,changes,request_id)`
+)
+
+// newTestService will prepare pgxmock pool and account service for the test
+func newTestService(t *testing.T) (pgxmock.PgxPoolIface, account.AccountService) {
+    t.Helper()
+    mock, err := pgxmock.NewPool()
+    if err != nil {
+        t.Fatalf("error creating stub connection: %v\n", err)
+    }
+    t.Cleanup(mock.Close)
+
+    // low cost hasher to keep the test fast, the passkey argument is matched
+    // using pgxmock.AnyArg since the hash use random salt
+    hasher := account.Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+    return mock, account.NewAccountService(account.NewDatabase(mock)).WithHasher(hasher)
+}
+
+// TestRun will test command dispatching
+func TestRun(t *testing.T) {
+    t.Run("EXPECT SUCCESS help", func(t *testing.T) {
+        var out bytes.Buffer
+        err := Run([]string{"help"}, &out)
+
+        assert.NoError(t, err)
+        for _, cmd := range commands {
+            assert.Contains(t, out.String(), cmd.name)
+        }
+    })
+
+    t.Run("EXPECT SUCCESS command help", func(t *testing.T) {
+        var out bytes.Buffer
+        err := Run([]string{"user", "create", "-h"}, &out)
+
+        assert.NoError(t, err)
+        assert.Contains(t, out.String(), "-email")
+        assert.Contains(t, out.String(), "-db-user")
+    })
+
+    t.Run("EXPECT FAIL unknown command", func(t *testing.T) {
+        var out bytes.Buffer
+        err := Run([]string{"deploy"}, &out)
+
+        assert.Error(t, err)
+        assert.Contains(t, out.String(), "unknown command")
+    })
+
+    t.Run("EXPECT FAIL unknown action", func(t *testing.T) {
+        for _, args := range [][]string{
+            {"migrate"},
+            {"migrate", "sideways"},
+            {"user"},
+            {"user", "rename"},
+        } {
+            err := Run(args, &bytes.Buffer{})
+            assert.Error(t, err, args)
+        }
+    })
+}
+
+// TestRunUser will test user admin action
+func TestRunUser(t *testing.T) {
+    t.Run("EXPECT SUCCESS create", func(t *testing.T) {
+        mock, svc := newTestService(t)
+        u := account.User{Firstname: "john", Lastname: "doe", Email: "john@doe.com", PassKey: "secret123", Role: account.RoleAdmin}
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(createQuery)).
+            WithArgs(u.Firstname, u.Lastname, u.Email, pgxmock.AnyArg(), u.Role, nil).
+            WillReturnRows(mock.NewRows(columns).
+                AddRow(1, u.Firstname, u.Lastname, u.Email, u.PassKey, u.Role, 1, time.Now(), time.Now(), nil, nil, nil))
+        mock.ExpectExec(regexp.QuoteMeta(auditQuery)).
+            WithArgs(1, nil, account.ActionCreate, pgxmock.AnyArg(), "").
+            WillReturnResult(pgxmock.NewResult("INSERT", 1))
+        mock.ExpectCommit()
+
+        var out bytes.Buffer
+        err := runUser(context.Background(), svc, "create", 0, u, &out)
+
+        assert.NoError(t, err)
+        assert.Contains(t, out.String(), `"email": "john@doe.com"`)
+        assert.Contains(t, out.String(), `"role": "admin"`)
+        assert.NotContains(t, out.String(), "secret")
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT SUCCESS empty list", func(t *testing.T) {
+        mock, svc := newTestService(t)
+        mock.ExpectQuery(regexp.QuoteMeta(getsQuery)).
+            WillReturnRows(mock.NewRows(columns))
+
+        var out bytes.Buffer
+        err := runUser(context.Background(), svc, "list", 0, account.User{}, &out)
+
+        assert.NoError(t, err)
+        assert.Equal(t, "[]\n", out.String())
+    })
+
+    t.Run("EXPECT FAIL delete error", func(t *testing.T) {
+        mock, svc := newTestService(t)
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(lockQuery)).
+            WithArgs(99).
+            WillReturnRows(mock.NewRows(columns).
+                AddRow(99, "john", "doe", "john@doe.com", "hash", account.RoleUser, 1, time.Now(), time.Now(), nil, nil, nil))
+        mock.ExpectQuery(regexp.QuoteMeta(deleteQuery)).
+            WithArgs(99, 0, nil).
+            WillReturnError(errors.New("connection reset"))
+        mock.ExpectRollback()
+
+        var out bytes.Buffer
+        err := runUser(context.Background(), svc, "delete", 99, account.User{}, &out)
+
+        assert.Error(t, err)
+        assert.Empty(t, out.String())
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT SUCCESS restore", func(t *testing.T) {
+        mock, svc := newTestService(t)
+        deletedAt := time.Now()
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(lockQuery)).
+            WithArgs(2).
+            WillReturnRows(mock.NewRows(columns).
+                AddRow(2, "janne", "doe", "janne@doe.com", "hash", account.RoleUser, 2, time.Now(), time.Now(), nil, nil, &deletedAt))
+        mock.ExpectQuery(regexp.QuoteMeta(restoreQuery)).
+            WithArgs(2, 0, nil).
+            WillReturnRows(mock.NewRows(columns).
+                AddRow(2, "janne", "doe", "janne@doe.com", "hash", account.RoleUser, 3, time.Now(), time.Now(), nil, nil, nil))
+        mock.ExpectExec(regexp.QuoteMeta(auditQuery)).
+            WithArgs(2, nil, account.ActionRestore, pgxmock.AnyArg(), "").
+            WillReturnResult(pgxmock.NewResult("INSERT", 1))
+        mock.ExpectCommit()
+
+        var out bytes.Buffer
+        err := runUser(context.Background(), svc, "restore", 2, account.User{}, &out)
+
+        assert.NoError(t, err)
+        assert.Contains(t, out.String(), `"email": "janne@doe.com"`)
+        assert.NotContains(t, out.String(), "deleted_at")
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+}
+
+// TestSeedUsers will test loading fixture users
+func TestSeedUsers(t *testing.T) {
+    users, err := readFixture("")
+    require.NoError(t, err)
+    require.NotEmpty(t, users)
+
+    // the embedded fixture must never create admin with known passkey
+    for _, u := range users {
+        assert.NotEqual(t, account.RoleAdmin, u.Role, u.Email)
+    }
+
+    t.Run("EXPECT SUCCESS skip existing user", func(t *testing.T) {
+        mock, svc := newTestService(t)
+        first := users[0]
+        mock.ExpectQuery(regexp.QuoteMeta(getsQuery)).
+            WillReturnRows(mock.NewRows(columns).
+                AddRow(1, first.Firstname, first.Lastname, first.Email, first.PassKey, first.Role, 1, time.Now(), time.Now(), nil, nil, nil))
+        for i, u := range users[1:] {
+            mock.ExpectBegin()
+            mock.ExpectQuery(regexp.QuoteMeta(createQuery)).
+                WithArgs(u.Firstname, u.Lastname, u.Email, pgxmock.AnyArg(), account.RoleUser, nil).
+                WillReturnRows(mock.NewRows(columns).
+                    AddRow(i+2, u.Firstname, u.Lastname, u.Email, u.PassKey, account.RoleUser, 1, time.Now(), time.Now(), nil, nil, nil))
+            mock.ExpectExec(regexp.QuoteMeta(auditQuery)).
+                WithArgs(i+2, nil, account.ActionCreate, pgxmock.AnyArg(), "").
+                WillReturnResult(pgxmock.NewResult("INSERT", 1))
+            mock.ExpectCommit()
+        }
+
+        var out bytes.Buffer
+        err := seedUsers(context.Background(), svc, users, &out)
+
+        assert.NoError(t, err)
+        assert.Contains(t, out.String(), "skipped "+first.Email)
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT SUCCESS skip deleted user and email in other case", func(t *testing.T) {
+        mock, svc := newTestService(t)
+        deletedAt := time.Now()
+        rows := mock.NewRows(columns)
+        for i, u := range users {
+            rows.AddRow(i+1, u.Firstname, u.Lastname, strings.ToUpper(u.Email), u.PassKey, u.Role, 2, time.Now(), time.Now(), nil, nil, &deletedAt)
+        }
+        // deleted user is listed too, so there is no deleted_at filter
+        mock.ExpectQuery(regexp.QuoteMeta(getsQuery + ` ORDER BY`)).
+            WithArgs(account.MaxLimit + 1).
+            WillReturnRows(rows)
+
+        var out bytes.Buffer
+        err := seedUsers(context.Background(), svc, users, &out)
+
+        assert.NoError(t, err)
+        assert.Contains(t, out.String(), "0 user created")
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT FAIL create error", func(t *testing.T) {
+        mock, svc := newTestService(t)
+        mock.ExpectQuery(regexp.QuoteMeta(getsQuery)).
+            WillReturnRows(mock.NewRows(columns))
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(createQuery)).
+            WillReturnError(errors.New("duplicate key"))
+        mock.ExpectRollback()
+
+        err := seedUsers(context.Background(), svc, users, &bytes.Buffer{})
+
+        assert.Error(t, err)
+    })
+
+    t.Run("EXPECT FAIL missing fixture file", func(t *testing.T) {
+        got, err := readFixture("does-not-exist.json")
+
+        assert.Error(t, err)
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT FAIL admin in fixture file", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "users.json")
+        fixture := `[{"firstname": "john", "email": "john@doe.com", "passkey": "secret123", "role": "admin"}]`
+        require.NoError(t, ioutil.WriteFile(path, []byte(fixture), 0600))
+
+        got, err := readFixture(path)
+
+        require.Error(t, err)
+        assert.Contains(t, err.Error(), "john@doe.com")
+        assert.Nil(t, got)
+    })
+}
+
+// TestSeedAdmin will test admin seeded from flag or environment variable
+func TestSeedAdmin(t *testing.T) {
+    t.Run("EXPECT SUCCESS no admin", func(t *testing.T) {
+        got, err := seedAdmin("", "")
+
+        assert.NoError(t, err)
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT SUCCESS admin", func(t *testing.T) {
+        got, err := seedAdmin("root@doe.com", "Sup3r-secret")
+
+        require.NoError(t, err)
+        assert.Equal(t, account.RoleAdmin, got.Role)
+        assert.Equal(t, "root@doe.com", got.Email)
+        assert.Equal(t, "Sup3r-secret", got.PassKey)
+    })
+
+    t.Run("EXPECT FAIL only one given", func(t *testing.T) {
+        for _, args := range [][2]string{{"root@doe.com", ""}, {"", "Sup3r-secret"}} {
+            got, err := seedAdmin(args[0], args[1])
+
+            assert.Error(t, err, args)
+            assert.Nil(t, got, args)
+        }
+    })
+}
@@ -0,0 +1,132 @@
+/*
+    migrate.go
+    - 'migrate' command, apply, roll back and show status of database migration
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"pgxtest/migration"
+	"text/tabwriter"
+	"time"
+)
+
+// migrateCmd will run migration action from 'args', one of "up", "down" or
+// "status"
+func migrateCmd(args []string, out io.Writer) error {
+    if len(args) == 0 {
+        return fmt.Errorf("migrate: missing action (up, down or status)")
+    }
+    action, args := args[0], args[1:]
+    if action != "up" && action != "down" && action != "status" {
+        return fmt.Errorf("migrate: unknown action %q (up, down or status)", action)
+    }
+
+    fs := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+    fs.SetOutput(out)
+    steps := 1
+    if action == "down" {
+        fs.IntVar(&steps, "steps", 1, "number of migration to roll back")
+    }
+
+    cfg, err := loadConfig(fs, args)
+    if err != nil {
+        return err
+    }
+    if steps < 1 {
+        return fmt.Errorf("migrate: -steps must be at least 1")
+    }
+
+    ctx := context.Background()
+    ds, closeDB, err := connect(ctx, cfg)
+    if err != nil {
+        return err
+    }
+    defer closeDB()
+
+    switch action {
+    case "up":
+        _, err = migrateUp(ctx, ds.Pool(), out)
+    case "down":
+        _, err = migrateDown(ctx, ds.Pool(), steps, out)
+    default:
+        err = migrateStatus(ctx, ds.Pool(), out)
+    }
+
+    return err
+}
+
+// migrateUp will apply all pending migration and report it to 'out'
+func migrateUp(ctx context.Context, db migration.DB, out io.Writer) ([]migration.Migration, error) {
+    m, err := migration.New(db, migration.FS)
+    if err != nil {
+        return nil, fmt.Errorf("unexpected error while loading migration: %w", err)
+    }
+
+    applied, err := m.Up(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("unexpected error while migrating database: %w", err)
+    }
+
+    if len(applied) == 0 {
+        fmt.Fprintln(out, "database is up to date")
+    }
+    for _, mg := range applied {
+        fmt.Fprintf(out, "applied migration %d_%s\n", mg.Version, mg.Name)
+    }
+
+    return applied, nil
+}
+
+// migrateDown will roll back the last 'steps' migration and report it to 'out'
+func migrateDown(ctx context.Context, db migration.DB, steps int, out io.Writer) ([]migration.Migration, error) {
+    m, err := migration.New(db, migration.FS)
+    if err != nil {
+        return nil, fmt.Errorf("unexpected error while loading migration: %w", err)
+    }
+
+    rolledBack, err := m.Down(ctx, steps)
+    if err != nil {
+        return nil, fmt.Errorf("unexpected error while rolling back migration: %w", err)
+    }
+
+    if len(rolledBack) == 0 {
+        fmt.Fprintln(out, "no migration to roll back")
+    }
+    for _, mg := range rolledBack {
+        fmt.Fprintf(out, "rolled back migration %d_%s\n", mg.Version, mg.Name)
+    }
+
+    return rolledBack, nil
+}
+
+// migrateStatus will write status of all migration to 'out' as table
+func migrateStatus(ctx context.Context, db migration.DB, out io.Writer) error {
+    m, err := migration.New(db, migration.FS)
+    if err != nil {
+        return fmt.Errorf("unexpected error while loading migration: %w", err)
+    }
+
+    statuses, err := m.Status(ctx)
+    if err != nil {
+        return fmt.Errorf("unexpected error while reading migration status: %w", err)
+    }
+
+    w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+    for _, st := range statuses {
+        status, appliedAt := "pending", ""
+        if st.Applied {
+            status, appliedAt = "applied", st.AppliedAt.Format(time.RFC3339)
+        }
+        if st.Modified {
+            status = "modified"
+        }
+        fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", st.Version, st.Name, status, appliedAt)
+    }
+
+    return w.Flush()
+}
@@ -0,0 +1,379 @@
+/*
+    package migration
+    migration.go
+    - versioned database schema migration. migration files are embedded sql
+      files named "<version>_<name>.up.sql" and "<version>_<name>.down.sql",
+      applied migrations are recorded in 'schema_migrations' table
+*/
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// FS is embedded migration files of the application
+//go:embed sql/*.sql
+var FS embed.FS
+
+// migrationDir is directory inside FS containing the migration files
+const migrationDir = "sql"
+
+// lockKey is advisory lock key to prevent concurrent migration runner
+const lockKey int64 = 47352022001
+
+var (
+    // ErrChecksumMismatch is returned when applied migration file was modified
+    ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+    // ErrUnknownVersion is returned when applied migration has no migration file
+    ErrUnknownVersion = errors.New("applied migration version has no migration file")
+
+    // ErrNoDown is returned when rolling back migration that has no down file
+    ErrNoDown = errors.New("migration has no down file")
+)
+
+// DB is database interface needed by the migrator, satisfied by pgxpool.Pool
+type DB interface {
+    Begin(context.Context) (pgx.Tx, error)
+}
+
+// Migration is single versioned migration
+type Migration struct {
+    Version  int64
+    Name     string
+    Up       string
+    Down     string
+    Checksum string
+}
+
+// Status is status of single migration
+type Status struct {
+    Migration
+    Applied   bool
+    AppliedAt time.Time
+
+    // Modified is true if the migration file was changed after it is applied
+    Modified  bool
+}
+
+// Migrator is migration runner
+type Migrator struct {
+    db         DB
+    migrations []Migration
+}
+
+// New will create migrator using migration files from 'fsys'. use FS for the
+// application embedded migration files
+func New(db DB, fsys fs.FS) (*Migrator, error) {
+    migrations, err := Load(fsys)
+    if err != nil {
+        return nil, err
+    }
+
+    return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Migrations will get all loaded migration ordered by its version
+func (m *Migrator) Migrations() []Migration {
+    return m.migrations
+}
+
+// fileRe is pattern of migration file name
+var fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load will read and parse migration files from 'fsys'. files are read from
+// "sql" directory if it is exist, otherwise from the root of 'fsys'
+func Load(fsys fs.FS) ([]Migration, error) {
+    if st, err := fs.Stat(fsys, migrationDir); err == nil && st.IsDir() {
+        sub, err := fs.Sub(fsys, migrationDir)
+        if err != nil {
+            return nil, fmt.Errorf("reading migration files: %w", err)
+        }
+        fsys = sub
+    }
+
+    entries, err := fs.ReadDir(fsys, ".")
+    if err != nil {
+        return nil, fmt.Errorf("reading migration files: %w", err)
+    }
+
+    byVersion := make(map[int64]*Migration)
+    for _, e := range entries {
+        match := fileRe.FindStringSubmatch(e.Name())
+        if e.IsDir() || match == nil {
+            continue
+        }
+
+        version, err := strconv.ParseInt(match[1], 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid migration version %s: %w", e.Name(), err)
+        }
+
+        b, err := fs.ReadFile(fsys, e.Name())
+        if err != nil {
+            return nil, fmt.Errorf("reading migration file %s: %w", e.Name(), err)
+        }
+
+        // make sure up and down file of the same version has the same name
+        mg, ok := byVersion[version]
+        if !ok {
+            mg = &Migration{Version: version, Name: match[2]}
+            byVersion[version] = mg
+        }
+        if mg.Name != match[2] {
+            return nil, fmt.Errorf("duplicate migration version %d (%s and %s)", version, mg.Name, match[2])
+        }
+
+        if match[3] == "up" {
+            mg.Up = string(b)
+        } else {
+            mg.Down = string(b)
+        }
+    }
+
+    migrations := make([]Migration, 0, len(byVersion))
+    for _, mg := range byVersion {
+        if mg.Up == "" {
+            return nil, fmt.Errorf("migration %d_%s has no up file", mg.Version, mg.Name)
+        }
+        mg.Checksum = checksum(mg.Up)
+        migrations = append(migrations, *mg)
+    }
+
+    sort.Slice(migrations, func(i, j int) bool {
+        return migrations[i].Version < migrations[j].Version
+    })
+
+    return migrations, nil
+}
+
+// checksum will get sha256 checksum of migration sql
+func checksum(sql string) string {
+    sum := sha256.Sum256([]byte(sql))
+    return hex.EncodeToString(sum[:])
+}
+
+// appliedMigration is record of 'schema_migrations' table
+type appliedMigration struct {
+    version   int64
+    checksum  string
+    appliedAt time.Time
+}
+
+// Up will apply all pending migration in single transaction and return the
+// applied migrations
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+    var done []Migration
+
+    err := m.inLockedTx(ctx, func(tx pgx.Tx) error {
+        applied, err := m.verify(ctx, tx)
+        if err != nil {
+            return err
+        }
+
+        for _, mg := range m.migrations {
+            if _, ok := applied[mg.Version]; ok {
+                continue
+            }
+
+            if _, err := tx.Exec(ctx, mg.Up); err != nil {
+                return fmt.Errorf("applying migration %d_%s: %w", mg.Version, mg.Name, err)
+            }
+
+            q := `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`
+            if _, err := tx.Exec(ctx, q, mg.Version, mg.Name, mg.Checksum); err != nil {
+                return fmt.Errorf("recording migration %d_%s: %w", mg.Version, mg.Name, err)
+            }
+
+            done = append(done, mg)
+        }
+
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return done, nil
+}
+
+// Down will roll back the last 'steps' applied migration in single
+// transaction and return the rolled back migrations
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+    var done []Migration
+
+    err := m.inLockedTx(ctx, func(tx pgx.Tx) error {
+        applied, err := m.verify(ctx, tx)
+        if err != nil {
+            return err
+        }
+
+        // roll back from the newest applied migration
+        for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+            mg := m.migrations[i]
+            if _, ok := applied[mg.Version]; !ok {
+                continue
+            }
+            if mg.Down == "" {
+                return fmt.Errorf("%w: %d_%s", ErrNoDown, mg.Version, mg.Name)
+            }
+
+            if _, err := tx.Exec(ctx, mg.Down); err != nil {
+                return fmt.Errorf("rolling back migration %d_%s: %w", mg.Version, mg.Name, err)
+            }
+
+            q := `DELETE FROM schema_migrations WHERE version = $1`
+            if _, err := tx.Exec(ctx, q, mg.Version); err != nil {
+                return fmt.Errorf("removing migration record %d_%s: %w", mg.Version, mg.Name, err)
+            }
+
+            done = append(done, mg)
+        }
+
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return done, nil
+}
+
+// Status will get status of all migrations. the status is only read, so it
+// does not wait for the migration lock and every migration is pending if
+// 'schema_migrations' table does not exist yet
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+    tx, err := m.db.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("starting migration transaction: %w", err)
+    }
+
+    // nothing is written, the transaction is only for consistent read
+    defer tx.Rollback(ctx)
+
+    var exists bool
+    q := `SELECT to_regclass('schema_migrations') IS NOT NULL`
+    if err := tx.QueryRow(ctx, q).Scan(&exists); err != nil {
+        return nil, fmt.Errorf("checking schema_migrations table: %w", err)
+    }
+
+    applied := make(map[int64]appliedMigration)
+    if exists {
+        if applied, err = m.applied(ctx, tx); err != nil {
+            return nil, err
+        }
+    }
+
+    statuses := make([]Status, 0, len(m.migrations))
+    for _, mg := range m.migrations {
+        st := Status{Migration: mg}
+        if a, ok := applied[mg.Version]; ok {
+            st.Applied = true
+            st.AppliedAt = a.appliedAt
+            st.Modified = a.checksum != mg.Checksum
+        }
+        statuses = append(statuses, st)
+    }
+
+    return statuses, nil
+}
+
+// inLockedTx will run 'fn' inside transaction holding the migration advisory
+// lock, so only one migration runner can work at a time. the lock is released
+// when the transaction is finished
+func (m *Migrator) inLockedTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+    tx, err := m.db.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("starting migration transaction: %w", err)
+    }
+
+    // rollback is no-op if the transaction is already committed
+    defer tx.Rollback(ctx)
+
+    if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, lockKey); err != nil {
+        return fmt.Errorf("acquiring migration lock: %w", err)
+    }
+
+    q := `CREATE TABLE IF NOT EXISTS schema_migrations (
+            version bigint PRIMARY KEY,
+            name text NOT NULL,
+            checksum text NOT NULL,
+            applied_at timestamptz NOT NULL DEFAULT now()
+          )`
+    if _, err := tx.Exec(ctx, q); err != nil {
+        return fmt.Errorf("creating schema_migrations table: %w", err)
+    }
+
+    if err := fn(tx); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return fmt.Errorf("committing migration transaction: %w", err)
+    }
+
+    return nil
+}
+
+// applied will get applied migration from 'schema_migrations' table
+func (m *Migrator) applied(ctx context.Context, tx pgx.Tx) (map[int64]appliedMigration, error) {
+    q := `SELECT version, checksum, applied_at FROM schema_migrations ORDER BY version`
+    rows, err := tx.Query(ctx, q)
+    if err != nil {
+        return nil, fmt.Errorf("reading applied migration: %w", err)
+    }
+    defer rows.Close()
+
+    applied := make(map[int64]appliedMigration)
+    for rows.Next() {
+        var a appliedMigration
+        if err := rows.Scan(&a.version, &a.checksum, &a.appliedAt); err != nil {
+            return nil, fmt.Errorf("reading applied migration: %w", err)
+        }
+        applied[a.version] = a
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("reading applied migration: %w", err)
+    }
+
+    return applied, nil
+}
+
+// verify will get applied migration and make sure each of it still has the
+// same migration file as when it was applied
+func (m *Migrator) verify(ctx context.Context, tx pgx.Tx) (map[int64]appliedMigration, error) {
+    applied, err := m.applied(ctx, tx)
+    if err != nil {
+        return nil, err
+    }
+
+    known := make(map[int64]Migration, len(m.migrations))
+    for _, mg := range m.migrations {
+        known[mg.Version] = mg
+    }
+
+    for version, a := range applied {
+        mg, ok := known[version]
+        if !ok {
+            return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+        }
+        if mg.Checksum != a.checksum {
+            return nil, fmt.Errorf("%w: %d_%s was modified after it was applied",
+                ErrChecksumMismatch, mg.Version, mg.Name)
+        }
+    }
+
+    return applied, nil
+}
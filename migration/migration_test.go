@@ -0,0 +1,301 @@
+/*
+    package migration
+    migration_test.go
+    - test migration file loading and migration runner
+*/
+package migration
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+    // migration files for the test
+    testFS = fstest.MapFS{
+        "0001_create_foo.up.sql":   {Data: []byte("CREATE TABLE foo (id int)")},
+        "0001_create_foo.down.sql": {Data: []byte("DROP TABLE foo")},
+        "0002_create_bar.up.sql":   {Data: []byte("CREATE TABLE bar (id int)")},
+        "README.md":                {Data: []byte("not a migration")},
+    }
+
+    // query executed by the migrator
+    lockQuery    = `SELECT pg_advisory_xact_lock($1)`
+    createQuery  = `CREATE TABLE IF NOT EXISTS schema_migrations`
+    appliedQuery = `SELECT version, checksum, applied_at FROM schema_migrations ORDER BY version`
+    insertQuery  = `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`
+    deleteQuery  = `DELETE FROM schema_migrations WHERE version = $1`
+    existsQuery  = `SELECT to_regclass('schema_migrations') IS NOT NULL`
+
+    appliedColumns = []string{"version", "checksum", "applied_at"}
+)
+
+// newTestMigrator will prepare pgxmock pool and migrator for the test
+func newTestMigrator(t *testing.T) (pgxmock.PgxPoolIface, *Migrator) {
+    t.Helper()
+    mock, err := pgxmock.NewPool()
+    if err != nil {
+        t.Fatalf("error creating stub connection: %v\n", err)
+    }
+    t.Cleanup(mock.Close)
+
+    m, err := New(mock, testFS)
+    require.NoError(t, err)
+
+    return mock, m
+}
+
+// expectLock will prepare expectation for starting locked migration transaction
+func expectLock(mock pgxmock.PgxPoolIface) {
+    mock.ExpectBegin()
+    mock.ExpectExec(regexp.QuoteMeta(lockQuery)).
+        WithArgs(lockKey).
+        WillReturnResult(pgxmock.NewResult("SELECT", 1))
+    mock.ExpectExec(regexp.QuoteMeta(createQuery)).
+        WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+}
+
+// TestLoad will test loading migration files
+func TestLoad(t *testing.T) {
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        got, err := Load(testFS)
+
+        assert.NoError(t, err)
+        assert.Len(t, got, 2)
+        assert.Equal(t, int64(1), got[0].Version)
+        assert.Equal(t, "create_foo", got[0].Name)
+        assert.Equal(t, "CREATE TABLE foo (id int)", got[0].Up)
+        assert.Equal(t, "DROP TABLE foo", got[0].Down)
+        assert.Equal(t, checksum("CREATE TABLE foo (id int)"), got[0].Checksum)
+        assert.Equal(t, int64(2), got[1].Version)
+        assert.Empty(t, got[1].Down)
+    })
+
+    t.Run("EXPECT SUCCESS embedded migration files", func(t *testing.T) {
+        got, err := Load(FS)
+
+        assert.NoError(t, err)
+        assert.NotEmpty(t, got)
+        for i, mg := range got {
+            assert.NotEmpty(t, mg.Up)
+            assert.NotEmpty(t, mg.Down)
+            if i > 0 {
+                assert.Greater(t, mg.Version, got[i-1].Version)
+            }
+        }
+    })
+
+    t.Run("EXPECT FAIL duplicate version", func(t *testing.T) {
+        got, err := Load(fstest.MapFS{
+            "0001_create_foo.up.sql": {Data: []byte("CREATE TABLE foo (id int)")},
+            "0001_create_bar.up.sql": {Data: []byte("CREATE TABLE bar (id int)")},
+        })
+
+        assert.Error(t, err)
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT FAIL missing up file", func(t *testing.T) {
+        got, err := Load(fstest.MapFS{
+            "0001_create_foo.down.sql": {Data: []byte("DROP TABLE foo")},
+        })
+
+        assert.Error(t, err)
+        assert.Nil(t, got)
+    })
+}
+
+// TestUp will test applying pending migration
+func TestUp(t *testing.T) {
+    t.Run("EXPECT SUCCESS apply pending", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+        migrations := m.Migrations()
+
+        expectLock(mock)
+        mock.ExpectQuery(regexp.QuoteMeta(appliedQuery)).
+            WillReturnRows(mock.NewRows(appliedColumns).
+                AddRow(int64(1), migrations[0].Checksum, time.Now()))
+        mock.ExpectExec(regexp.QuoteMeta(migrations[1].Up)).
+            WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+        mock.ExpectExec(regexp.QuoteMeta(insertQuery)).
+            WithArgs(int64(2), "create_bar", migrations[1].Checksum).
+            WillReturnResult(pgxmock.NewResult("INSERT", 1))
+        mock.ExpectCommit()
+
+        got, err := m.Up(context.Background())
+
+        assert.NoError(t, err)
+        assert.Len(t, got, 1)
+        assert.Equal(t, int64(2), got[0].Version)
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT FAIL checksum mismatch", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+
+        expectLock(mock)
+        mock.ExpectQuery(regexp.QuoteMeta(appliedQuery)).
+            WillReturnRows(mock.NewRows(appliedColumns).
+                AddRow(int64(1), "modified", time.Now()))
+        mock.ExpectRollback()
+
+        got, err := m.Up(context.Background())
+
+        assert.True(t, errors.Is(err, ErrChecksumMismatch))
+        assert.Nil(t, got)
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT FAIL unknown version", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+
+        expectLock(mock)
+        mock.ExpectQuery(regexp.QuoteMeta(appliedQuery)).
+            WillReturnRows(mock.NewRows(appliedColumns).
+                AddRow(int64(99), "unknown", time.Now()))
+        mock.ExpectRollback()
+
+        got, err := m.Up(context.Background())
+
+        assert.True(t, errors.Is(err, ErrUnknownVersion))
+        assert.Nil(t, got)
+    })
+
+    t.Run("EXPECT FAIL migration error rolled back", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+        migrations := m.Migrations()
+
+        expectLock(mock)
+        mock.ExpectQuery(regexp.QuoteMeta(appliedQuery)).
+            WillReturnRows(mock.NewRows(appliedColumns))
+        mock.ExpectExec(regexp.QuoteMeta(migrations[0].Up)).
+            WillReturnError(errors.New("syntax error"))
+        mock.ExpectRollback()
+
+        got, err := m.Up(context.Background())
+
+        assert.Error(t, err)
+        assert.Nil(t, got)
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT FAIL lock error", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+
+        mock.ExpectBegin()
+        mock.ExpectExec(regexp.QuoteMeta(lockQuery)).
+            WithArgs(lockKey).
+            WillReturnError(errors.New("lock timeout"))
+        mock.ExpectRollback()
+
+        got, err := m.Up(context.Background())
+
+        assert.Error(t, err)
+        assert.Nil(t, got)
+    })
+}
+
+// TestDown will test rolling back applied migration
+func TestDown(t *testing.T) {
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+        migrations := m.Migrations()
+
+        expectLock(mock)
+        mock.ExpectQuery(regexp.QuoteMeta(appliedQuery)).
+            WillReturnRows(mock.NewRows(appliedColumns).
+                AddRow(int64(1), migrations[0].Checksum, time.Now()))
+        mock.ExpectExec(regexp.QuoteMeta(migrations[0].Down)).
+            WillReturnResult(pgxmock.NewResult("DROP TABLE", 0))
+        mock.ExpectExec(regexp.QuoteMeta(deleteQuery)).
+            WithArgs(int64(1)).
+            WillReturnResult(pgxmock.NewResult("DELETE", 1))
+        mock.ExpectCommit()
+
+        got, err := m.Down(context.Background(), 1)
+
+        assert.NoError(t, err)
+        assert.Len(t, got, 1)
+        assert.Equal(t, int64(1), got[0].Version)
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT FAIL no down file", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+        migrations := m.Migrations()
+
+        expectLock(mock)
+        mock.ExpectQuery(regexp.QuoteMeta(appliedQuery)).
+            WillReturnRows(mock.NewRows(appliedColumns).
+                AddRow(int64(1), migrations[0].Checksum, time.Now()).
+                AddRow(int64(2), migrations[1].Checksum, time.Now()))
+        mock.ExpectRollback()
+
+        got, err := m.Down(context.Background(), 1)
+
+        assert.True(t, errors.Is(err, ErrNoDown))
+        assert.Nil(t, got)
+    })
+}
+
+// TestStatus will test getting migration status
+func TestStatus(t *testing.T) {
+    t.Run("EXPECT SUCCESS", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+        appliedAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(existsQuery)).
+            WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(true))
+        mock.ExpectQuery(regexp.QuoteMeta(appliedQuery)).
+            WillReturnRows(mock.NewRows(appliedColumns).
+                AddRow(int64(1), "modified", appliedAt))
+        mock.ExpectRollback()
+
+        got, err := m.Status(context.Background())
+
+        assert.NoError(t, err)
+        assert.Len(t, got, 2)
+        assert.True(t, got[0].Applied)
+        assert.True(t, got[0].Modified)
+        assert.Equal(t, appliedAt, got[0].AppliedAt)
+        assert.False(t, got[1].Applied)
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT SUCCESS all pending without migration table", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+
+        // no lock is taken and the table is not created
+        mock.ExpectBegin()
+        mock.ExpectQuery(regexp.QuoteMeta(existsQuery)).
+            WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(false))
+        mock.ExpectRollback()
+
+        got, err := m.Status(context.Background())
+
+        assert.NoError(t, err)
+        assert.Len(t, got, 2)
+        assert.False(t, got[0].Applied)
+        assert.False(t, got[1].Applied)
+        assert.NoError(t, mock.ExpectationsWereMet())
+    })
+
+    t.Run("EXPECT FAIL begin error", func(t *testing.T) {
+        mock, m := newTestMigrator(t)
+        mock.ExpectBegin().WillReturnError(errors.New("connection closed"))
+
+        got, err := m.Status(context.Background())
+
+        assert.Error(t, err)
+        assert.Nil(t, got)
+    })
+}
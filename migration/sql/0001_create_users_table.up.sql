@@ -0,0 +1,16 @@
+-- users table used by account package
+-- IF NOT EXISTS is used so database created manually from the old users.sql
+-- script can be adopted by the migration
+CREATE SEQUENCE IF NOT EXISTS users_id_seq;
+
+CREATE TABLE IF NOT EXISTS users (
+	id int NOT null DEFAULT nextval('users_id_seq'),
+	firstname varchar(30) NOT NULL,
+	lastname varchar(30) NULL,
+	email varchar(75) NOT NULL,
+	passkey varchar(100) NOT NULL,
+	CONSTRAINT users_email_un UNIQUE (email),
+	CONSTRAINT users_pk PRIMARY KEY (id)
+);
+
+ALTER SEQUENCE users_id_seq OWNED BY users.id;
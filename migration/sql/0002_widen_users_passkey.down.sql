@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN passkey TYPE varchar(100);
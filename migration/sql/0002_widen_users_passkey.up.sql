@@ -0,0 +1,2 @@
+-- passkey hold encoded argon2id/ bcrypt hash instead of plain passkey
+ALTER TABLE users ALTER COLUMN passkey TYPE varchar(255);
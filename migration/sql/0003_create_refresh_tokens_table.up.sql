@@ -0,0 +1,15 @@
+-- refresh token issued by the login endpoint, only the sha256 hash of the
+-- token is stored. the token is revoked when it is rotated or on logout
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id bigserial,
+	user_id int NOT NULL,
+	token_hash char(64) NOT NULL,
+	expires_at timestamptz NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	revoked_at timestamptz NULL,
+	CONSTRAINT refresh_tokens_pk PRIMARY KEY (id),
+	CONSTRAINT refresh_tokens_hash_un UNIQUE (token_hash),
+	CONSTRAINT refresh_tokens_user_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens (user_id);
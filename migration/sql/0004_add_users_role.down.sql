@@ -0,0 +1,2 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_ck;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,6 @@
+-- role of the user checked by the auth middleware, existing users get the
+-- user role. admin must be assigned manually or using 'user create -role admin'
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role varchar(20) NOT NULL DEFAULT 'user';
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_ck;
+ALTER TABLE users ADD CONSTRAINT users_role_ck CHECK (role IN ('user', 'admin'));
@@ -0,0 +1,3 @@
+-- version of the user record, incremented by every update and used as the
+-- ETag of the optimistic concurrency control
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,7 @@
+-- email is unique regardless of its case. the application store lowercased
+-- email, address stored in other case by the older version is lowercased
+-- first. the migration fail if two users differ only by the email case, one
+-- of them must be changed manually before running it again
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_un ON users (lower(email));
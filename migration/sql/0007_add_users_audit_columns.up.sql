@@ -0,0 +1,10 @@
+-- creation/ last update time of the user and the user who made the change,
+-- maintained by the repository. the actor is NULL when the change is not
+-- made through the api (eg from the command line) or the actor is deleted
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_by int NULL REFERENCES users (id) ON DELETE SET NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_by int NULL REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS users_updated_at_idx ON users (updated_at, id);
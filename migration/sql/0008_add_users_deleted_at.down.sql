@@ -0,0 +1,5 @@
+-- deleted user can not be told apart without the column, drop it for good
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS users_deleted_at_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,7 @@
+-- soft delete, deleted user keep its row until it is purged after the
+-- retention period. the email of the deleted user stays reserved, so the user
+-- can always be restored
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at timestamptz NULL;
+
+-- only deleted user is indexed, used by the purge job
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
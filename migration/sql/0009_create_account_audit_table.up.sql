@@ -0,0 +1,16 @@
+-- audit log of every mutation of the user, written in the same transaction
+-- as the mutation. user_id and actor_id are not foreign key, so the log is
+-- kept after the user is purged. changes hold the before/ after value of
+-- each changed field, the passkey is redacted
+CREATE TABLE IF NOT EXISTS account_audit (
+	id bigserial,
+	user_id int NOT NULL,
+	actor_id int NULL,
+	action varchar(20) NOT NULL,
+	changes jsonb NOT NULL DEFAULT '{}',
+	request_id varchar(128) NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT account_audit_pk PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS account_audit_user_idx ON account_audit (user_id, id);
@@ -0,0 +1,3 @@
+-- tell token revoked by rotation apart from token revoked on logout, only
+-- reusing rotated token means the token was stolen
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS rotated_at timestamptz NULL;
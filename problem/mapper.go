@@ -0,0 +1,92 @@
+/*
+    package problem
+    mapper.go
+    - mapping of error returned by the service layer to problem details. the
+      handlers share the mapper, so the same error always get the same status
+*/
+package problem
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// detail of the status code mapped by every Mapper
+const (
+    detailTimeout  = "the database did not respond in time"
+    detailInternal = "the server encountered an unexpected condition"
+)
+
+// Mapping is status code and problem detail of error matching Err
+type Mapping struct {
+    Err    error
+    Status int
+    Detail string
+}
+
+// Mapper will map error returned by the service layer to problem details.
+// error not matching any mapping is 504 if the query timeout was exceeded
+// (context.DeadlineExceeded), otherwise 500
+type Mapper struct {
+    // Mappings is checked in order using errors.Is, the first match win
+    Mappings []Mapping
+
+    // Fields will get field-level failures of the error, nil means the
+    // problem never list field errors
+    Fields func(err error) []FieldError
+
+    // Logged is client error status code logged like server error, eg 409
+    // which may reveal a bug of the client
+    Logged []int
+}
+
+// With will get copy of the mapper checking 'mappings' before its own
+func (m Mapper) With(mappings ...Mapping) Mapper {
+    m.Mappings = append(append([]Mapping{}, mappings...), m.Mappings...)
+    return m
+}
+
+// Map will get status code and detail of 'err', the raw error is never used
+// as the detail so it does not leak to the client
+func (m Mapper) Map(err error) (int, string) {
+    for _, mapping := range m.Mappings {
+        if errors.Is(err, mapping.Err) {
+            return mapping.Status, mapping.Detail
+        }
+    }
+    if errors.Is(err, context.DeadlineExceeded) {
+        return http.StatusGatewayTimeout, detailTimeout
+    }
+
+    return http.StatusInternalServerError, detailInternal
+}
+
+// Respond will abort the request and response with problem details matching
+// 'err'. server error and Logged status is logged together with the request id
+func (m Mapper) Respond(c *gin.Context, err error) {
+    code, detail := m.Map(err)
+    p := New(code, detail)
+    if m.Fields != nil {
+        p.Errors = m.Fields(err)
+    }
+
+    if code >= http.StatusInternalServerError || m.logged(code) {
+        log.Printf("request %s %s %s failed: %v\n", RequestID(c), c.Request.Method, c.Request.URL.Path, err)
+    }
+
+    Write(c, p)
+}
+
+// logged will report whether client error 'code' is logged
+func (m Mapper) logged(code int) bool {
+    for _, c := range m.Logged {
+        if c == code {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,83 @@
+/*
+    package problem
+    mapper_test.go
+    - test mapping service error to problem details
+*/
+package problem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// sentinel error of the test mapper
+var (
+    errInvalid  = errors.New("test: input invalid")
+    errMissing  = errors.New("test: resource missing")
+    errExtended = errors.New("test: token expired")
+)
+
+// testMapper is mapper of the test sentinel error
+var testMapper = Mapper{
+    Mappings: []Mapping{
+        {Err: errInvalid, Status: http.StatusBadRequest, Detail: "the request is invalid"},
+        {Err: errMissing, Status: http.StatusNotFound, Detail: "the resource does not exist"},
+    },
+    Fields: func(err error) []FieldError {
+        if errors.Is(err, errInvalid) {
+            return []FieldError{{Field: "email", Message: "is required"}}
+        }
+        return nil
+    },
+}
+
+// TestMapperMap will test mapping error to status code and detail
+func TestMapperMap(t *testing.T) {
+    extended := testMapper.With(Mapping{Err: errExtended, Status: http.StatusUnauthorized, Detail: "the token is invalid"})
+
+    cases := []struct {
+        name   string
+        mapper Mapper
+        err    error
+        want   int
+    }{
+        {"EXPECT mapped wrapped error", testMapper, fmt.Errorf("user: %w", errMissing), http.StatusNotFound},
+        {"EXPECT 504 timeout", testMapper, fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+        {"EXPECT 500 unmapped", testMapper, errors.New("connection reset"), http.StatusInternalServerError},
+        {"EXPECT extended mapping", extended, errExtended, http.StatusUnauthorized},
+        {"EXPECT extended keep the base mapping", extended, errInvalid, http.StatusBadRequest},
+        {"EXPECT base not changed by With", testMapper, errExtended, http.StatusInternalServerError},
+    }
+
+    for _, tt := range cases {
+        t.Run(tt.name, func(t *testing.T) {
+            code, detail := tt.mapper.Map(tt.err)
+            assert.Equal(t, tt.want, code)
+            assert.NotEmpty(t, detail)
+            assert.NotContains(t, detail, tt.err.Error())
+        })
+    }
+}
+
+// TestMapperRespond will test responding with problem details of the error
+func TestMapperRespond(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodPost, "/v1/account/", nil)
+
+    testMapper.Respond(c, fmt.Errorf("user: %w", errInvalid))
+
+    assert.Equal(t, http.StatusBadRequest, w.Code)
+    assert.True(t, c.IsAborted())
+    assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+    assert.JSONEq(t, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"the request is invalid",`+
+        `"instance":"/v1/account/","errors":[{"field":"email","message":"is required"}]}`, w.Body.String())
+}
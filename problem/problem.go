@@ -0,0 +1,150 @@
+/*
+    package problem
+    problem.go
+    - machine-readable error response following RFC 7807 problem details,
+      served as 'application/problem+json'
+*/
+package problem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is media type of the problem details response
+const ContentType = "application/problem+json"
+
+// DefaultType is problem type without additional semantic than its status code
+const DefaultType = "about:blank"
+
+// RequestIDHeader is header holding the request id of request and response
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDRe is pattern of request id accepted from the client, the id is
+// echoed back and stored by the audit log so anything else is replaced
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestIDKey is gin context key of the request id
+const requestIDKey = "problem.request_id"
+
+// requestIDCtxKey is request context key of the request id
+type requestIDCtxKey struct{}
+
+// FieldError is validation failure of single field
+type FieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// Problem is RFC 7807 problem details. Errors and RequestID are extension
+// member holding field-level validation failures and the request id
+type Problem struct {
+    Type      string       `json:"type"`
+    Title     string       `json:"title"`
+    Status    int          `json:"status"`
+    Detail    string       `json:"detail,omitempty"`
+    Instance  string       `json:"instance,omitempty"`
+    Errors    []FieldError `json:"errors,omitempty"`
+    RequestID string       `json:"request_id,omitempty"`
+}
+
+// New will create problem with 'status' code, the title is the status text
+func New(status int, detail string) *Problem {
+    return &Problem{
+        Type:   DefaultType,
+        Title:  http.StatusText(status),
+        Status: status,
+        Detail: detail,
+    }
+}
+
+// Error will make Problem usable as error
+func (p *Problem) Error() string {
+    if p.Detail == "" {
+        return p.Title
+    }
+    return p.Title + ": " + p.Detail
+}
+
+// Write will abort the request and response with 'p'. Instance and RequestID
+// are filled from the request if they are empty
+func Write(c *gin.Context, p *Problem) {
+    if p.Instance == "" && c.Request != nil {
+        p.Instance = c.Request.URL.Path
+    }
+    if p.RequestID == "" {
+        p.RequestID = RequestID(c)
+    }
+
+    // content type must be set before rendering, otherwise gin use application/json
+    c.Header("Content-Type", ContentType)
+    c.AbortWithStatusJSON(p.Status, p)
+}
+
+// RequestIDMiddleware will assign request id to every request, the id sent by
+// the client through X-Request-ID header is used if it is at most 128 letters,
+// digits, '.', '_' or '-'. the id is returned in X-Request-ID response header
+// and carried by the request context
+func RequestIDMiddleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        id := c.GetHeader(RequestIDHeader)
+        if !requestIDRe.MatchString(id) {
+            id = newRequestID()
+        }
+
+        c.Set(requestIDKey, id)
+        c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+        c.Header(RequestIDHeader, id)
+        c.Next()
+    }
+}
+
+// RequestID will get request id assigned by RequestIDMiddleware, it is empty
+// if the middleware is not used
+func RequestID(c *gin.Context) string {
+    return c.GetString(requestIDKey)
+}
+
+// WithRequestID will get copy of 'ctx' carrying request id 'id'
+func WithRequestID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestIDFrom will get request id carried by 'ctx', empty if there is none
+// eg operation started from the command line
+func RequestIDFrom(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDCtxKey{}).(string)
+    return id
+}
+
+// newRequestID will generate random request id
+func newRequestID() string {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return ""
+    }
+    return hex.EncodeToString(b)
+}
+
+// Recovery is gin recovery middleware responding with problem details
+// instead of empty 500 response, the panic is still logged by gin
+func Recovery() gin.HandlerFunc {
+    return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+        Write(c, New(http.StatusInternalServerError, detailInternal))
+    })
+}
+
+// NoRoute is handler for unknown route, eg using gin.Engine.NoRoute
+func NoRoute(c *gin.Context) {
+    Write(c, New(http.StatusNotFound, "the requested resource does not exist"))
+}
+
+// NoMethod is handler for unsupported method, eg using gin.Engine.NoMethod
+func NoMethod(c *gin.Context) {
+    Write(c, New(http.StatusMethodNotAllowed, "the requested method is not supported by the resource"))
+}
@@ -0,0 +1,127 @@
+/*
+    package problem
+    problem_test.go
+    - test problem details response and the middlewares
+*/
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRouter will prepare gin router using the problem middlewares
+func newTestRouter() *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(RequestIDMiddleware(), Recovery())
+    r.HandleMethodNotAllowed = true
+    r.NoRoute(NoRoute)
+    r.NoMethod(NoMethod)
+
+    r.GET("/invalid", func(c *gin.Context) {
+        p := New(http.StatusBadRequest, "the request is invalid")
+        p.Errors = []FieldError{{Field: "email", Message: "is required"}}
+        Write(c, p)
+    })
+    r.GET("/request-id", func(c *gin.Context) {
+        c.String(http.StatusOK, RequestIDFrom(c.Request.Context()))
+    })
+    r.GET("/panic", func(c *gin.Context) {
+        panic("boom")
+    })
+
+    return r
+}
+
+// serve will serve request and decode the problem response
+func serve(t *testing.T, r *gin.Engine, req *http.Request) (*httptest.ResponseRecorder, Problem) {
+    t.Helper()
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+
+    var p Problem
+    require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+    assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+
+    return w, p
+}
+
+// TestWrite will test writing problem details from handler
+func TestWrite(t *testing.T) {
+    t.Run("EXPECT SUCCESS with field errors", func(t *testing.T) {
+        req := httptest.NewRequest(http.MethodGet, "/invalid", nil)
+        req.Header.Set(RequestIDHeader, "req-1")
+
+        w, p := serve(t, newTestRouter(), req)
+
+        assert.Equal(t, http.StatusBadRequest, w.Code)
+        assert.Equal(t, Problem{
+            Type:      DefaultType,
+            Title:     "Bad Request",
+            Status:    http.StatusBadRequest,
+            Detail:    "the request is invalid",
+            Instance:  "/invalid",
+            Errors:    []FieldError{{Field: "email", Message: "is required"}},
+            RequestID: "req-1",
+        }, p)
+        assert.Equal(t, "req-1", w.Header().Get(RequestIDHeader))
+    })
+
+    t.Run("EXPECT SUCCESS generated request id", func(t *testing.T) {
+        w, p := serve(t, newTestRouter(), httptest.NewRequest(http.MethodGet, "/invalid", nil))
+
+        assert.Len(t, p.RequestID, 32)
+        assert.Equal(t, p.RequestID, w.Header().Get(RequestIDHeader))
+    })
+}
+
+// TestRequestIDFrom will test the request id is carried by the request context
+func TestRequestIDFrom(t *testing.T) {
+    req := httptest.NewRequest(http.MethodGet, "/request-id", nil)
+    req.Header.Set(RequestIDHeader, "req-1")
+    w := httptest.NewRecorder()
+    newTestRouter().ServeHTTP(w, req)
+
+    assert.Equal(t, "req-1", w.Body.String())
+    assert.Empty(t, RequestIDFrom(req.Context()))
+
+    // EXPECT invalid id replaced by generated id
+    for _, id := range []string{"req 1", "req\x01", "req-\xff", strings.Repeat("a", 129)} {
+        req := httptest.NewRequest(http.MethodGet, "/request-id", nil)
+        req.Header.Set(RequestIDHeader, id)
+        w := httptest.NewRecorder()
+        newTestRouter().ServeHTTP(w, req)
+
+        assert.Len(t, w.Body.String(), 32, id)
+        assert.NotEqual(t, id, w.Header().Get(RequestIDHeader), id)
+    }
+}
+
+// TestRecovery will test panic is responded with problem details
+func TestRecovery(t *testing.T) {
+    w, p := serve(t, newTestRouter(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+    assert.Equal(t, http.StatusInternalServerError, w.Code)
+    assert.Equal(t, http.StatusInternalServerError, p.Status)
+    assert.NotContains(t, w.Body.String(), "boom")
+    assert.NotEmpty(t, p.RequestID)
+}
+
+// TestNoRoute will test unknown route and method
+func TestNoRoute(t *testing.T) {
+    w, p := serve(t, newTestRouter(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+    assert.Equal(t, http.StatusNotFound, w.Code)
+    assert.Equal(t, "Not Found", p.Title)
+
+    w, p = serve(t, newTestRouter(), httptest.NewRequest(http.MethodPost, "/invalid", nil))
+    assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+    assert.Equal(t, "/invalid", p.Instance)
+}
@@ -0,0 +1,154 @@
+/*
+    seed.go
+    - 'seed' command, load fixture users into the database
+*/
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"pgxtest/account"
+)
+
+// fixtures is embedded fixture files of the application
+//go:embed fixtures/users.json
+var fixtures embed.FS
+
+// environment variable of the seeded admin, used when the flag is not given
+const (
+    adminEmailEnv   = "APP_SEED_ADMIN_EMAIL"
+    adminPassKeyEnv = "APP_SEED_ADMIN_PASSKEY"
+)
+
+// seedCmd will create users from fixture file. users with email that already
+// exist are skipped, so the command can be run more than once. the fixture
+// only has user role, admin is created only when its email and passkey are
+// given through flag or environment variable
+func seedCmd(args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+    fs.SetOutput(out)
+    file := fs.String("file", "", "path to json fixture file, default to the embedded fixture users")
+    adminEmail := fs.String("admin-email", "", "email of the admin to create (env "+adminEmailEnv+")")
+    adminPassKey := fs.String("admin-passkey", "", "passkey of the admin to create (env "+adminPassKeyEnv+")")
+    cfg, err := loadConfig(fs, args)
+    if err != nil {
+        return err
+    }
+    if *adminEmail == "" {
+        *adminEmail = os.Getenv(adminEmailEnv)
+    }
+    if *adminPassKey == "" {
+        *adminPassKey = os.Getenv(adminPassKeyEnv)
+    }
+
+    users, err := readFixture(*file)
+    if err != nil {
+        return err
+    }
+    admin, err := seedAdmin(*adminEmail, *adminPassKey)
+    if err != nil {
+        return err
+    }
+    if admin != nil {
+        users = append(users, *admin)
+    }
+
+    ctx := context.Background()
+    ds, closeDB, err := connect(ctx, cfg)
+    if err != nil {
+        return err
+    }
+    defer closeDB()
+
+    svc, err := newAccountService(ds.Pool(), cfg)
+    if err != nil {
+        return err
+    }
+    return seedUsers(ctx, svc, users, out)
+}
+
+// readFixture will read users from json fixture file 'path', the embedded
+// fixture is used if 'path' is empty. fixture user other than user role is
+// refused, the fixture passkey is not secret so it must not grant admin
+func readFixture(path string) ([]account.User, error) {
+    var (
+        b   []byte
+        err error
+    )
+    if path == "" {
+        b, err = fixtures.ReadFile("fixtures/users.json")
+    } else {
+        b, err = ioutil.ReadFile(path)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("seed: reading fixture file: %w", err)
+    }
+
+    var users []account.User
+    if err := json.Unmarshal(b, &users); err != nil {
+        return nil, fmt.Errorf("seed: parsing fixture file: %w", err)
+    }
+    for _, u := range users {
+        if u.Role != "" && u.Role != account.RoleUser {
+            return nil, fmt.Errorf("seed: fixture user %s has role %q, only %q is seeded (use -admin-email and -admin-passkey for admin)",
+                u.Email, u.Role, account.RoleUser)
+        }
+    }
+
+    return users, nil
+}
+
+// seedAdmin will get admin user of 'email' and 'passkey' to seed, nil if
+// both are empty. admin is never seeded with only one of them
+func seedAdmin(email, passkey string) (*account.User, error) {
+    if email == "" && passkey == "" {
+        return nil, nil
+    }
+    if email == "" || passkey == "" {
+        return nil, fmt.Errorf("seed: admin require both -admin-email (env %s) and -admin-passkey (env %s)",
+            adminEmailEnv, adminPassKeyEnv)
+    }
+
+    return &account.User{Firstname: "admin", Email: email, PassKey: passkey, Role: account.RoleAdmin}, nil
+}
+
+// seedUsers will create 'users' which email is not exist yet using 'svc'.
+// soft deleted user still reserve its email, so it is skipped as well. the
+// email is compared normalized as it is stored
+func seedUsers(ctx context.Context, svc account.AccountService, users []account.User, out io.Writer) error {
+    existing, err := listUsers(ctx, svc, true)
+    if err != nil {
+        return fmt.Errorf("seed: reading existing users: %w", err)
+    }
+
+    emails := make(map[string]bool, len(existing))
+    for _, u := range existing {
+        emails[account.NormalizeEmail(u.Email)] = true
+    }
+
+    created := 0
+    for _, u := range users {
+        email := account.NormalizeEmail(u.Email)
+        if emails[email] {
+            fmt.Fprintf(out, "skipped %s, already exist\n", u.Email)
+            continue
+        }
+
+        res, err := svc.Create(ctx, u)
+        if err != nil {
+            return fmt.Errorf("seed: creating user %s: %w", u.Email, err)
+        }
+        emails[email] = true
+        created++
+        fmt.Fprintf(out, "created user %d %s\n", res.ID, res.Email)
+    }
+    fmt.Fprintf(out, "%d user created\n", created)
+
+    return nil
+}
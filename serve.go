@@ -0,0 +1,187 @@
+/*
+    serve.go
+    - 'serve' command, start the http server and shut it down gracefully on
+      SIGINT/ SIGTERM
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"pgxtest/account"
+	"pgxtest/auth"
+	"pgxtest/config"
+	"pgxtest/health"
+	"pgxtest/problem"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveCmd will start the http server. address and mode can be changed
+// through config file, env APP_ADDRESS/ APP_MODE or flag -addr/ -mode
+func serveCmd(args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+    fs.SetOutput(out)
+    cfg, err := loadConfig(fs, args)
+    if err != nil {
+        return err
+    }
+
+    // ctx is cancelled on SIGINT/ SIGTERM to start the graceful shutdown,
+    // serveHTTP call stop as soon as shutting down so second signal kill
+    // the process instead of waiting for the shutdown
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    // prepare gin, mode can be changed through config file, env APP_MODE or flag -mode
+    gin.SetMode(cfg.Server.Mode)
+
+    // gin with default setup, error and panic are responded with problem details
+    r := gin.New()
+    // r.Use(gin.Logger())
+    r.Use(problem.RequestIDMiddleware(), problem.Recovery())
+    r.HandleMethodNotAllowed = true
+    r.NoRoute(problem.NoRoute)
+    r.NoMethod(problem.NoMethod)
+
+    // token signing key is checked before connecting to the database, so
+    // missing secret is reported without waiting for the database
+    tokens, err := cfg.Auth.TokenIssuer()
+    if err != nil {
+        return err
+    }
+
+    // prepare database, remember to create the database first.
+    // the tables are created by the migration (see -auto-migrate flag).
+    // the pool is closed after the server is completely shut down
+    ds, closeDB, err := connect(ctx, cfg)
+    if err != nil {
+        return err
+    }
+    defer func() {
+        closeDB()
+        log.Println("database connection pool closed")
+    }()
+    dbPool := ds.Pool()
+
+    // apply pending schema migration, enabled through config file, env APP_AUTO_MIGRATE or flag -auto-migrate
+    if cfg.Migration.Auto {
+        if _, err := migrateUp(ctx, dbPool, out); err != nil {
+            return err
+        }
+    }
+
+    // liveness and readiness probe, readiness start failing when the database
+    // is not reachable or as soon as the server is draining
+    checker := health.New(dbPool, dbPool.Stat, cfg.Server.HealthTimeout)
+    r.GET("/healthz", checker.LivenessHandler)
+    r.GET("/readyz", checker.ReadinessHandler)
+
+    // datastore := account.NewDatastore(dbPool)
+    accService, err := newAccountService(dbPool, cfg)
+    if err != nil {
+        return err
+    }
+    accAPI := account.NewAccountHandler(accService)
+
+    // permanently delete user soft deleted longer than the retention period,
+    // the job stop together with the server
+    go account.RunPurge(ctx, accService, cfg.Purge)
+
+    // refresh token share the default query timeout of the database
+    authDB := auth.NewDatabase(dbPool).WithTimeout(cfg.Database.QueryTimeout.Default)
+    authAPI := auth.NewAuthHandler(auth.NewAuthService(accService, authDB, tokens))
+
+    // prepare router
+    // main group api endpoint url : http://domain.com/v1
+    v1 := r.Group("/v1")
+
+    // account app group api endpoint : http://domainname.com/v1/account
+    // every route require bearer access token, user may only read and update
+    // itself while admin may do anything
+    accRouter := v1.Group("/account", auth.Authenticate(tokens))
+    accRouter.POST("/", auth.RequireAdmin(), accAPI.UserCreateHandler)
+    accRouter.PUT("/:id", auth.RequireSelfOrAdmin("id"), accAPI.UserUpdateHandler)
+    accRouter.PATCH("/:id", auth.RequireSelfOrAdmin("id"), accAPI.UserPatchHandler)
+    accRouter.DELETE("/:id", auth.RequireAdmin(), accAPI.UserDeleteHandler)
+    accRouter.POST("/:id/restore", auth.RequireAdmin(), accAPI.UserRestoreHandler)
+    accRouter.GET("/by-email", auth.RequireAdmin(), accAPI.UserGetByEmailHandler)
+    accRouter.GET("/:id", auth.RequireSelfOrAdmin("id"), accAPI.UserGetHandler)
+    accRouter.GET("/:id/history", auth.RequireSelfOrAdmin("id"), accAPI.UserHistoryHandler)
+    accRouter.GET("/", auth.RequireAdmin(), accAPI.UserGetsHandler)
+
+    // auth app group api endpoint : http://domainname.com/v1/auth
+    authRouter := v1.Group("/auth")
+    authRouter.POST("/login", authAPI.LoginHandler)
+    authRouter.POST("/refresh", authAPI.RefreshHandler)
+    authRouter.POST("/logout", authAPI.LogoutHandler)
+
+    // run the server
+    ln, err := net.Listen("tcp", cfg.Server.Address)
+    if err != nil {
+        return err
+    }
+    log.Printf("listening on %s\n", ln.Addr())
+
+    return serveHTTP(ctx, stop, &http.Server{Handler: r}, ln, checker.Drain, cfg.Server)
+}
+
+// serveHTTP will serve 'srv' on 'ln' until 'ctx' is done, then shut the server
+// down gracefully: 'stop' is called first to restore the default signal
+// behavior, then 'drain' so readiness start failing, then
+// after cfg.ShutdownDelay the server stop accepting new connection and wait
+// for in-flight requests up to cfg.ShutdownTimeout
+func serveHTTP(ctx context.Context, stop func(), srv *http.Server, ln net.Listener, drain func(), cfg config.ServerConfig) error {
+    errc := make(chan error, 1)
+    go func() {
+        errc <- srv.Serve(ln)
+    }()
+
+    // server failed before receiving shutdown signal
+    select {
+    case err := <-errc:
+        return err
+    case <-ctx.Done():
+    }
+
+    // stop capturing the signal, second signal terminate the process
+    stop()
+
+    log.Println("shutting down, draining in-flight requests")
+    drain()
+    if cfg.ShutdownDelay > 0 {
+        time.Sleep(cfg.ShutdownDelay)
+    }
+
+    // zero timeout means waiting for in-flight requests without limit
+    shutdownCtx := context.Background()
+    if cfg.ShutdownTimeout > 0 {
+        var cancel context.CancelFunc
+        shutdownCtx, cancel = context.WithTimeout(shutdownCtx, cfg.ShutdownTimeout)
+        defer cancel()
+    }
+
+    if err := srv.Shutdown(shutdownCtx); err != nil {
+        // drop the remaining connection if the timeout is exceeded
+        srv.Close()
+        return fmt.Errorf("shutting down http server: %w", err)
+    }
+
+    // Serve always return ErrServerClosed after Shutdown
+    if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+        return err
+    }
+    log.Println("http server stopped")
+
+    return nil
+}
@@ -0,0 +1,98 @@
+/*
+    serve_test.go
+    - test graceful shutdown of the http server
+*/
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"pgxtest/config"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServeHTTP will test serving and shutting down the http server
+func TestServeHTTP(t *testing.T) {
+    t.Run("EXPECT SUCCESS in-flight request finished", func(t *testing.T) {
+        ln, err := net.Listen("tcp", "127.0.0.1:0")
+        require.NoError(t, err)
+
+        started := make(chan struct{})
+        srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            close(started)
+            time.Sleep(100 * time.Millisecond)
+            w.Write([]byte("done"))
+        })}
+
+        ctx, cancel := context.WithCancel(context.Background())
+        stopped, drained := make(chan struct{}), make(chan struct{})
+        drain := func() {
+            // signal is released before draining
+            _, ok := <-stopped
+            assert.False(t, ok)
+            close(drained)
+        }
+        errc := make(chan error, 1)
+        go func() {
+            errc <- serveHTTP(ctx, func() { close(stopped) }, srv, ln, drain, config.ServerConfig{ShutdownTimeout: time.Second})
+        }()
+
+        // shut down while the request is in-flight
+        resc := make(chan string, 1)
+        go func() {
+            res, err := http.Get("http://" + ln.Addr().String())
+            if err != nil {
+                resc <- err.Error()
+                return
+            }
+            defer res.Body.Close()
+            b, _ := ioutil.ReadAll(res.Body)
+            resc <- string(b)
+        }()
+        <-started
+        cancel()
+
+        assert.Equal(t, "done", <-resc)
+        assert.NoError(t, <-errc)
+        _, ok := <-drained
+        assert.False(t, ok)
+    })
+
+    t.Run("EXPECT FAIL shutdown timeout", func(t *testing.T) {
+        ln, err := net.Listen("tcp", "127.0.0.1:0")
+        require.NoError(t, err)
+
+        started := make(chan struct{})
+        srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            close(started)
+            time.Sleep(time.Second)
+        })}
+
+        ctx, cancel := context.WithCancel(context.Background())
+        errc := make(chan error, 1)
+        go func() {
+            errc <- serveHTTP(ctx, func() {}, srv, ln, func() {}, config.ServerConfig{ShutdownTimeout: 10 * time.Millisecond})
+        }()
+
+        go http.Get("http://" + ln.Addr().String())
+        <-started
+        cancel()
+
+        assert.ErrorIs(t, <-errc, context.DeadlineExceeded)
+    })
+
+    t.Run("EXPECT FAIL serve error", func(t *testing.T) {
+        ln, err := net.Listen("tcp", "127.0.0.1:0")
+        require.NoError(t, err)
+        ln.Close()
+
+        err = serveHTTP(context.Background(), func() {}, &http.Server{}, ln, func() {}, config.ServerConfig{})
+
+        assert.Error(t, err)
+    })
+}
@@ -0,0 +1,128 @@
+/*
+    user.go
+    - 'user' command, manage users through AccountService without the http server
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"pgxtest/account"
+	"strconv"
+)
+
+// userCmd will run user admin action from 'args', one of "create", "get",
+// "list", "delete" or "restore". the result is written to 'out' as json
+func userCmd(args []string, out io.Writer) error {
+    if len(args) == 0 {
+        return errors.New("user: missing action (create, get, list, delete or restore)")
+    }
+    action, args := args[0], args[1:]
+
+    fs := flag.NewFlagSet("user "+action, flag.ContinueOnError)
+    fs.SetOutput(out)
+    var u account.User
+    switch action {
+    case "create":
+        fs.StringVar(&u.Firstname, "firstname", "", "first name of the user (required)")
+        fs.StringVar(&u.Lastname, "lastname", "", "last name of the user")
+        fs.StringVar(&u.Email, "email", "", "email of the user (required)")
+        fs.StringVar(&u.PassKey, "passkey", "", "passkey of the user (required)")
+        fs.StringVar(&u.Role, "role", account.RoleUser, "role of the user (user or admin)")
+    case "get", "delete", "restore":
+        fs.Usage = func() {
+            fmt.Fprintf(out, "usage: user %s [flags] <id>\n", action)
+            fs.PrintDefaults()
+        }
+    case "list":
+    default:
+        return fmt.Errorf("user: unknown action %q (create, get, list, delete or restore)", action)
+    }
+
+    cfg, err := loadConfig(fs, args)
+    if err != nil {
+        return err
+    }
+
+    // validate the input before connecting to the database
+    var id int
+    switch action {
+    case "create":
+        if u.Firstname == "" || u.Email == "" || u.PassKey == "" {
+            return errors.New("user: -firstname, -email and -passkey are required")
+        }
+    case "get", "delete", "restore":
+        if fs.NArg() != 1 {
+            return fmt.Errorf("user: %s expect exactly one user id", action)
+        }
+        if id, err = strconv.Atoi(fs.Arg(0)); err != nil {
+            return fmt.Errorf("user: invalid user id %q", fs.Arg(0))
+        }
+    }
+
+    ctx := context.Background()
+    ds, closeDB, err := connect(ctx, cfg)
+    if err != nil {
+        return err
+    }
+    defer closeDB()
+
+    svc, err := newAccountService(ds.Pool(), cfg)
+    if err != nil {
+        return err
+    }
+    return runUser(ctx, svc, action, id, u, out)
+}
+
+// runUser will run user admin 'action' using 'svc' and write the result to
+// 'out' as json. 'id' is used by "get", "delete" and "restore", 'u' is used
+// by "create"
+func runUser(ctx context.Context, svc account.AccountService, action string, id int, u account.User, out io.Writer) error {
+    var (
+        res interface{}
+        err error
+    )
+    switch action {
+    case "create":
+        res, err = svc.Create(ctx, u)
+    case "get":
+        res, err = svc.Get(ctx, id)
+    case "list":
+        res, err = listUsers(ctx, svc, false)
+    case "delete":
+        res, err = svc.Delete(ctx, id, 0)
+    case "restore":
+        res, err = svc.Restore(ctx, id, 0)
+    default:
+        return fmt.Errorf("user: unknown action %q (create, get, list, delete or restore)", action)
+    }
+    if err != nil {
+        return fmt.Errorf("user %s: %w", action, err)
+    }
+
+    enc := json.NewEncoder(out)
+    enc.SetIndent("", "  ")
+    return enc.Encode(res)
+}
+
+// listUsers will get every user from 'svc' by following the pages, soft
+// deleted user is included if 'includeDeleted'. empty list is [] instead of null
+func listUsers(ctx context.Context, svc account.AccountService, includeDeleted bool) ([]*account.UserResponse, error) {
+    users := []*account.UserResponse{}
+    opts := account.ListOptions{Limit: account.MaxLimit, IncludeDeleted: includeDeleted}
+    for {
+        page, err := svc.Gets(ctx, opts)
+        if err != nil {
+            return nil, err
+        }
+        users = append(users, page.Users...)
+        if page.NextCursor == "" {
+            return users, nil
+        }
+        opts.Cursor = page.NextCursor
+    }
+}